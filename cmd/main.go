@@ -20,10 +20,13 @@ package main
 
 import (
 	"Unbewohnte/SNGCNOTIFIERbot/internal/bot"
+	"context"
 	"flag"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 const CONFIG_NAME string = "config.json"
@@ -59,7 +62,17 @@ func main() {
 		log.Panic(err)
 	}
 
-	if err := bot.Start(); err != nil {
+	// Корневой контекст отменяется по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := bot.Start(ctx); err != nil {
 		log.Panic(err)
 	}
+
+	if err := bot.Close(); err != nil {
+		log.Printf("Ошибка закрытия базы данных: %s", err)
+	}
+
+	log.Println("Бот остановлен")
 }
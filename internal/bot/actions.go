@@ -0,0 +1,382 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+const CALLBACK_ACTION = "act:"
+
+// Действия модератора над комментарием
+const (
+	ACTION_HANDLED = "handled"
+	ACTION_SPAM    = "spam"
+	ACTION_MUTE    = "mute"
+	ACTION_PAUSE   = "pause"
+	ACTION_REPLY   = "reply"   // Кнопка: подсказка, как ответить
+	ACTION_REPLIED = "replied" // Ответ опубликован в соцсети
+
+	// Модерация в соцсети: кнопка, подтверждение и итоговое состояние
+	ACTION_DELETE         = "delete"
+	ACTION_CONFIRM_DELETE = "delete_ok"
+	ACTION_DELETED        = "deleted"
+	ACTION_BAN            = "ban"
+	ACTION_CONFIRM_BAN    = "ban_ok"
+	ACTION_BANNED         = "banned"
+	ACTION_CANCEL         = "cancel"
+
+	// Комментарий задержан спам-правилом с действием quarantine
+	ACTION_QUARANTINED     = "quarantined"
+	ACTION_NOT_SPAM        = "notspam"    // Кнопка в чате карантина: доставить комментарий
+	ACTION_NOT_SPAM_ALWAYS = "notspam_ex" // То же и больше не считать такой текст спамом
+
+	// Списки авторов (db.AUTHOR_*)
+	ACTION_TRUST = "trust"
+	ACTION_BLOCK = "block"
+
+	// Комментарий свернут в серию флуда (см. collapseFlood)
+	ACTION_FLOOD = "flood"
+)
+
+// Подписи состояний комментария в оповещении
+var actionLabels = map[string]string{
+	ACTION_HANDLED: "✅ Обработано",
+	ACTION_SPAM:    "🚫 Спам",
+	ACTION_MUTE:    "🔇 Автор заглушен",
+	ACTION_PAUSE:   "⏸ Группа приостановлена",
+	ACTION_REPLIED: "↩️ Ответ отправлен",
+	ACTION_DELETED: "🗑 Комментарий удален",
+	ACTION_BANNED:  "⛔ Автор заблокирован",
+
+	ACTION_QUARANTINED: "🚧 В карантине",
+	ACTION_NOT_SPAM:    "✅ Не спам",
+
+	ACTION_TRUST: "🤝 Автор в доверенных",
+	ACTION_BLOCK: "🚷 Автор в черном списке",
+	ACTION_FLOOD: "🔁 Свернут в серию флуда",
+}
+
+// Клавиатура действий под оповещением. key - ключ комментария в БД
+// (см. db.SaveSentComment). withFullText добавляет кнопку полного текста
+func (bot *Bot) notificationKeyboard(key int64, comment db.Comment, withFullText bool) *telego.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return CALLBACK_ACTION + action + ":" + strconv.FormatInt(key, 10)
+	}
+
+	rows := [][]telego.InlineKeyboardButton{
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("✅ Обработано").WithCallbackData(data(ACTION_HANDLED)),
+			tu.InlineKeyboardButton("🚫 Спам").WithCallbackData(data(ACTION_SPAM)),
+		),
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("🔇 Заглушить автора").WithCallbackData(data(ACTION_MUTE)),
+			tu.InlineKeyboardButton("⏸ Пауза группы").WithCallbackData(data(ACTION_PAUSE)),
+		),
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("🤝 Доверять автору").WithCallbackData(data(ACTION_TRUST)),
+			tu.InlineKeyboardButton("🚷 Блокировать автора").WithCallbackData(data(ACTION_BLOCK)),
+		),
+	}
+
+	if bot.canModerateNetwork(comment.Network) {
+		rows = append(rows, tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("🗑 Удалить").WithCallbackData(data(ACTION_DELETE)),
+			tu.InlineKeyboardButton("⛔ Забанить").WithCallbackData(data(ACTION_BAN)),
+		))
+	}
+
+	var last []telego.InlineKeyboardButton
+	if bot.canReply(comment.Network) {
+		last = append(last, tu.InlineKeyboardButton("↩️ Ответить").WithCallbackData(data(ACTION_REPLY)))
+	}
+	if postURL := strings.TrimSpace(comment.PostURL); strings.HasPrefix(postURL, "http") {
+		last = append(last, tu.InlineKeyboardButton("🔗 Пост").WithURL(postURL))
+	}
+	if withFullText {
+		last = append(last, tu.InlineKeyboardButton("📄 Показать полностью").
+			WithCallbackData(CALLBACK_FULL_TEXT+strconv.FormatInt(key, 10)))
+	}
+	if len(last) > 0 {
+		rows = append(rows, last)
+	}
+
+	return tu.InlineKeyboard(rows...)
+}
+
+// Строка о последнем действии модератора. Пусто, если действий не было
+func commentStatusLine(comment db.Comment) string {
+	label, ok := actionLabels[comment.Status]
+	if !ok {
+		return ""
+	}
+
+	// Карантин и флуд - решения фильтра, а не модератора: вместо
+	// имени модератора показывается сработавшее правило, если оно есть
+	who := comment.HandledBy
+	if comment.Status == ACTION_QUARANTINED {
+		who = comment.SpamRule
+	}
+	handledAt := time.Unix(comment.HandledAt, 0).Format("02.01.2006 15:04")
+	if who == "" {
+		return fmt.Sprintf("%s, %s", label, handledAt)
+	}
+
+	return fmt.Sprintf("%s: %s, %s", label, escapeMarkdown(who), handledAt)
+}
+
+// Текст оповещения со строкой о действии модератора
+func (bot *Bot) notificationWithStatus(group db.MonitoredGroup, comment db.Comment, maxLength int) string {
+	text := bot.constructNotificationMessage(group, comment, maxLength)
+	if status := commentStatusLine(comment); status != "" {
+		text += "\n\n" + status
+	}
+	return text
+}
+
+// Ключ автора для заглушения и списков: ID в соцсети, а если его нет - имя
+func authorKey(comment db.Comment) string {
+	if comment.AuthorID != "" {
+		return comment.AuthorID
+	}
+	return comment.Author
+}
+
+func (bot *Bot) isAuthorMuted(network string, comment db.Comment) bool {
+	muted, err := bot.db.IsAuthorMuted(network, authorKey(comment))
+	if err != nil {
+		log.Printf("Ошибка проверки заглушенных авторов: %s", err)
+		return false
+	}
+	return muted
+}
+
+// Находит комментарий и его группу по ключу из данных кнопки.
+// При ошибке возвращает текст для всплывающего уведомления
+func (bot *Bot) callbackComment(arg string) (int64, *db.Comment, *db.MonitoredGroup, string) {
+	key, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, nil, nil, "Некорректная кнопка"
+	}
+
+	comment, err := bot.db.GetCommentByKey(key)
+	if err != nil {
+		log.Printf("Ошибка получения комментария %d: %s", key, err)
+		return 0, nil, nil, "Ошибка получения комментария"
+	}
+	if comment == nil {
+		return 0, nil, nil, "Комментарий больше не хранится"
+	}
+
+	group, err := bot.db.GetGroupByInternalID(fmt.Sprintf("%d", comment.GroupID))
+	if err != nil || group == nil {
+		return 0, nil, nil, "Группа комментария не найдена"
+	}
+	bot.attachPostContext(*group, comment)
+
+	return key, comment, group, ""
+}
+
+// Есть ли под сообщением кнопка с данными, начинающимися с prefix
+func hasCallbackButton(msg *telego.Message, prefix string) bool {
+	if msg.ReplyMarkup == nil {
+		return false
+	}
+
+	for _, row := range msg.ReplyMarkup.InlineKeyboard {
+		for _, button := range row {
+			if strings.HasPrefix(button.CallbackData, prefix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Обработка кнопок действий: выполняет действие, запоминает его
+// в состоянии комментария и обновляет оповещение
+func (bot *Bot) handleActionCallback(query *telego.CallbackQuery, arg string) string {
+	action, keyArg, found := strings.Cut(arg, ":")
+	if !found {
+		return "Некорректная кнопка"
+	}
+	key, comment, group, problem := bot.callbackComment(keyArg)
+	if problem != "" {
+		return problem
+	}
+
+	notification := query.Message.Message()
+	if notification == nil {
+		return "Сообщение с оповещением недоступно"
+	}
+
+	moderator := formatUserName(&query.From)
+	var answer string
+
+	if comment.Status == ACTION_QUARANTINED {
+		switch action {
+		case ACTION_SPAM, ACTION_TRUST, ACTION_BLOCK:
+			return bot.handleQuarantineCallback(query, notification, action, key, comment, group)
+		}
+	}
+
+	switch action {
+	case ACTION_DELETE, ACTION_BAN, ACTION_CONFIRM_DELETE, ACTION_CONFIRM_BAN, ACTION_CANCEL:
+		return bot.handleModerationCallback(query, action, key, comment, group)
+	case ACTION_NOT_SPAM, ACTION_NOT_SPAM_ALWAYS:
+		return bot.handleQuarantineCallback(query, notification, action, key, comment, group)
+	case ACTION_REPLY:
+		if !bot.canReply(group.Network) {
+			return "Ответы из Telegram не поддерживаются для этой соцсети, ответьте в самой группе"
+		}
+		return "Ответьте на это оповещение (Ответить в Telegram): текст будет опубликован ответом на комментарий от имени сообщества"
+	case ACTION_HANDLED:
+		answer = "Отмечено как обработанное"
+	case ACTION_SPAM:
+		bot.spamFeedback(*comment, true)
+		answer = "Отмечено как спам"
+	case ACTION_MUTE:
+		err := bot.db.MuteAuthor(&db.MutedAuthor{
+			Network:  group.Network,
+			AuthorID: authorKey(*comment),
+			Author:   comment.Author,
+			MutedBy:  moderator,
+			MutedAt:  time.Now().Unix(),
+		})
+		if err != nil {
+			log.Printf("Ошибка заглушения автора %s: %s", comment.Author, err)
+			return "Не удалось заглушить автора"
+		}
+		answer = "Оповещения о комментариях " + comment.Author + " больше не отправляются"
+	case ACTION_TRUST:
+		if err := bot.setAuthorList(group.Network, *comment, db.AUTHOR_TRUSTED, moderator); err != nil {
+			log.Printf("Ошибка добавления автора %s в доверенные: %s", comment.Author, err)
+			return "Не удалось добавить автора в доверенные"
+		}
+		// Помеченный фильтром комментарий доверенного автора - не спам
+		if comment.SpamRule != "" {
+			bot.spamFeedback(*comment, false)
+		}
+		answer = "Комментарии " + comment.Author + " больше не проверяются спам-фильтром"
+	case ACTION_BLOCK:
+		if err := bot.setAuthorList(group.Network, *comment, db.AUTHOR_BLOCKED, moderator); err != nil {
+			log.Printf("Ошибка добавления автора %s в черный список: %s", comment.Author, err)
+			return "Не удалось добавить автора в черный список"
+		}
+		bot.spamFeedback(*comment, true)
+		answer = "Комментарии " + comment.Author + " теперь всегда считаются спамом"
+	case ACTION_PAUSE:
+		if err := bot.db.PauseGroup(group.ID, 0); err != nil {
+			log.Printf("Ошибка приостановки группы %s: %s", group.GroupName, err)
+			return "Не удалось приостановить группу"
+		}
+		answer = "Мониторинг группы приостановлен до /resume"
+	default:
+		return "Неизвестное действие"
+	}
+
+	bot.setCommentStatus(key, comment, action, moderator)
+	bot.audit(query.From, action, group, comment, "")
+	bot.refreshNotification(notification, key, *group, *comment)
+
+	return answer
+}
+
+// Запоминает действие над комментарием и обновляет comment
+func (bot *Bot) setCommentStatus(key int64, comment *db.Comment, status, moderator string) {
+	comment.Status = status
+	comment.HandledBy = moderator
+	comment.HandledAt = time.Now().Unix()
+	if err := bot.db.SetCommentStatus(key, comment.Status, comment.HandledBy, comment.HandledAt); err != nil {
+		log.Printf("Ошибка сохранения состояния комментария %s: %s", comment.ID, err)
+	}
+
+	// Критичное оповещение закреплено, пока комментарий не обработан
+	bot.unpinWatchAlert(key)
+}
+
+// Перерисовывает оповещение с актуальным состоянием комментария
+func (bot *Bot) refreshNotification(notification *telego.Message, key int64, group db.MonitoredGroup, comment db.Comment) {
+	// Полный текст остается полным, если его уже раскрыли
+	withFullText := hasCallbackButton(notification, CALLBACK_FULL_TEXT)
+	maxLength := bot.notificationTextLimit()
+	if !withFullText && bot.fitsFullNotification(group, comment, notificationLimit(notification)) {
+		maxLength = 0
+	}
+
+	keyboard := bot.notificationKeyboard(key, comment, withFullText)
+	if err := bot.editNotification(bot.ctx, notification, bot.notificationWithStatus(group, comment, maxLength), keyboard); err != nil {
+		log.Printf("Ошибка обновления оповещения: %s", err)
+	}
+}
+
+func (bot *Bot) ListMutedAuthors(message *telego.Message) {
+	authors, err := bot.db.GetMutedAuthors()
+	if err != nil {
+		bot.sendError(message, "Ошибка получения заглушенных авторов: "+err.Error())
+		return
+	}
+
+	if len(authors) == 0 {
+		bot.answerBack(message, "Заглушенных авторов нет", true)
+		return
+	}
+
+	response := "*Заглушенные авторы*:\n\n"
+	for _, author := range authors {
+		response += fmt.Sprintf("- (%s) %s `%s` - %s, %s\n",
+			author.Network, escapeMarkdown(author.Author), author.AuthorID,
+			escapeMarkdown(author.MutedBy), time.Unix(author.MutedAt, 0).Format("02.01.2006 15:04"))
+	}
+
+	bot.answerBack(message, response, true)
+}
+
+func (bot *Bot) UnmuteAuthor(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 3 {
+		bot.sendError(message, "Неверный формат. Используйте: /unmute <сеть> <ID автора>")
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	authorID := strings.Join(parts[2:], " ")
+
+	removed, err := bot.db.UnmuteAuthor(network, authorID)
+	if err != nil {
+		bot.sendError(message, "Ошибка: "+err.Error())
+		return
+	}
+	if !removed {
+		bot.sendError(message, "Этот автор не заглушен")
+		return
+	}
+
+	bot.sendSuccess(message, "Оповещения о комментариях автора снова отправляются")
+}
@@ -0,0 +1,203 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Подписи списков авторов
+var authorListNames = map[string]string{
+	db.AUTHOR_TRUSTED: "доверенные",
+	db.AUTHOR_BLOCKED: "черный список",
+}
+
+// Список (db.AUTHOR_*), в котором состоит автор комментария, или пустая строка
+func (bot *Bot) authorList(network string, comment db.Comment) string {
+	list, err := bot.db.GetAuthorList(network, authorKey(comment))
+	if err != nil {
+		log.Printf("Ошибка проверки списков авторов: %s", err)
+		return ""
+	}
+	return list
+}
+
+// Действие для комментариев авторов из черного списка
+func (bot *Bot) blockedAuthorsAction() string {
+	if _, ok := spamActions[bot.conf.Spam.BlockedAuthorsAction]; ok {
+		return bot.conf.Spam.BlockedAuthorsAction
+	}
+	return SPAM_ACTION_DROP
+}
+
+// Правило, которым помечаются комментарии автора из черного списка
+func (bot *Bot) blockedAuthorRule(comment db.Comment) *SpamRule {
+	name := comment.Author
+	if name == "" {
+		name = authorKey(comment)
+	}
+
+	return &SpamRule{
+		Type:    SPAM_RULE_AUTHOR,
+		Pattern: name,
+		Action:  bot.blockedAuthorsAction(),
+	}
+}
+
+// Вносит автора комментария в список. Автор из другого списка переносится
+func (bot *Bot) setAuthorList(network string, comment db.Comment, list, moderator string) error {
+	return bot.db.SetAuthorList(&db.ListedAuthor{
+		Network:  network,
+		AuthorID: authorKey(comment),
+		Author:   comment.Author,
+		List:     list,
+		AddedBy:  moderator,
+		AddedAt:  time.Now().Unix(),
+	})
+}
+
+// Разбирает "/команда <сеть> <ID автора>"
+func parseAuthorArgs(text string) (string, string, bool) {
+	parts := strings.Fields(text)
+	if len(parts) < 3 {
+		return "", "", false
+	}
+	return strings.ToLower(parts[1]), strings.Join(parts[2:], " "), true
+}
+
+func (bot *Bot) addAuthorToList(message *telego.Message, list, command string) {
+	network, authorID, ok := parseAuthorArgs(message.Text)
+	if !ok {
+		bot.sendError(message, fmt.Sprintf("Неверный формат. Используйте: /%s <сеть> <ID автора>", command))
+		return
+	}
+	if network != "vk" && network != "ok" && network != "tg" {
+		bot.sendError(message, "Неизвестная соцсеть "+network)
+		return
+	}
+
+	previous, err := bot.db.GetAuthorList(network, authorID)
+	if err != nil {
+		bot.sendError(message, "Ошибка: "+err.Error())
+		return
+	}
+	if previous == list {
+		bot.sendError(message, "Автор уже в списке: "+authorListNames[list])
+		return
+	}
+
+	err = bot.db.SetAuthorList(&db.ListedAuthor{
+		Network:  network,
+		AuthorID: authorID,
+		List:     list,
+		AddedBy:  formatUserName(message.From),
+		AddedAt:  time.Now().Unix(),
+	})
+	if err != nil {
+		bot.sendError(message, "Ошибка: "+err.Error())
+		return
+	}
+
+	bot.audit(*message.From, command, nil, nil, network+":"+authorID)
+
+	response := "Автор добавлен в список: " + authorListNames[list]
+	if previous != "" {
+		response += " (убран из списка: " + authorListNames[previous] + ")"
+	}
+	bot.sendSuccess(message, response)
+}
+
+func (bot *Bot) removeAuthorFromList(message *telego.Message, list, command string) {
+	network, authorID, ok := parseAuthorArgs(message.Text)
+	if !ok {
+		bot.sendError(message, fmt.Sprintf("Неверный формат. Используйте: /%s <сеть> <ID автора>", command))
+		return
+	}
+
+	removed, err := bot.db.RemoveAuthorFromList(network, authorID, list)
+	if err != nil {
+		bot.sendError(message, "Ошибка: "+err.Error())
+		return
+	}
+	if !removed {
+		bot.sendError(message, "Автора нет в списке: "+authorListNames[list])
+		return
+	}
+
+	bot.audit(*message.From, command, nil, nil, network+":"+authorID)
+	bot.sendSuccess(message, "Автор убран из списка: "+authorListNames[list])
+}
+
+func (bot *Bot) TrustAuthor(message *telego.Message) {
+	bot.addAuthorToList(message, db.AUTHOR_TRUSTED, "trust")
+}
+
+func (bot *Bot) UntrustAuthor(message *telego.Message) {
+	bot.removeAuthorFromList(message, db.AUTHOR_TRUSTED, "untrust")
+}
+
+func (bot *Bot) BlockAuthor(message *telego.Message) {
+	bot.addAuthorToList(message, db.AUTHOR_BLOCKED, "block")
+}
+
+func (bot *Bot) UnblockAuthor(message *telego.Message) {
+	bot.removeAuthorFromList(message, db.AUTHOR_BLOCKED, "unblock")
+}
+
+func (bot *Bot) ListAuthorLists(message *telego.Message) {
+	authors, err := bot.db.GetListedAuthors()
+	if err != nil {
+		bot.sendError(message, "Ошибка получения списков авторов: "+err.Error())
+		return
+	}
+
+	if len(authors) == 0 {
+		bot.answerBack(message, "Списки авторов пусты", true)
+		return
+	}
+
+	response := ""
+	current := ""
+	for _, author := range authors {
+		if author.List != current {
+			current = author.List
+			if response != "" {
+				response += "\n"
+			}
+			response += fmt.Sprintf("*Авторы: %s*:\n", authorListNames[current])
+		}
+
+		name := author.Author
+		if name == "" {
+			name = "?"
+		}
+		response += fmt.Sprintf("- (%s) %s `%s` - %s, %s\n",
+			author.Network, escapeMarkdown(name), author.AuthorID,
+			escapeMarkdown(author.AddedBy), time.Unix(author.AddedAt, 0).Format("02.01.2006 15:04"))
+	}
+
+	bot.answerBack(message, response, true)
+}
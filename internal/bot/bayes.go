@@ -0,0 +1,405 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+const (
+	BAYES_DEFAULT_THRESHOLD     = 0.9
+	BAYES_DEFAULT_MIN_DOCUMENTS = 20
+	BAYES_MAX_TOKEN_LENGTH      = 30
+
+	// Начало описания срабатывания классификатора (см. describeSpamRule)
+	BAYES_RULE_PREFIX = "классификатор"
+)
+
+// Окончания, которые отбрасываются у русских слов, чтобы формы одного
+// слова давали один токен. От длинных к коротким
+var russianEndings = []string{
+	"иями", "ями", "ами", "ого", "его", "ому", "ему", "ыми", "ими", "ией",
+	"ов", "ев", "ей", "ой", "ый", "ий", "ая", "яя", "ое", "ее", "ые", "ие",
+	"ом", "ем", "ам", "ям", "ах", "ях", "ую", "юю", "ть", "ся",
+	"а", "я", "о", "е", "ы", "и", "у", "ю", "ь", "й",
+}
+
+// Отбрасывает окончание, оставляя основу не короче трех букв
+func stemRussian(word string) string {
+	for _, ending := range russianEndings {
+		if strings.HasSuffix(word, ending) && utf8.RuneCountInString(word)-utf8.RuneCountInString(ending) >= 3 {
+			return strings.TrimSuffix(word, ending)
+		}
+	}
+	return word
+}
+
+func isCyrillic(r rune) bool {
+	return unicode.Is(unicode.Cyrillic, r)
+}
+
+// Разбивает текст на уникальные токены для классификатора: слова в нижнем
+// регистре без окончаний. Латиница внутри кириллических слов заменяется
+// похожей кириллицей, числа сводятся к одному токену
+func bayesTokens(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ReplaceAll(word, "ё", "е")
+
+		if strings.IndexFunc(word, isCyrillic) != -1 {
+			word = strings.Map(func(r rune) rune {
+				if folded, ok := homoglyphs[r]; ok {
+					return folded
+				}
+				return r
+			}, word)
+		}
+
+		switch {
+		case strings.IndexFunc(word, func(r rune) bool { return !unicode.IsDigit(r) }) == -1:
+			word = "#число"
+		case utf8.RuneCountInString(word) < 2 || utf8.RuneCountInString(word) > BAYES_MAX_TOKEN_LENGTH:
+			continue
+		case strings.IndexFunc(word, isCyrillic) != -1:
+			word = stemRussian(word)
+		}
+
+		if !seen[word] {
+			seen[word] = true
+			tokens = append(tokens, word)
+		}
+	}
+
+	return tokens
+}
+
+func (bot *Bot) bayesThreshold() float64 {
+	if t := bot.conf.Spam.Bayes.Threshold; t > 0 && t <= 1 {
+		return t
+	}
+	return BAYES_DEFAULT_THRESHOLD
+}
+
+func (bot *Bot) bayesMinDocuments() int {
+	if n := bot.conf.Spam.Bayes.MinDocuments; n > 0 {
+		return n
+	}
+	return BAYES_DEFAULT_MIN_DOCUMENTS
+}
+
+func (bot *Bot) bayesAction() string {
+	if _, ok := spamActions[bot.conf.Spam.Bayes.Action]; ok {
+		return bot.conf.Spam.Bayes.Action
+	}
+	return SPAM_ACTION_QUARANTINE
+}
+
+// Число обучающих примеров классификатора. Меняется только при обучении,
+// поэтому запрашивается заново лишь после trainSpam, а не для каждого комментария
+type bayesDocsCache struct {
+	mu       sync.Mutex
+	valid    bool
+	spamDocs int
+	hamDocs  int
+}
+
+func (bot *Bot) bayesDocs() (spamDocs, hamDocs int, err error) {
+	bot.bayesCache.mu.Lock()
+	defer bot.bayesCache.mu.Unlock()
+
+	if !bot.bayesCache.valid {
+		spamDocs, hamDocs, _, err = bot.db.GetBayesTotals()
+		if err != nil {
+			return 0, 0, err
+		}
+		bot.bayesCache.spamDocs, bot.bayesCache.hamDocs = spamDocs, hamDocs
+		bot.bayesCache.valid = true
+	}
+
+	return bot.bayesCache.spamDocs, bot.bayesCache.hamDocs, nil
+}
+
+// Включен ли классификатор и достаточно ли он обучен
+func (bot *Bot) bayesActive() bool {
+	if !bot.conf.Spam.Bayes.Enabled {
+		return false
+	}
+
+	spamDocs, hamDocs, err := bot.bayesDocs()
+	if err != nil {
+		log.Printf("Ошибка получения статистики классификатора: %s", err)
+		return false
+	}
+
+	return spamDocs >= bot.bayesMinDocuments() && hamDocs >= bot.bayesMinDocuments()
+}
+
+// Вероятность того, что текст - спам, по наивному Байесу со сглаживанием Лапласа.
+// Слова, которых классификатор не видел, не учитываются
+func (bot *Bot) bayesScore(text string) (float64, error) {
+	spamDocs, hamDocs, err := bot.bayesDocs()
+	if err != nil {
+		return 0, err
+	}
+	if spamDocs == 0 || hamDocs == 0 {
+		return 0, nil
+	}
+
+	counts, err := bot.db.GetBayesCounts(bayesTokens(text))
+	if err != nil {
+		return 0, err
+	}
+
+	total := float64(spamDocs + hamDocs)
+	logSpam := math.Log(float64(spamDocs) / total)
+	logHam := math.Log(float64(hamDocs) / total)
+	for _, c := range counts {
+		logSpam += math.Log(float64(c.Spam+1) / float64(spamDocs+2))
+		logHam += math.Log(float64(c.Ham+1) / float64(hamDocs+2))
+	}
+
+	return 1 / (1 + math.Exp(logHam-logSpam)), nil
+}
+
+// Оценка спама с учетом ключевых слов: каждое найденное ключевое слово
+// добавляет Bayes.KeywordWeight
+func (bot *Bot) combinedSpamScore(text string) (float64, error) {
+	score, err := bot.bayesScore(text)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, keyword := range bot.conf.Spam.Keywords {
+		if spamRuleMatches(SpamRule{Type: SPAM_RULE_SUBSTRING, Pattern: keyword}, text) {
+			score += bot.conf.Spam.Bayes.KeywordWeight
+		}
+	}
+
+	return math.Min(score, 1), nil
+}
+
+// Срабатывание классификатора в виде правила или nil, если оценка ниже порога
+func (bot *Bot) bayesRule(text string) *SpamRule {
+	score, err := bot.combinedSpamScore(text)
+	if err != nil {
+		log.Printf("Ошибка оценки комментария классификатором: %s", err)
+		return nil
+	}
+	if score < bot.bayesThreshold() {
+		return nil
+	}
+
+	return &SpamRule{
+		Type:    SPAM_RULE_BAYES,
+		Pattern: fmt.Sprintf("%.0f%%", score*100),
+		Action:  bot.bayesAction(),
+	}
+}
+
+// Обучает классификатор на комментарии
+func (bot *Bot) trainSpam(comment db.Comment, spam bool) {
+	tokens := bayesTokens(comment.Text)
+	if len(tokens) == 0 {
+		return
+	}
+
+	if err := bot.db.TrainBayes(comment.ID, tokens, spam); err != nil {
+		log.Printf("Ошибка обучения классификатора на комментарии %s: %s", comment.ID, err)
+	}
+
+	bot.bayesCache.mu.Lock()
+	bot.bayesCache.valid = false
+	bot.bayesCache.mu.Unlock()
+}
+
+// Запоминает решение модератора для /spamstats и обучает на нем классификатор
+func (bot *Bot) spamFeedback(comment db.Comment, spam bool) {
+	err := bot.db.AddSpamFeedback(&db.SpamFeedback{
+		CommentID: comment.ID,
+		SpamRule:  comment.SpamRule,
+		IsSpam:    spam,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения решения о спаме: %s", err)
+	}
+
+	bot.trainSpam(comment, spam)
+}
+
+// Спам ли комментарий по решению модератора. ok = false, если решения не было.
+// Комментарий без действий модератора считается не спамом, только если
+// оповещение о нем было отправлено: отложенные в кэш не учитываются
+func historicSpamVerdict(comment db.Comment) (spam bool, ok bool) {
+	if comment.IsPending {
+		return false, false
+	}
+
+	switch comment.Status {
+	case ACTION_SPAM, ACTION_DELETED, ACTION_BANNED, ACTION_BLOCK:
+		return true, true
+	case ACTION_QUARANTINED, ACTION_FLOOD:
+		return false, false
+	}
+
+	// Помеченный правилом, но не проверенный модератором комментарий не учитывается
+	if comment.SpamRule != "" && comment.Status == "" {
+		return false, false
+	}
+
+	return false, true
+}
+
+// Обучает классификатор на сохраненных комментариях. Уже учтенные
+// комментарии не учитываются повторно
+func (bot *Bot) trainFromHistory() (spam int, ham int, err error) {
+	comments, err := bot.db.GetAllComments()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, comment := range comments {
+		isSpam, ok := historicSpamVerdict(comment)
+		if !ok {
+			continue
+		}
+
+		bot.trainSpam(comment, isSpam)
+		if isSpam {
+			spam++
+		} else {
+			ham++
+		}
+	}
+
+	return spam, ham, nil
+}
+
+// При первом запуске с классификатором обучает его на истории в фоне
+func (bot *Bot) bootstrapBayes() {
+	if !bot.conf.Spam.Bayes.Enabled {
+		return
+	}
+
+	spamDocs, hamDocs, _, err := bot.db.GetBayesTotals()
+	if err != nil || spamDocs+hamDocs > 0 {
+		return
+	}
+
+	bot.wg.Add(1)
+	go func() {
+		defer bot.wg.Done()
+
+		spam, ham, err := bot.trainFromHistory()
+		if err != nil {
+			log.Printf("Ошибка обучения классификатора на истории: %s", err)
+			return
+		}
+		log.Printf("Классификатор обучен на истории: %d спам, %d не спам", spam, ham)
+	}()
+}
+
+func (bot *Bot) SpamTrain(message *telego.Message) {
+	spam, ham, err := bot.trainFromHistory()
+	if err != nil {
+		bot.sendError(message, "Ошибка обучения классификатора: "+err.Error())
+		return
+	}
+
+	bot.sendSuccess(message, fmt.Sprintf("Классификатор обучен на сохраненных комментариях: %d спам, %d не спам", spam, ham))
+}
+
+// Точность по решениям модераторов: доля подтвержденного спама среди помеченного
+func formatPrecision(confirmed, rejected int) string {
+	if confirmed+rejected == 0 {
+		return "нет данных"
+	}
+	return fmt.Sprintf("%.0f%% (%d из %d)", float64(confirmed)*100/float64(confirmed+rejected), confirmed, confirmed+rejected)
+}
+
+func (bot *Bot) SpamStats(message *telego.Message) {
+	spamDocs, hamDocs, tokens, err := bot.db.GetBayesTotals()
+	if err != nil {
+		bot.sendError(message, "Ошибка получения статистики классификатора: "+err.Error())
+		return
+	}
+
+	feedback, err := bot.db.GetSpamFeedback()
+	if err != nil {
+		bot.sendError(message, "Ошибка получения решений модераторов: "+err.Error())
+		return
+	}
+
+	var bayesConfirmed, bayesRejected, rulesConfirmed, rulesRejected, missed int
+	for _, f := range feedback {
+		switch {
+		case f.SpamRule == "":
+			if f.IsSpam {
+				missed++
+			}
+		case strings.HasPrefix(f.SpamRule, BAYES_RULE_PREFIX):
+			if f.IsSpam {
+				bayesConfirmed++
+			} else {
+				bayesRejected++
+			}
+		default:
+			if f.IsSpam {
+				rulesConfirmed++
+			} else {
+				rulesRejected++
+			}
+		}
+	}
+
+	state := "выключен"
+	switch {
+	case bot.conf.Spam.Bayes.Enabled && bot.bayesActive():
+		state = "работает"
+	case bot.conf.Spam.Bayes.Enabled:
+		state = fmt.Sprintf("обучается (нужно по %d примеров спама и не спама)", bot.bayesMinDocuments())
+	}
+
+	response := "*Спам-фильтр*\n\n"
+	response += fmt.Sprintf("*Классификатор*: %s\n", state)
+	response += fmt.Sprintf("Примеров: спам %d, не спам %d, слов %d\n", spamDocs, hamDocs, tokens)
+	response += fmt.Sprintf("Порог: %.2f, действие: %s\n\n", bot.bayesThreshold(), spamActions[bot.bayesAction()])
+	response += "*Точность по решениям модераторов*\n"
+	response += fmt.Sprintf("Классификатор: %s\n", formatPrecision(bayesConfirmed, bayesRejected))
+	response += fmt.Sprintf("Правила и ключевые слова: %s\n", formatPrecision(rulesConfirmed, rulesRejected))
+	response += fmt.Sprintf("Пропущенный спам: %d", missed)
+
+	bot.answerBack(message, response, true)
+}
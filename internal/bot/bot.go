@@ -27,7 +27,9 @@ import (
 	"context"
 	"log"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mymmrac/telego"
 )
@@ -44,6 +46,17 @@ type Bot struct {
 	commands []Command
 	social   *social.SocialManager
 	db       *db.DB
+
+	// Корневой контекст, отменяется при завершении работы бота
+	ctx context.Context
+	// Учет запущенных обработчиков для корректного завершения
+	wg sync.WaitGroup
+	// Не дает создать два топика для одной группы
+	topicsMu sync.Mutex
+	// Число обучающих примеров классификатора
+	bayesCache bayesDocsCache
+	// Когда не удалось создать топик в чате: ID чата -> время ошибки (под topicsMu)
+	topicFailures map[int64]time.Time
 }
 
 func NewBot(config *Config) (*Bot, error) {
@@ -53,15 +66,19 @@ func NewBot(config *Config) (*Bot, error) {
 	}
 
 	// Инициализируем менеджер соцсетей
+	vkTokens := config.Social.VK.TokenPool()
+	okTokens := config.Social.OK.TokenPool()
 	socialManager := &social.SocialManager{
-		VKClient: vk.NewClient(config.Social.VK.Token),
+		VKClient: vk.NewClient(vkTokens, config.Social.VK.CommunityTokens),
 		OKClient: ok.NewClient(
-			config.Social.OK.Token,
+			okTokens,
 			config.Social.OK.PublicKey,
 			config.Social.OK.SecretKey,
 			config.Social.OK.AppID,
 		),
 		TGClient: tg.NewClient(api),
+		VKTokens: vkTokens,
+		OKTokens: okTokens,
 	}
 
 	dbase, err := config.OpenDB()
@@ -74,9 +91,15 @@ func NewBot(config *Config) (*Bot, error) {
 		conf:   config,
 		social: socialManager,
 		db:     dbase,
+		ctx:    context.Background(),
 	}, nil
 }
 
+// Закрывает базу данных. Вызывать после завершения Start
+func (bot *Bot) Close() error {
+	return bot.db.Close()
+}
+
 func (bot *Bot) Init() {
 	bot.NewCommand(Command{
 		Name:        "help",
@@ -99,6 +122,20 @@ func (bot *Bot) Init() {
 		Call:        bot.TogglePublicity,
 	})
 
+	bot.NewCommand(Command{
+		Name:        "togglethreads",
+		Description: "Включить или выключить ветки: оповещения о комментариях к одному посту ответами на первое",
+		Group:       "Телеграм",
+		Call:        bot.ToggleThreadByPost,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "toggleautotopics",
+		Description: "Включить или выключить отдельный топик для каждой группы в мониторинговом чате-форуме",
+		Group:       "Телеграм",
+		Call:        bot.ToggleAutoTopics,
+	})
+
 	bot.NewCommand(Command{
 		Name:        "adduser",
 		Description: "Добавить доступ к боту определенному пользователю по ID (напишите боту @userinfobot для получения своего ID)",
@@ -115,6 +152,22 @@ func (bot *Bot) Init() {
 		Call:        bot.RemoveUser,
 	})
 
+	bot.NewCommand(Command{
+		Name:        "addmoderator",
+		Description: "Разрешить пользователю удалять комментарии и блокировать авторов",
+		Example:     "/addmoderator 5293210034",
+		Group:       "Телеграм",
+		Call:        bot.AddModerator,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "rmmoderator",
+		Description: "Запретить пользователю удалять комментарии и блокировать авторов",
+		Example:     "/rmmoderator 5293210034",
+		Group:       "Телеграм",
+		Call:        bot.RemoveModerator,
+	})
+
 	bot.NewCommand(Command{
 		Name:        "conf",
 		Description: "Написать текущую конфигурацию",
@@ -145,6 +198,121 @@ func (bot *Bot) Init() {
 		Call:        bot.ListGroups,
 	})
 
+	bot.NewCommand(Command{
+		Name:        "health",
+		Description: "Показать группы с ошибками проверки и приостановленные группы",
+		Group:       "Мониторинг",
+		Call:        bot.Health,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "pause",
+		Description: "Приостановить мониторинг группы или всей соцсети (бессрочно или на время: 30m, 2h, 1d)",
+		Example:     "/pause vk 123 2h",
+		Group:       "Мониторинг",
+		Call:        bot.PauseGroup,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "resume",
+		Description: "Возобновить мониторинг приостановленной группы или всей соцсети (all - получить и комментарии за время паузы)",
+		Example:     "/resume network vk",
+		Group:       "Мониторинг",
+		Call:        bot.ResumeGroup,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "tokens",
+		Description: "Показать состояние токенов API соцсетей",
+		Group:       "Мониторинг",
+		Call:        bot.ListTokens,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "renamegroup",
+		Description: "Переименовать группу (и ее топик)",
+		Example:     "/renamegroup vk 123 Новости Севера",
+		Group:       "Мониторинг",
+		Call:        bot.RenameGroup,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "digest",
+		Description: "Собирать комментарии в дайджест вместо отдельных оповещений: для всех групп или для одной",
+		Example:     "/digest vk 123 on",
+		Group:       "Мониторинг",
+		Call:        bot.Digest,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "senddigest",
+		Description: "Отправить дайджест прямо сейчас",
+		Group:       "Мониторинг",
+		Call:        bot.SendDigestNow,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "setdigestschedule",
+		Description: "Отправлять дайджест каждые N минут или в заданное время",
+		Example:     "/setdigestschedule 09:00 18:00",
+		Group:       "Мониторинг",
+		Call:        bot.SetDigestSchedule,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "route",
+		Description: "Направить оповещения группы или групп с меткой в отдельный чат и топик (проверяется тестовым сообщением)",
+		Example:     "/route vk 123 -1001234567890 15",
+		Group:       "Мониторинг",
+		Call:        bot.Route,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "unroute",
+		Description: "Вернуть оповещения группы или метки в чат по умолчанию",
+		Example:     "/unroute tag north",
+		Group:       "Мониторинг",
+		Call:        bot.Unroute,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "tag",
+		Description: "Назначить группе метку (например, регион) для маршрутизации. Без метки - убрать",
+		Example:     "/tag vk 123 north",
+		Group:       "Мониторинг",
+		Call:        bot.SetGroupTag,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "listroutes",
+		Description: "Показать маршруты оповещений",
+		Group:       "Мониторинг",
+		Call:        bot.ListRoutes,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "muted",
+		Description: "Показать заглушенных авторов (кнопка \"Заглушить автора\" под оповещением)",
+		Group:       "Мониторинг",
+		Call:        bot.ListMutedAuthors,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "unmute",
+		Description: "Снова оповещать о комментариях автора",
+		Example:     "/unmute vk 12345",
+		Group:       "Мониторинг",
+		Call:        bot.UnmuteAuthor,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "audit",
+		Description: "Показать журнал действий модераторов (по умолчанию 20 последних)",
+		Example:     "/audit 50",
+		Group:       "Мониторинг",
+		Call:        bot.AuditLog,
+	})
+
 	bot.NewCommand(Command{
 		Name:        "chatid",
 		Description: "Показать ID канала",
@@ -211,18 +379,43 @@ func (bot *Bot) Init() {
 
 	bot.NewCommand(Command{
 		Name:        "setnotificationtype",
-		Description: "Установить вид текста оповещения",
+		Description: "Установить шаблон текста оповещения",
+		Example:     "/setnotificationtype minimalistic",
 		Group:       "Общее",
 		Call:        bot.SetNotificationType,
 	})
 
 	bot.NewCommand(Command{
 		Name:        "listnotificationtypes",
-		Description: "Перечислить доступные виды текста оповещения",
+		Description: "Перечислить доступные шаблоны текста оповещения",
 		Group:       "Общее",
 		Call:        bot.ListNotificationTypes,
 	})
 
+	bot.NewCommand(Command{
+		Name:        "settemplate",
+		Description: "Создать или изменить свой шаблон оповещения (Go text/template) и сделать его текущим",
+		Example:     "/settemplate short {{.Group}}: {{.Text}} [пост]({{.PostURL}})",
+		Group:       "Общее",
+		Call:        bot.SetTemplate,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "previewtemplate",
+		Description: "Показать шаблон оповещения на примере комментария",
+		Example:     "/previewtemplate short",
+		Group:       "Общее",
+		Call:        bot.PreviewTemplate,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "rmtemplate",
+		Description: "Удалить свой шаблон оповещения",
+		Example:     "/rmtemplate short",
+		Group:       "Общее",
+		Call:        bot.RemoveTemplate,
+	})
+
 	bot.NewCommand(Command{
 		Name:        "addspamkeyword",
 		Description: "Добавить ключевое слово для фильтрации спама",
@@ -252,23 +445,121 @@ func (bot *Bot) Init() {
 		Group:       "Спам-фильтр",
 		Call:        bot.ToggleFilterSpam,
 	})
+
+	bot.NewCommand(Command{
+		Name:        "spamrule",
+		Description: "Спам-правила: добавить (add), удалить (rm), список (list), проверить текст (test)",
+		Example:     "/spamrule add word drop vk:123 в лс",
+		Group:       "Спам-фильтр",
+		Call:        bot.SpamRuleCommand,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "setquarantine",
+		Description: "Чат (и топик) для комментариев, задержанных спам-фильтром, или off",
+		Example:     "/setquarantine -1001234567890 15",
+		Group:       "Спам-фильтр",
+		Call:        bot.SetQuarantine,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "quarantine",
+		Description: "Показать последние задержанные спам-фильтром комментарии",
+		Example:     "/quarantine 20",
+		Group:       "Спам-фильтр",
+		Call:        bot.ListQuarantine,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "trust",
+		Description: "Не проверять комментарии автора спам-фильтром",
+		Example:     "/trust vk 12345",
+		Group:       "Спам-фильтр",
+		Call:        bot.TrustAuthor,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "untrust",
+		Description: "Убрать автора из доверенных",
+		Example:     "/untrust vk 12345",
+		Group:       "Спам-фильтр",
+		Call:        bot.UntrustAuthor,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "block",
+		Description: "Всегда считать комментарии автора спамом",
+		Example:     "/block ok 5678901234",
+		Group:       "Спам-фильтр",
+		Call:        bot.BlockAuthor,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "unblock",
+		Description: "Убрать автора из черного списка",
+		Example:     "/unblock ok 5678901234",
+		Group:       "Спам-фильтр",
+		Call:        bot.UnblockAuthor,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "authorlists",
+		Description: "Показать доверенных авторов и черный список",
+		Group:       "Спам-фильтр",
+		Call:        bot.ListAuthorLists,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "watch",
+		Description: "Отслеживаемые темы: добавить (add), удалить (rm), упоминания (mention), чат критичных (alerts), список (list)",
+		Example:     "/watch add word critical all суд",
+		Group:       "Мониторинг",
+		Call:        bot.WatchCommand,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "sentiment",
+		Description: "Тональность комментариев: проверить текст (test), маршрут (route), пропуск коротких положительных (ignore), словарь (word, toxic)",
+		Example:     "/sentiment route negative -1001234567890 15",
+		Group:       "Мониторинг",
+		Call:        bot.SentimentCommand,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "spamstats",
+		Description: "Статистика спам-фильтра: обучение классификатора и точность по решениям модераторов",
+		Group:       "Спам-фильтр",
+		Call:        bot.SpamStats,
+	})
+
+	bot.NewCommand(Command{
+		Name:        "spamtrain",
+		Description: "Обучить классификатор спама на сохраненных комментариях",
+		Group:       "Спам-фильтр",
+		Call:        bot.SpamTrain,
+	})
 }
 
-func (bot *Bot) Start() error {
+// Запускает бота и блокируется до отмены ctx. Перед возвратом дожидается
+// завершения текущей проверки групп и обработчиков сообщений
+func (bot *Bot) Start(ctx context.Context) error {
+	bot.ctx = ctx
 	bot.Init()
 
 	log.Printf("Бот авторизован как %s", bot.api.Username())
 
-	bot.StartMonitoring(bot.conf.CheckIntervalMinutes)
+	bot.StartMonitoring(ctx, bot.conf.CheckIntervalMinutes)
+	bot.StartDigests(ctx)
+	bot.bootstrapBayes()
 
 	retryDelay := 5 * time.Second
 
 	var lastUpdateID int = 0 // Будем хранить ID последнего обработанного обновления
 
-	for {
+	for ctx.Err() == nil {
 		// Получаем обновления через long polling
 		updates, err := bot.api.UpdatesViaLongPolling(
-			context.Background(),
+			ctx,
 			&telego.GetUpdatesParams{
 				Timeout: 60,
 				Offset:  lastUpdateID + 1,
@@ -276,7 +567,9 @@ func (bot *Bot) Start() error {
 		)
 		if err != nil {
 			log.Printf("Ошибка получения обновлений: %v. Переподключение через %v...", err, retryDelay)
-			time.Sleep(retryDelay)
+			if !sleepContext(ctx, retryDelay) {
+				break
+			}
 			if retryDelay < 300*time.Second {
 				retryDelay *= 2
 			}
@@ -292,57 +585,121 @@ func (bot *Bot) Start() error {
 				lastUpdateID = update.UpdateID
 			}
 
+			if update.CallbackQuery != nil {
+				bot.wg.Add(1)
+				go func(query *telego.CallbackQuery) {
+					defer bot.wg.Done()
+					bot.handleCallbackQuery(query)
+				}(update.CallbackQuery)
+				continue
+			}
+
 			if update.Message == nil {
 				continue
 			}
 
+			bot.wg.Add(1)
 			go func(message *telego.Message) {
-				// Обработка комментариев в Telegram группах
-				if bot.isMonitoredTelegramGroup(message.Chat.ID) {
-					bot.handleTelegramComment(message)
-					return
-				}
-
-				// Команда ли это
-				if !strings.HasPrefix(message.Text, "/") {
-					return // Пропускаем
-				}
-
-				// Проверка доступа
-				if !bot.conf.Telegram.Public {
-					var allowed bool = false
-					for _, allowedID := range bot.conf.Telegram.AllowedUserIDs {
-						if message.From.ID == allowedID {
-							allowed = true
-							break
-						}
-					}
-
-					if !allowed {
-						bot.answerBack(message, "Вам не разрешено пользоваться этим ботом!", true)
-						if bot.conf.Debug {
-							log.Printf("Не допустили к общению пользователя %v", message.From.ID)
-						}
-						return
-					}
-				}
-
-				log.Printf("[%s] %s", message.From.Username, message.Text)
-
-				// Обработка команд
-				message.Text = strings.TrimSpace(message.Text)
-				for _, command := range bot.commands {
-					if strings.HasPrefix(strings.ToLower(message.Text), "/"+command.Name) {
-						go command.Call(message)
-						return
-					}
-				}
-
-				// Неверная команда
-				bot.sendCommandSuggestions(message, strings.ToLower(message.Text))
+				defer bot.wg.Done()
+				bot.handleMessage(message)
 			}(update.Message)
 		}
 
-		log.Println("Соединение с Telegram потеряно. Переподключение...")
+		if ctx.Err() == nil {
+			log.Println("Соединение с Telegram потеряно. Переподключение...")
+		}
+	}
+
+	log.Println("Завершение работы: ожидаем окончания текущих операций...")
+	bot.wg.Wait()
+	log.Println("Все операции завершены")
+
+	return nil
+}
+
+func (bot *Bot) handleMessage(message *telego.Message) {
+	// Обработка комментариев в Telegram группах
+	if bot.isMonitoredTelegramGroup(message.Chat.ID) {
+		bot.handleTelegramComment(message)
+		return
+	}
+
+	// Ответ модератора на оповещение
+	if bot.handleModeratorReply(message) {
+		return
+	}
+
+	// Команда ли это
+	if !strings.HasPrefix(message.Text, "/") {
+		return // Пропускаем
+	}
+
+	// Проверка доступа
+	if !bot.isAllowedUser(message.From.ID) {
+		bot.answerBack(message, "Вам не разрешено пользоваться этим ботом!", true)
+		if bot.conf.Debug {
+			log.Printf("Не допустили к общению пользователя %v", message.From.ID)
+		}
+		return
+	}
+
+	log.Printf("[%s] %s", message.From.Username, message.Text)
+
+	// Обработка команд
+	message.Text = strings.TrimSpace(message.Text)
+	for _, command := range bot.commands {
+		if strings.HasPrefix(strings.ToLower(message.Text), "/"+command.Name) {
+			command.Call(message)
+			return
+		}
+	}
+
+	// Неверная команда
+	bot.sendCommandSuggestions(message, strings.ToLower(message.Text))
+}
+
+// Может ли пользователь управлять ботом
+func (bot *Bot) isAllowedUser(userID int64) bool {
+	if bot.conf.Telegram.Public {
+		return true
+	}
+
+	for _, allowedID := range bot.conf.Telegram.AllowedUserIDs {
+		if userID == allowedID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Обработка нажатий на инлайн-кнопки. Обработчик возвращает текст
+// всплывающего уведомления (пусто - без уведомления)
+func (bot *Bot) handleCallbackQuery(query *telego.CallbackQuery) {
+	var answer string
+
+	switch {
+	case !bot.isAllowedUser(query.From.ID):
+		answer = "Вам не разрешено пользоваться этим ботом!"
+	case query.Message == nil:
+		answer = "Сообщение недоступно"
+	case strings.HasPrefix(query.Data, CALLBACK_ACTION):
+		answer = bot.handleActionCallback(query, strings.TrimPrefix(query.Data, CALLBACK_ACTION))
+	case strings.HasPrefix(query.Data, CALLBACK_FLOOD):
+		answer = bot.handleFloodCallback(query, strings.TrimPrefix(query.Data, CALLBACK_FLOOD))
+	case strings.HasPrefix(query.Data, CALLBACK_FULL_TEXT):
+		answer = bot.handleFullTextCallback(query, strings.TrimPrefix(query.Data, CALLBACK_FULL_TEXT))
+	default:
+		answer = "Неизвестная кнопка"
+	}
+
+	err := bot.api.AnswerCallbackQuery(bot.ctx, &telego.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            answer,
+		// Длинные подсказки не помещаются во всплывающее уведомление
+		ShowAlert: utf8.RuneCountInString(answer) > 64,
+	})
+	if err != nil {
+		log.Printf("Ошибка ответа на нажатие кнопки: %s", err)
 	}
 }
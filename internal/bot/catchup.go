@@ -0,0 +1,291 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Результат наверстывания одной группы
+type catchUpResult struct {
+	Group     db.MonitoredGroup
+	Comments  []db.Comment
+	CheckedAt int64 // Время начала проверки группы
+}
+
+// Проверяет группы, не проверявшиеся дольше интервала мониторинга (например,
+// после простоя бота). Группы проверяются начиная с самой давно проверенной,
+// с более глубоким просмотром постов. Если комментариев набралось больше
+// порога, вместо отдельных оповещений отправляется сводка
+func (bot *Bot) catchUp(ctx context.Context, interval time.Duration) {
+	if !bot.conf.CatchUp.Enabled {
+		return
+	}
+
+	bot.resumeExpiredPauses()
+
+	groups, err := bot.db.GetGroups()
+	if err != nil {
+		log.Printf("Ошибка получения групп для наверстывания: %v", err)
+		return
+	}
+
+	now := time.Now()
+	var stale []db.MonitoredGroup
+	for _, group := range groups {
+		if group.Network == "tg" || bot.isGroupPaused(group) {
+			continue
+		}
+		if now.Sub(time.Unix(group.LastCheck, 0)) > interval {
+			stale = append(stale, group)
+		}
+	}
+
+	if len(stale) == 0 {
+		return
+	}
+
+	// Дольше всех не проверенные - первыми
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].LastCheck < stale[j].LastCheck
+	})
+	downtime := now.Sub(time.Unix(stale[0].LastCheck, 0))
+
+	log.Printf("Наверстываем %d групп после простоя %s...", len(stale), formatDuration(downtime))
+
+	postsCount := max(bot.conf.CatchUp.PostsCount, social.DefaultPostsCount)
+
+	var results []catchUpResult
+	// Проверенные группы: ID -> время начала проверки. Время проверки
+	// становится last_check, только если найденное отправлено или в кэше
+	checked := make(map[int64]int64)
+	total := 0
+	for _, group := range stale {
+		if !sleepContext(ctx, time.Second*5) {
+			break
+		}
+
+		// Комментарии, написанные во время проверки, найдет следующая
+		checkedAt := time.Now().Unix()
+		comments, err := bot.checkGroupComments(ctx, group, postsCount)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Ошибка наверстывания группы %s (%s): %v", group.GroupName, group.Network, err)
+			if !errors.Is(err, social.ErrRateLimited) {
+				bot.recordGroupFailure(group, err)
+			}
+			continue
+		}
+
+		if err := bot.db.RecordGroupSuccess(group.ID, time.Now().Unix()); err != nil {
+			log.Printf("Ошибка обновления состояния группы %s: %s", group.GroupName, err)
+		}
+
+		checked[group.ID] = checkedAt
+		if len(comments) > 0 {
+			results = append(results, catchUpResult{Group: group, Comments: comments, CheckedAt: checkedAt})
+			total += len(comments)
+		}
+	}
+
+	// Работа прервана: сохраняем найденное в кэш, чтобы не потерять
+	if ctx.Err() != nil {
+		for _, result := range results {
+			if err := bot.cacheComments(result.Group, result.Comments); err != nil {
+				log.Printf("Не удалось сохранить комментарии %s в кэш: %s", result.Group.GroupName, err)
+				continue
+			}
+			bot.db.UpdateLastCheck(result.Group.ID, result.CheckedAt)
+		}
+		return
+	}
+
+	// Группы, комментарии которых не удалось ни отправить, ни сохранить в кэш.
+	// notifyNewComments при прерывании сам сохраняет неотправленное в кэш
+	undelivered := make(map[int64]bool)
+
+	log.Printf("Наверстано %d комментариев в %d группах", total, len(results))
+
+	if total > bot.conf.CatchUp.SummaryThreshold && bot.isNotificationAllowed() {
+		// Сначала комментарии проходят обычную обработку и копятся для
+		// дайджеста, срочные отправляются сразу. Сводка лишь описывает их
+		for _, result := range results {
+			bot.processComments(ctx, result.Group, result.Comments, true)
+		}
+
+		// Каждому чату - сводка по его группам. При прерывании сводка не
+		// нужна: комментарии уже в дайджесте или в кэше
+		var targets []notificationTarget
+		byTarget := make(map[notificationTarget][]catchUpResult)
+		for _, result := range results {
+			if err := bot.ensureGroupTopic(ctx, &result.Group); err != nil {
+				log.Printf("Топик группы %s: %s. Отправляем в общий раздел", result.Group.GroupName, err)
+			}
+
+			target := bot.groupTarget(result.Group)
+			if _, ok := byTarget[target]; !ok {
+				targets = append(targets, target)
+			}
+			byTarget[target] = append(byTarget[target], result)
+		}
+
+		for _, target := range targets {
+			if ctx.Err() != nil {
+				break
+			}
+			targetResults := byTarget[target]
+			targetTotal := 0
+			for _, result := range targetResults {
+				targetTotal += len(result.Comments)
+			}
+
+			params := &telego.SendMessageParams{
+				ChatID:          telego.ChatID{ID: target.ChatID},
+				MessageThreadID: target.ThreadID,
+			}
+			summary := constructCatchUpSummary(targetResults, targetTotal, downtime) + bot.catchUpDigestHint()
+			if _, err := bot.sendMarkup(ctx, params, summary); err != nil {
+				log.Printf("Ошибка отправки сводки наверстывания в %s: %s", target, err)
+				for _, result := range targetResults {
+					undelivered[result.Group.ID] = true
+					bot.forgetDeletedTopic(&result.Group, target, err)
+				}
+			}
+		}
+	} else {
+		for _, result := range results {
+			if bot.isNotificationAllowed() {
+				bot.notifyNewComments(ctx, result.Group, result.Comments)
+				continue
+			}
+
+			urgent, rest := bot.splitUrgentComments(result.Group, result.Comments)
+			if len(urgent) > 0 {
+				bot.notifyNewComments(ctx, result.Group, urgent)
+			}
+			if err := bot.cacheComments(result.Group, rest); err != nil {
+				log.Printf("Ошибка добавления комментариев %s в кэш: %s", result.Group.GroupName, err)
+				undelivered[result.Group.ID] = true
+				continue
+			}
+		}
+	}
+
+	// Не проверенные и не доставленные группы будут проверены снова
+	for groupID, checkedAt := range checked {
+		if undelivered[groupID] {
+			continue
+		}
+		if err := bot.db.UpdateLastCheck(groupID, checkedAt); err != nil {
+			log.Printf("Ошибка обновления времени проверки группы %d: %s", groupID, err)
+		}
+	}
+}
+
+// Где искать сами комментарии из сводки: они ждут дайджеста
+func (bot *Bot) catchUpDigestHint() string {
+	if len(bot.conf.Digest.Times) == 0 && bot.conf.Digest.IntervalMinutes <= 0 {
+		return "\nКомментарии отложены до дайджеста, отправить его: /senddigest"
+	}
+	return "\nКомментарии придут в ближайшем дайджесте или по /senddigest"
+}
+
+// Сводка наверстанных комментариев: по группам и постам, самые обсуждаемые первыми
+func constructCatchUpSummary(results []catchUpResult, total int, downtime time.Duration) string {
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf(
+		"🔄 *Наверстано %d комментариев в %d группах после простоя %s*\n",
+		total, len(results), formatDuration(downtime),
+	))
+
+	sort.Slice(results, func(i, j int) bool {
+		return len(results[i].Comments) > len(results[j].Comments)
+	})
+
+	// Ограничиваем размер сводки, чтобы уложиться в лимит сообщения Telegram
+	const maxGroups = 20
+	for i, result := range results {
+		if i == maxGroups {
+			summary.WriteString(fmt.Sprintf("\n...и еще %d групп\n", len(results)-maxGroups))
+			break
+		}
+
+		summary.WriteString(fmt.Sprintf(
+			"\n🔹 *%s* (%s): %d\n",
+			escapeMarkdown(result.Group.GroupName),
+			result.Group.Network,
+			len(result.Comments),
+		))
+
+		perPost := make(map[string]int)
+		postURLs := make(map[string]string)
+		var posts []string
+		for _, comment := range result.Comments {
+			post := postKey(comment)
+			if perPost[post] == 0 {
+				posts = append(posts, post)
+				postURLs[post] = comment.PostURL
+			}
+			perPost[post]++
+		}
+		sort.SliceStable(posts, func(i, j int) bool {
+			return perPost[posts[i]] > perPost[posts[j]]
+		})
+
+		const maxPosts = 5
+		for i, post := range posts {
+			if i == maxPosts {
+				summary.WriteString(fmt.Sprintf("   • ...и еще %d постов\n", len(posts)-maxPosts))
+				break
+			}
+			summary.WriteString(fmt.Sprintf("   • [Пост](%s): %d\n", strings.TrimSpace(postURLs[post]), perPost[post]))
+		}
+	}
+
+	return summary.String()
+}
+
+// Форматирует продолжительность вида "6 ч 5 мин"
+func formatDuration(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d д %d ч", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%d ч %d мин", hours, minutes)
+	default:
+		return fmt.Sprintf("%d мин", minutes)
+	}
+}
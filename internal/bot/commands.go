@@ -19,8 +19,8 @@
 package bot
 
 import (
+	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
 	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -187,16 +187,18 @@ func (bot *Bot) PrintConfig(message *telego.Message) {
 	response += fmt.Sprintf("*Разрешенные пользователи*: `%+v`\n", bot.conf.Telegram.AllowedUserIDs)
 	response += fmt.Sprintf("*Мониторинговый чат*: `%+v`\n", bot.conf.Telegram.MonitoringChannelID)
 	response += fmt.Sprintf("*Раздел*: `%+v`\n", bot.conf.Telegram.MonitoringThreadID)
+	response += fmt.Sprintf("*Топик для каждой группы*: `%v`\n", bot.conf.Telegram.AutoTopics)
+	response += fmt.Sprintf("*Ветки по постам*: `%v`\n", bot.conf.ThreadByPost)
 	response += fmt.Sprintf("*Пустые комментарии разрешены?*: `%+v`\n", bot.conf.AllowEmptyComments)
 
 	response += "\n*[СОЦИАЛЬНЫЕ СЕТИ]*:\n"
-	if bot.conf.Social.OK.Token != "" {
-		response += "*OK*: Токен имеется\n"
+	if count := bot.social.OKTokens.Len(); count != 0 {
+		response += fmt.Sprintf("*OK*: Токенов: %d\n", count)
 	} else {
 		response += "*OK*: Токен отсутствует\n"
 	}
-	if bot.conf.Social.VK.Token != "" {
-		response += "*VK*: Токен имеется\n"
+	if count := bot.social.VKTokens.Len(); count != 0 {
+		response += fmt.Sprintf("*VK*: Токенов: %d\n", count)
 	} else {
 		response += "*VK*: Токен отсутствует\n"
 	}
@@ -209,9 +211,40 @@ func (bot *Bot) PrintConfig(message *telego.Message) {
 	response += "\n*[Расписание]*:\n"
 	response += fmt.Sprintf("*Оповещения по расписанию включены?*: `%+v`\n", bot.conf.Schedule.Enabled)
 
+	response += "\n*[ДАЙДЖЕСТ]*:\n"
+	response += fmt.Sprintf("*Дайджест для всех групп?*: `%v`\n", bot.conf.Digest.Enabled)
+	if len(bot.conf.Digest.Times) > 0 {
+		response += fmt.Sprintf("*Время отправки*: `%s`\n", strings.Join(bot.conf.Digest.Times, ", "))
+	} else {
+		response += fmt.Sprintf("*Интервал отправки (мин)*: `%d`\n", bot.conf.Digest.IntervalMinutes)
+	}
+
+	response += "\n*[ДЛИННЫЕ КОММЕНТАРИИ]*:\n"
+	if bot.truncationEnabled() {
+		response += fmt.Sprintf("*Обрезать текст после символов*: `%d`\n", bot.notificationTextLimit())
+	} else {
+		response += "*Обрезать текст*: `нет`\n"
+	}
+	response += fmt.Sprintf("*Отправка длинного текста*: `%s`\n", bot.conf.Truncation.LongText)
+
+	response += "\n*[СОСТОЯНИЕ ГРУПП]*:\n"
+	response += fmt.Sprintf("*Приостанавливать после ошибок подряд*: `%d`\n", bot.conf.Health.FailureThreshold)
+
 	response += "\n*[СПАМ ФИЛЬТР]*:\n"
 	response += fmt.Sprintf("*Фильтровать спам?*: `%v`\n", bot.conf.Spam.FilterSpam)
 	response += fmt.Sprintf("*Ключевые слова*: `%v`\n", bot.conf.Spam.Keywords)
+	response += fmt.Sprintf("*Спам-правил*: %d\n", len(bot.conf.Spam.Rules))
+	response += fmt.Sprintf("*Действие для ключевых слов*: `%s`\n", bot.keywordsAction())
+	response += fmt.Sprintf("*Действие для черного списка авторов*: `%s`\n", bot.blockedAuthorsAction())
+	response += fmt.Sprintf("*Чат карантина*: `%d` (топик `%d`)\n", bot.conf.Spam.QuarantineChatID, bot.conf.Spam.QuarantineThreadID)
+	response += fmt.Sprintf("*Исключений спам-фильтра*: %d\n", len(bot.conf.Spam.Exceptions))
+	response += fmt.Sprintf("*Классификатор спама*: `%v` (порог `%.2f`)\n", bot.conf.Spam.Bayes.Enabled, bot.bayesThreshold())
+	response += fmt.Sprintf("*Сворачивать флуд*: `%v` (похожесть `%.2f`, автор: больше %d за %d мин)\n", bot.conf.Spam.Flood.Enabled, bot.floodSimilarity(), bot.floodAuthorLimit(), bot.floodAuthorWindow()/60)
+	response += fmt.Sprintf("*Проверка контактов*: `%v` (ссылки `%s`, мессенджеры `%s`, телефоны `%s`, @имена `%s`, ссылки новых авторов `%s`)\n", bot.conf.Spam.Contacts.Enabled, bot.conf.Spam.Contacts.LinksAction, bot.conf.Spam.Contacts.MessengerAction, bot.conf.Spam.Contacts.PhonesAction, bot.conf.Spam.Contacts.HandlesAction, bot.conf.Spam.Contacts.NewAuthorAction)
+	response += fmt.Sprintf("*Разрешенные домены*: `%v`\n", bot.conf.Spam.Contacts.AllowedDomains)
+	bot.conf.mu.RLock()
+	response += fmt.Sprintf("*Оценка тональности*: `%v` (своих слов %d, маршрутов %d)\n", bot.conf.Sentiment.Enabled, len(bot.conf.Sentiment.Lexicon), len(bot.conf.Sentiment.Routes))
+	bot.conf.mu.RUnlock()
 
 	bot.answerBack(message, response, true)
 }
@@ -287,7 +320,7 @@ func (bot *Bot) AddGroup(message *telego.Message) {
 		}
 
 		// Получаем информацию о группе
-		info, err := bot.social.VKClient.GetGroupInfo(context.Background(), normalizedID)
+		info, err := bot.social.VKClient.GetGroupInfo(bot.ctx, normalizedID)
 		if err != nil {
 			bot.sendError(message, fmt.Sprintf("Ошибка проверки группы: %v", err))
 			return
@@ -317,7 +350,7 @@ func (bot *Bot) AddGroup(message *telego.Message) {
 		}
 
 		// Получаем информацию о группе
-		info, err := bot.social.OKClient.GetGroupInfo(context.Background(), groupID)
+		info, err := bot.social.OKClient.GetGroupInfo(bot.ctx, groupID)
 		if err != nil {
 			bot.sendError(message, fmt.Sprintf("Ошибка проверки группы: %v", err))
 			return
@@ -370,6 +403,12 @@ func (bot *Bot) AddGroup(message *telego.Message) {
 		"Группа добавлена:\nНазвание: %s\nID: %s\nID в базе: %d",
 		group.GroupName, group.GroupID, id,
 	))
+
+	group.ID = id
+	if err := bot.ensureGroupTopic(bot.ctx, &group); err != nil {
+		log.Printf("Топик группы %s: %s", group.GroupName, err)
+		bot.sendError(message, "Не удалось создать топик группы: "+err.Error())
+	}
 }
 
 // Извлекаем ID группы из URL Одноклассников
@@ -410,6 +449,10 @@ func (bot *Bot) RemoveGroup(message *telego.Message) {
 		return
 	}
 
+	if err := bot.closeGroupTopic(*existingGroup); err != nil {
+		log.Printf("Ошибка закрытия топика группы %s: %s", existingGroup.GroupName, err)
+	}
+
 	bot.sendSuccess(message, "Группа успешно удалена")
 }
 
@@ -429,6 +472,9 @@ func (bot *Bot) ListGroups(message *telego.Message) {
 	response.WriteString("📋 Отслеживаемые группы:\n\n")
 
 	for _, group := range groups {
+		if bot.isGroupPaused(group) {
+			response.WriteString("⏸ ")
+		}
 		response.WriteString(
 			fmt.Sprintf("🔹 *%s* ([%s])\nID: `%s`\nПоследняя проверка: %s\n\n",
 				group.GroupName,
@@ -442,6 +488,278 @@ func (bot *Bot) ListGroups(message *telego.Message) {
 	bot.answerBack(message, response.String(), true)
 }
 
+func (bot *Bot) Health(message *telego.Message) {
+	groups, err := bot.db.GetUnhealthyGroups()
+	if err != nil {
+		bot.sendError(message, "Ошибка получения групп: "+err.Error())
+		return
+	}
+
+	if len(groups) == 0 {
+		bot.answerBack(message, "✅ Все группы проверяются без ошибок", true)
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString("🩺 Группы с проблемами:\n\n")
+
+	for _, group := range groups {
+		state := "⚠️ ошибки"
+		if group.Paused {
+			state = "⏸ приостановлена"
+			if group.PausedUntil != 0 {
+				state += " до " + time.Unix(group.PausedUntil, 0).Format("2006-01-02 15:04")
+			}
+		}
+
+		lastSuccess := "никогда"
+		if group.LastSuccess != 0 {
+			lastSuccess = time.Unix(group.LastSuccess, 0).Format("2006-01-02 15:04")
+		}
+
+		response.WriteString(
+			fmt.Sprintf("🔹 *%s* ([%s]) - %s\nID: `%s`\nОшибок подряд: %d\nПоследний успех: %s\n",
+				escapeMarkdown(group.GroupName),
+				strings.ToUpper(group.Network),
+				state,
+				group.GroupID,
+				group.ConsecutiveFailures,
+				lastSuccess,
+			),
+		)
+		if group.LastError != "" {
+			response.WriteString(
+				fmt.Sprintf("Ошибка: `%s`\n", strings.ReplaceAll(group.LastError, "`", "'")),
+			)
+		}
+		response.WriteString("\n")
+	}
+
+	bot.answerBack(message, response.String(), true)
+}
+
+// Разбирает продолжительность приостановки: "30m", "2h", "1d", "1d12h"
+func parsePauseDuration(input string) (time.Duration, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+
+	var days int
+	if idx := strings.Index(input, "d"); idx != -1 {
+		var err error
+		days, err = strconv.Atoi(input[:idx])
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("неверное количество дней")
+		}
+		input = input[idx+1:]
+	}
+
+	var rest time.Duration
+	if input != "" {
+		var err error
+		rest, err = time.ParseDuration(input)
+		if err != nil {
+			return 0, fmt.Errorf("неверная продолжительность")
+		}
+	}
+
+	duration := time.Duration(days)*24*time.Hour + rest
+	if duration <= 0 {
+		return 0, fmt.Errorf("продолжительность должна быть положительной")
+	}
+
+	return duration, nil
+}
+
+func isSupportedNetwork(network string) bool {
+	return network == "vk" || network == "ok" || network == "tg"
+}
+
+func (bot *Bot) PauseGroup(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 3 {
+		bot.sendError(message,
+			"Неверный формат. Используйте: /pause <сеть> <ID группы> [продолжительность] "+
+				"или /pause network <сеть> [продолжительность]\nПример продолжительности: 30m, 2h, 1d",
+		)
+		return
+	}
+
+	pauseWholeNetwork := strings.ToLower(parts[1]) == "network"
+
+	var durationArg string
+	if len(parts) >= 4 {
+		durationArg = parts[3]
+	}
+
+	var until int64
+	untilStr := "до возобновления командой /resume"
+	if durationArg != "" {
+		duration, err := parsePauseDuration(durationArg)
+		if err != nil {
+			bot.sendError(message, "Неверная продолжительность: "+err.Error()+". Пример: 30m, 2h, 1d")
+			return
+		}
+		untilTime := time.Now().Add(duration)
+		until = untilTime.Unix()
+		untilStr = "до " + untilTime.Format("2006-01-02 15:04")
+	}
+
+	if pauseWholeNetwork {
+		network := strings.ToLower(parts[2])
+		if !isSupportedNetwork(network) {
+			bot.sendError(message, "Неподдерживаемая социальная сеть")
+			return
+		}
+
+		// Приостановка хранится в конфигурации, а не в строках групп,
+		// чтобы действовать и на группы, добавленные во время паузы
+		err := bot.conf.Change(func() {
+			if bot.conf.PausedNetworks == nil {
+				bot.conf.PausedNetworks = make(map[string]int64)
+			}
+			bot.conf.PausedNetworks[network] = until
+		})
+		if err != nil {
+			bot.sendError(message, "Ошибка сохранения приостановки: "+err.Error())
+			return
+		}
+
+		bot.sendSuccess(message, fmt.Sprintf("Мониторинг всех групп %s приостановлен %s", strings.ToUpper(network), untilStr))
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	if err := bot.db.PauseGroup(group.ID, until); err != nil {
+		bot.sendError(message, "Ошибка приостановки группы: "+err.Error())
+		return
+	}
+
+	bot.sendSuccess(message, fmt.Sprintf("Мониторинг группы %s приостановлен %s", group.GroupName, untilStr))
+}
+
+// Подсказка о комментариях, оставленных за время паузы
+func resumeMissedHint(skipMissed bool, command string) string {
+	if skipMissed {
+		return fmt.Sprintf(". Комментарии за время паузы пропущены. Чтобы в следующий раз получить и их, возобновляйте командой `%s all`", command)
+	}
+	return ". Комментарии за время паузы придут при следующей проверке"
+}
+
+func (bot *Bot) ResumeGroup(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 3 {
+		bot.sendError(message, "Неверный формат. Используйте: /resume <сеть> <ID группы> [all] или /resume network <сеть> [all]")
+		return
+	}
+
+	// По умолчанию комментарии за время паузы не присылаются, чтобы после
+	// долгой паузы не получить их все разом. all - получить и их
+	skipMissed := !(len(parts) >= 4 && strings.ToLower(parts[3]) == "all")
+
+	if strings.ToLower(parts[1]) == "network" {
+		network := strings.ToLower(parts[2])
+		if !isSupportedNetwork(network) {
+			bot.sendError(message, "Неподдерживаемая социальная сеть")
+			return
+		}
+		if !bot.isNetworkPaused(network, time.Now().Unix()) {
+			bot.sendError(message, "Соцсеть не приостановлена. Отдельно приостановленные группы возобновляются командой /resume <сеть> <ID группы>")
+			return
+		}
+
+		if err := bot.resumeNetwork(network, skipMissed); err != nil {
+			bot.sendError(message, "Ошибка возобновления соцсети: "+err.Error())
+			return
+		}
+
+		bot.sendSuccess(message, fmt.Sprintf("Мониторинг групп %s возобновлен", strings.ToUpper(network))+
+			resumeMissedHint(skipMissed, "/resume network "+network))
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	if err := bot.db.ResumeGroup(group.ID); err != nil {
+		bot.sendError(message, "Ошибка возобновления группы: "+err.Error())
+		return
+	}
+	if skipMissed {
+		if err := bot.db.UpdateLastCheck(group.ID, time.Now().Unix()); err != nil {
+			bot.sendError(message, "Ошибка обновления времени проверки группы: "+err.Error())
+			return
+		}
+	}
+
+	response := fmt.Sprintf("Мониторинг группы %s возобновлен", group.GroupName) +
+		resumeMissedHint(skipMissed, fmt.Sprintf("/resume %s %s", group.Network, group.GroupID))
+	if bot.isNetworkPaused(group.Network, time.Now().Unix()) {
+		response += fmt.Sprintf("\nСоцсеть %s приостановлена целиком: группа будет проверяться после `/resume network %s`", strings.ToUpper(group.Network), group.Network)
+	}
+	bot.sendSuccess(message, response)
+}
+
+func (bot *Bot) ListTokens(message *telego.Message) {
+	pools := []struct {
+		network string
+		pool    *social.TokenPool
+	}{
+		{"VK", bot.social.VKTokens},
+		{"OK", bot.social.OKTokens},
+	}
+
+	var response strings.Builder
+	response.WriteString("🔑 Токены API:\n")
+
+	now := time.Now()
+	for _, entry := range pools {
+		response.WriteString(fmt.Sprintf("\n*[%s]*\n", entry.network))
+
+		statuses := entry.pool.Status()
+		if len(statuses) == 0 {
+			response.WriteString("Токены отсутствуют\n")
+			continue
+		}
+
+		for _, status := range statuses {
+			state := "✅ активен"
+			if now.Before(status.BenchedUntil) {
+				state = "⏸ отстранен до " + status.BenchedUntil.Format("15:04:05")
+			}
+
+			response.WriteString(fmt.Sprintf(
+				"🔹 *%s* (`%s`) - %s\nГрупп: %d | Запросов: %d | Ошибок: %d\n",
+				escapeMarkdown(status.Name),
+				status.Masked,
+				state,
+				status.Groups,
+				status.Requests,
+				status.Failures,
+			))
+			if status.LastError != "" {
+				response.WriteString(fmt.Sprintf("Последняя ошибка: `%s`\n", strings.ReplaceAll(status.LastError, "`", "'")))
+			}
+		}
+	}
+
+	bot.answerBack(message, response.String(), true)
+}
+
 func (bot *Bot) ChatID(message *telego.Message) {
 	bot.answerBack(message,
 		fmt.Sprintf(
@@ -735,125 +1053,209 @@ func (bot *Bot) SendLogs(message *telego.Message) {
 	}
 
 	// Отправка документа
-	if _, err := bot.api.SendDocument(context.Background(), &params); err != nil {
+	if _, err := bot.api.SendDocument(bot.ctx, &params); err != nil {
 		bot.sendError(message, "Ошибка отправки файла")
 		log.Printf("Ошибка отправки файла логов: %v", err)
 	}
 }
 
 func (bot *Bot) ListNotificationTypes(message *telego.Message) {
-	// Определяем текущий тип оповещения
-	currentType := "неизвестный"
-	switch bot.conf.NotificationMessageType {
-	case NOTIFICATION_FULL:
-		currentType = "Полный (full)"
-	case NOTIFICATION_MINIMALISTIC:
-		currentType = "Минималистичный (minimalistic)"
-	case NOTIFICATION_SPACED:
-		currentType = "Просторный (spaced)"
-	}
-
-	// Подготавливаем описание каждого типа
-	types := []string{
-		"1. *Полный (full)* - подробное уведомление со всеми деталями",
-		"   • Пример:\n" +
-			"     💬 *Новый комментарий в \"Группа\" (tg)*:\n\n" +
-			"     📝 *Текст*: Пример комментария\n\n" +
-			"     👤 *Автор*: Пользователь\n" +
-			"     🔗 *Ссылка*: [Перейти к посту](https://example.com)\n" +
-			"     ⏰ *Время*: 2024-01-01 12:00\n" +
-			"     📌 *Статус*: Только что",
-
-		"2. *Минималистичный (minimalistic)* - компактное уведомление",
-		"   • Пример:\n" +
-			"     ✈️ *Группа*\n" +
-			"     💬 Пример комментария\n" +
-			"     ⏰ сегодня в 12:00 | Только что\n" +
-			"     👤 *Пользователь*\n" +
-			"     🔗 [Перейти к посту](https://example.com) • 5 сек назад",
-
-		"3. *Просторный (spaced)* - уведомление с визуальными разделителями",
-		"   • Пример:\n" +
-			"     *💬 НОВЫЙ КОММЕНТАРИЙ*\n" +
-			"     *Группа:* _Группа_ (tg)\n" +
-			"     ••••••••••••••••••••••••••••••••••••\n" +
-			"     *📝 Текст комментария:*\n" +
-			"     Пример комментария\n" +
-			"     ••••••••••••••••••••••••••••••••••••\n" +
-			"     *👤 Автор:* Пользователь\n" +
-			"     *⏰ Время:* сегодня в 12:00\n" +
-			"     *📌 Статус:* Только что",
+	var response strings.Builder
+	response.WriteString("*Доступные шаблоны оповещений*\n\n")
+	response.WriteString(fmt.Sprintf("Текущий шаблон: `%s`\n\n", bot.activeTemplateName()))
+
+	response.WriteString("*Встроенные:*\n")
+	for _, name := range []string{TEMPLATE_FULL, TEMPLATE_MINIMALISTIC, TEMPLATE_SPACED} {
+		response.WriteString(fmt.Sprintf("• `%s` - %s\n", name, builtinTemplateDescriptions[name]))
 	}
 
-	response := fmt.Sprintf(
-		"*Доступные типы оповещений*\n\n"+
-			"Текущий тип: *%s*\n\n"+
-			"%s\n\n"+
-			"Для изменения используйте:\n`/setnotificationtype [тип]`\n"+
-			"Доступные типы: `full`, `minimalistic`, `spaced`",
-		currentType,
-		strings.Join(types, "\n"),
+	bot.conf.mu.RLock()
+	names := make([]string, 0, len(bot.conf.NotificationTemplates))
+	for name := range bot.conf.NotificationTemplates {
+		names = append(names, name)
+	}
+	bot.conf.mu.RUnlock()
+
+	if len(names) > 0 {
+		sort.Strings(names)
+
+		response.WriteString("\n*Пользовательские:*\n")
+		for _, name := range names {
+			response.WriteString(fmt.Sprintf("• `%s`\n", name))
+		}
+	}
+
+	response.WriteString(
+		"\nДля изменения используйте:\n`/setnotificationtype [шаблон]`\n" +
+			"Посмотреть пример: `/previewtemplate [шаблон]`\n" +
+			"Создать свой: `/settemplate [имя] [текст шаблона]`",
 	)
 
-	bot.answerBack(message, response, true)
+	bot.answerBack(message, response.String(), true)
 }
 
 func (bot *Bot) SetNotificationType(message *telego.Message) {
-	parts := strings.Split(strings.TrimSpace(message.Text), " ")
+	parts := strings.Fields(message.Text)
 	if len(parts) < 2 {
 		bot.sendError(
 			message,
-			"Неверный формат. Используйте: `/setnotificationtype [тип]`\n"+
-				"Доступные типы: `full`, `minimalistic`, `spaced`",
+			"Неверный формат. Используйте: `/setnotificationtype [шаблон]`\n"+
+				"Список шаблонов: `/listnotificationtypes`",
 		)
 		return
 	}
 
-	typeName := strings.ToLower(parts[1])
-	var newType int
-	var newTypeName string
-
-	switch typeName {
-	case "full":
-		newType = NOTIFICATION_FULL
-		newTypeName = "Полный"
-	case "minimalistic":
-		newType = NOTIFICATION_MINIMALISTIC
-		newTypeName = "Минималистичный"
-	case "spaced":
-		newType = NOTIFICATION_SPACED
-		newTypeName = "Просторный"
-	default:
+	name := strings.ToLower(parts[1])
+	if _, ok := bot.templateSource(name); !ok {
 		bot.sendError(
 			message,
-			"Неизвестный тип оповещения.\n"+
-				"Доступные типы: `full`, `minimalistic`, `spaced`",
+			"Неизвестный шаблон оповещения.\n"+
+				"Список шаблонов: `/listnotificationtypes`",
 		)
 		return
 	}
 
 	// Проверка, не пытаемся ли установить уже текущий тип
-	if bot.conf.NotificationMessageType == newType {
-		currentType := newTypeName
+	if bot.activeTemplateName() == name {
 		bot.answerBack(message,
-			fmt.Sprintf("Тип оповещения уже установлен как *%s*", currentType),
+			fmt.Sprintf("Шаблон оповещения уже установлен как `%s`", name),
 			true,
 		)
 		return
 	}
 
-	// Сохраняем новый тип
-	bot.conf.NotificationMessageType = newType
+	bot.setActiveTemplate(name)
 	bot.conf.Update()
 
 	bot.answerBack(message,
-		fmt.Sprintf("✅ Тип оповещения изменён на *%s*\n\n"+
+		fmt.Sprintf("✅ Шаблон оповещения изменён на `%s`\n\n"+
 			"Все новые уведомления будут отправляться в этом формате",
-			newTypeName),
+			name),
 		true,
 	)
 }
 
+// Делает шаблон активным. Встроенные шаблоны также отражаются в
+// notification_message_type для совместимости со старыми конфигурациями
+func (bot *Bot) setActiveTemplate(name string) {
+	switch name {
+	case TEMPLATE_FULL:
+		bot.conf.NotificationMessageType = NOTIFICATION_FULL
+		bot.conf.NotificationTemplate = ""
+	case TEMPLATE_MINIMALISTIC:
+		bot.conf.NotificationMessageType = NOTIFICATION_MINIMALISTIC
+		bot.conf.NotificationTemplate = ""
+	case TEMPLATE_SPACED:
+		bot.conf.NotificationMessageType = NOTIFICATION_SPACED
+		bot.conf.NotificationTemplate = ""
+	default:
+		bot.conf.NotificationTemplate = name
+	}
+}
+
+// Разбирает "/команда имя остаток", сохраняя переводы строк в остатке
+func splitNameAndBody(text string) (string, string) {
+	fields := strings.SplitN(strings.TrimSpace(text), " ", 2)
+	if len(fields) < 2 {
+		return "", ""
+	}
+
+	rest := strings.TrimLeft(fields[1], " ")
+	nameEnd := strings.IndexAny(rest, " \n")
+	if nameEnd == -1 {
+		return strings.ToLower(rest), ""
+	}
+
+	return strings.ToLower(rest[:nameEnd]), strings.TrimSpace(rest[nameEnd:])
+}
+
+func (bot *Bot) SetTemplate(message *telego.Message) {
+	name, body := splitNameAndBody(message.Text)
+	if name == "" || body == "" {
+		bot.sendError(message,
+			"Неверный формат. Используйте: `/settemplate [имя] [текст шаблона]`\n"+
+				"Текст можно писать с новой строки. Доступные поля:\n"+notificationFieldsHelp,
+		)
+		return
+	}
+
+	if isBuiltinTemplate(name) {
+		bot.sendError(message, "Нельзя изменить встроенный шаблон, выберите другое имя")
+		return
+	}
+
+	if _, err := validateTemplate(body); err != nil {
+		bot.sendError(message, "Шаблон отклонен: "+escapeMarkdown(err.Error()))
+		return
+	}
+
+	err := bot.conf.Change(func() {
+		if bot.conf.NotificationTemplates == nil {
+			bot.conf.NotificationTemplates = make(map[string]string)
+		}
+		bot.conf.NotificationTemplates[name] = body
+		bot.setActiveTemplate(name)
+	})
+	if err != nil {
+		bot.sendError(message, "Ошибка сохранения шаблона: "+err.Error())
+		return
+	}
+
+	bot.sendSuccess(message, fmt.Sprintf("Шаблон `%s` сохранен и установлен. Пример: `/previewtemplate %s`", name, name))
+}
+
+func (bot *Bot) PreviewTemplate(message *telego.Message) {
+	name := bot.activeTemplateName()
+	if parts := strings.Fields(message.Text); len(parts) >= 2 {
+		name = strings.ToLower(parts[1])
+	}
+
+	source, ok := bot.templateSource(name)
+	if !ok {
+		bot.sendError(message, "Неизвестный шаблон оповещения")
+		return
+	}
+
+	rendered, err := validateTemplate(source)
+	if err != nil {
+		bot.sendError(message, "Шаблон некорректен: "+escapeMarkdown(err.Error()))
+		return
+	}
+
+	bot.answerBack(message, rendered, true)
+}
+
+func (bot *Bot) RemoveTemplate(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 2 {
+		bot.sendError(message, "Неверный формат. Используйте: `/rmtemplate [имя]`")
+		return
+	}
+
+	name := strings.ToLower(parts[1])
+	if isBuiltinTemplate(name) {
+		bot.sendError(message, "Нельзя удалить встроенный шаблон")
+		return
+	}
+
+	found := false
+	bot.conf.Change(func() {
+		if _, found = bot.conf.NotificationTemplates[name]; !found {
+			return
+		}
+		delete(bot.conf.NotificationTemplates, name)
+		if bot.conf.NotificationTemplate == name {
+			bot.setActiveTemplate(TEMPLATE_FULL)
+		}
+	})
+	if !found {
+		bot.sendError(message, "Шаблон не найден")
+		return
+	}
+
+	bot.sendSuccess(message, fmt.Sprintf("Шаблон `%s` удален", name))
+}
+
 func (bot *Bot) AddSpamKeyword(message *telego.Message) {
 	parts := strings.Split(strings.TrimSpace(message.Text), " ")
 	if len(parts) < 2 {
@@ -19,11 +19,14 @@
 package bot
 
 import (
+	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
 	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sync"
 )
 
 var CONFIG_PATH string = ""
@@ -32,8 +35,11 @@ type TelegramConf struct {
 	ApiToken            string  `json:"api_token"`
 	Public              bool    `json:"is_public"`
 	AllowedUserIDs      []int64 `json:"allowed_user_ids"`
+	ModeratorIDs        []int64 `json:"moderator_ids"` // Кто может удалять комментарии и блокировать авторов (пусто - allowed_user_ids)
 	MonitoringChannelID int64   `json:"monitoring_channel_id"`
 	MonitoringThreadID  int64   `json:"monitoring_thread_id"`
+	ParseMode           string  `json:"parse_mode"`  // "HTML" (по умолчанию) или "MarkdownV2"
+	AutoTopics          bool    `json:"auto_topics"` // Создавать топик для каждой группы в мониторинговом чате-форуме
 }
 
 type DBConf struct {
@@ -41,15 +47,48 @@ type DBConf struct {
 	db   *db.DB
 }
 
-type VKConf struct {
+// Дополнительный токен пула
+type TokenConf struct {
+	Name  string `json:"name"`
 	Token string `json:"token"`
 }
 
+type VKConf struct {
+	Token           string            `json:"token"`
+	Tokens          []TokenConf       `json:"tokens"`           // Дополнительные токены для ротации
+	PinnedGroups    map[string]string `json:"pinned_groups"`    // ID группы -> имя токена
+	CommunityTokens map[string]string `json:"community_tokens"` // ID группы -> токен сообщества для ответов
+}
+
 type OKConf struct {
-	Token     string `json:"token"`
-	PublicKey string `json:"public_key"`
-	SecretKey string `json:"secret_key"`
-	AppID     string `json:"app_id"`
+	Token        string            `json:"token"`
+	Tokens       []TokenConf       `json:"tokens"`        // Дополнительные токены для ротации
+	PinnedGroups map[string]string `json:"pinned_groups"` // ID группы -> имя токена
+	PublicKey    string            `json:"public_key"`
+	SecretKey    string            `json:"secret_key"`
+	AppID        string            `json:"app_id"`
+}
+
+// Собирает пул из основного токена (под именем "main") и дополнительных
+func newTokenPool(main string, extra []TokenConf, pinned map[string]string) *social.TokenPool {
+	tokens := []social.Token{{Name: "main", Value: main}}
+	for i, token := range extra {
+		name := token.Name
+		if name == "" {
+			name = fmt.Sprintf("token%d", i+1)
+		}
+		tokens = append(tokens, social.Token{Name: name, Value: token.Token})
+	}
+
+	return social.NewTokenPool(tokens, pinned)
+}
+
+func (c *VKConf) TokenPool() *social.TokenPool {
+	return newTokenPool(c.Token, c.Tokens, c.PinnedGroups)
+}
+
+func (c *OKConf) TokenPool() *social.TokenPool {
+	return newTokenPool(c.Token, c.Tokens, c.PinnedGroups)
 }
 
 type TGConf struct {
@@ -77,21 +116,172 @@ const (
 )
 
 type SpamConfig struct {
-	FilterSpam bool     `json:"filter_spam"`
-	Keywords   []string `json:"spam_keywords"`
+	FilterSpam bool       `json:"filter_spam"`
+	Keywords   []string   `json:"spam_keywords"` // Подстроки, по которым комментарий считается спамом во всех группах
+	Rules      []SpamRule `json:"rules"`
+
+	KeywordsAction     string   `json:"keywords_action"`      // Действие для ключевых слов (SPAM_ACTION_*, не задано - drop)
+	QuarantineChatID   int64    `json:"quarantine_chat_id"`   // Чат для задержанных комментариев (0 - не пересылать)
+	QuarantineThreadID int64    `json:"quarantine_thread_id"` // Топик в чате карантина
+	Exceptions         []string `json:"exceptions"`           // Нормализованные тексты, признанные не спамом
+
+	BlockedAuthorsAction string `json:"blocked_authors_action"` // Действие для авторов из черного списка (SPAM_ACTION_*)
+
+	Bayes    BayesConfig    `json:"bayes"`
+	Flood    FloodConfig    `json:"flood"`
+	Contacts ContactsConfig `json:"contacts"`
+}
+
+// Ссылки, телефоны и имена пользователей в тексте. Для каждого вида контактов
+// задается действие (SPAM_ACTION_*), пустое действие - не проверять
+type ContactsConfig struct {
+	Enabled           bool     `json:"enabled"`
+	AllowedDomains    []string `json:"allowed_domains"`     // Ссылки на эти домены и их поддомены не учитываются
+	LinksAction       string   `json:"links_action"`        // Внешние ссылки
+	MessengerAction   string   `json:"messenger_action"`    // Ссылки на мессенджеры: t.me, wa.me и т.п.
+	PhonesAction      string   `json:"phones_action"`       // Телефоны
+	HandlesAction     string   `json:"handles_action"`      // Имена пользователей: @username
+	NewAuthorAction   string   `json:"new_author_action"`   // Внешние ссылки от нового автора
+	NewAuthorComments int      `json:"new_author_comments"` // Автор новый, пока у него меньше комментариев
+}
+
+// Поиск повторяющихся комментариев. Повторы сворачиваются в одно оповещение
+type FloodConfig struct {
+	Enabled             bool    `json:"enabled"`
+	WindowMinutes       int     `json:"window_minutes"`        // За сколько минут ищутся похожие тексты
+	Similarity          float64 `json:"similarity"`            // С какой похожести (0..1) тексты считаются повтором
+	MinTextLength       int     `json:"min_text_length"`       // Более короткие тексты (после нормализации) не сравниваются
+	AuthorLimit         int     `json:"author_limit"`          // Сколько комментариев автора за AuthorWindowMinutes еще не флуд
+	AuthorWindowMinutes int     `json:"author_window_minutes"` // Окно подсчета комментариев автора
+}
+
+// Байесовский классификатор, обучаемый на решениях модераторов
+type BayesConfig struct {
+	Enabled       bool    `json:"enabled"`
+	Threshold     float64 `json:"threshold"`      // С какой оценки (0..1) комментарий считается спамом
+	KeywordWeight float64 `json:"keyword_weight"` // Сколько добавляет к оценке каждое ключевое слово
+	MinDocuments  int     `json:"min_documents"`  // Сколько нужно примеров спама и не спама, чтобы классификатор работал
+	Action        string  `json:"action"`         // Действие при превышении порога (SPAM_ACTION_*)
+}
+
+const (
+	SPAM_RULE_SUBSTRING  = "substring"  // Подстрока без учета регистра
+	SPAM_RULE_WORD       = "word"       // Целое слово или фраза
+	SPAM_RULE_REGEX      = "regex"      // Регулярное выражение без учета регистра
+	SPAM_RULE_NORMALIZED = "normalized" // Подстрока после нормализации текста (см. normalizeSpamText)
+	SPAM_RULE_BAYES      = "bayes"      // Оценка классификатора, не задается вручную
+	SPAM_RULE_AUTHOR     = "author"     // Автор в черном списке, не задается вручную
+	SPAM_RULE_CONTACT    = "contact"    // Контакты в тексте (см. ContactsConfig), не задается вручную
+)
+
+const (
+	SPAM_ACTION_DROP       = "drop"       // Не оповещать
+	SPAM_ACTION_QUARANTINE = "quarantine" // Сохранить без оповещения
+	SPAM_ACTION_TAG        = "tag"        // Оповестить с пометкой
+)
+
+type SpamRule struct {
+	ID      int    `json:"id"`
+	Type    string `json:"type"` // SPAM_RULE_*
+	Pattern string `json:"pattern"`
+	Scope   string `json:"scope"`  // "" - все группы, "vk" - соцсеть, "vk:123" - группа
+	Action  string `json:"action"` // SPAM_ACTION_*
+}
+
+type HealthConfig struct {
+	// Через сколько неудачных проверок подряд приостанавливать группу (0 - никогда)
+	FailureThreshold int `json:"failure_threshold"`
+}
+
+type CatchUpConfig struct {
+	Enabled          bool `json:"enabled"`
+	PostsCount       int  `json:"posts_count"`       // Сколько последних постов просматривать после простоя
+	SummaryThreshold int  `json:"summary_threshold"` // Больше стольких комментариев - отправлять сводку
+}
+
+const (
+	LONG_TEXT_SPLIT = "split" // Несколько сообщений
+	LONG_TEXT_FILE  = "file"  // Вложение .txt
+)
+
+type TruncationConfig struct {
+	MaxLength int    `json:"max_length"` // Сколько символов текста показывать в оповещении (0 - 500, -1 - весь текст)
+	LongText  string `json:"long_text"`  // Как отправлять текст длиннее лимита Telegram: "split" или "file"
+}
+
+type DigestConfig struct {
+	Enabled         bool     `json:"enabled"`          // Дайджест для всех групп, у которых режим не задан отдельно
+	IntervalMinutes int      `json:"interval_minutes"` // Как часто отправлять дайджест, если не заданы times
+	Times           []string `json:"times"`            // Время отправки: ["09:00", "18:00"] (часовой пояс расписания)
+	ExcerptLength   int      `json:"excerpt_length"`   // Длина отрывка комментария в дайджесте
+}
+
+// Чат и топик для оповещений
+type RouteConf struct {
+	ChatID   int64 `json:"chat_id"`
+	ThreadID int64 `json:"thread_id"`
 }
 
 type Config struct {
-	Telegram                TelegramConf   `json:"telegram"`
-	Debug                   bool           `json:"debug"`
-	DB                      DBConf         `json:"database"`
-	Social                  SocialConfig   `json:"socials"`
-	AllowEmptyComments      bool           `json:"allow_empty_comments"`
-	Schedule                ScheduleConfig `json:"schedule"`
-	CheckIntervalMinutes    int            `json:"check_interval_minutes"`
-	LogsFile                string         `json:"logs_file"`
-	NotificationMessageType int            `json:"notification_message_type"`
-	Spam                    SpamConfig     `json:"spam"`
+	Telegram                TelegramConf         `json:"telegram"`
+	Debug                   bool                 `json:"debug"`
+	DB                      DBConf               `json:"database"`
+	Social                  SocialConfig         `json:"socials"`
+	AllowEmptyComments      bool                 `json:"allow_empty_comments"`
+	Schedule                ScheduleConfig       `json:"schedule"`
+	CheckIntervalMinutes    int                  `json:"check_interval_minutes"`
+	LogsFile                string               `json:"logs_file"`
+	NotificationMessageType int                  `json:"notification_message_type"`
+	NotificationTemplate    string               `json:"notification_template"`  // Имя активного шаблона (пусто - по notification_message_type)
+	NotificationTemplates   map[string]string    `json:"notification_templates"` // Пользовательские шаблоны: имя -> text/template
+	Spam                    SpamConfig           `json:"spam"`
+	Health                  HealthConfig         `json:"health"`
+	CatchUp                 CatchUpConfig        `json:"catch_up"`
+	Truncation              TruncationConfig     `json:"truncation"`
+	Digest                  DigestConfig         `json:"digest"`
+	ThreadByPost            bool                 `json:"thread_by_post"` // Оповещения о комментариях к одному посту - ответами на первое
+	TagRoutes               map[string]RouteConf `json:"tag_routes"`     // Метка группы -> чат для оповещений
+	Watch                   WatchConfig          `json:"watch"`
+	Sentiment               SentimentConfig      `json:"sentiment"`
+	PausedNetworks          map[string]int64     `json:"paused_networks"` // Приостановленные соцсети -> до какого времени (0 - бессрочно)
+
+	// Защищает словари и списки, которые команды меняют во время работы
+	// мониторинга: шаблоны, маршруты меток, словарь и маршруты тональности,
+	// приостановленные соцсети
+	mu sync.RWMutex
+}
+
+// Оценка тональности и токсичности комментариев по локальному словарю
+type SentimentConfig struct {
+	Enabled    bool                 `json:"enabled"`
+	Lexicon    map[string]float64   `json:"lexicon"`     // Основа слова -> вес; дополняет встроенный словарь, 0 - отключить слово
+	ToxicWords []string             `json:"toxic_words"` // Дополнительные основы оскорблений
+	Routes     map[string]RouteConf `json:"routes"`      // Тональность (MOOD_*) -> чат для оповещений
+	// Положительные комментарии не длиннее стольких слов не отправляются (0 - отправлять все)
+	IgnorePositiveWords int `json:"ignore_positive_words"`
+}
+
+// Отслеживаемые темы: важные комментарии выделяются, а критичные
+// отправляются отдельным закрепленным сообщением
+type WatchConfig struct {
+	Rules         []WatchRule `json:"rules"`
+	AlertChatID   int64       `json:"alert_chat_id"`   // Чат для критичных оповещений (0 - чат группы)
+	AlertThreadID int64       `json:"alert_thread_id"` // Топик в чате критичных оповещений
+}
+
+const (
+	WATCH_NORMAL   = "normal"   // Пометка в оповещении
+	WATCH_HIGH     = "high"     // То же, но оповещение приходит и в нерабочее время, минуя дайджест
+	WATCH_CRITICAL = "critical" // То же и отдельное оповещение, закрепленное до обработки комментария
+)
+
+type WatchRule struct {
+	ID       int      `json:"id"`
+	Type     string   `json:"type"`     // SPAM_RULE_SUBSTRING, WORD, REGEX или NORMALIZED
+	Pattern  string   `json:"pattern"`  // Части через " + " должны встретиться все (кроме regex)
+	Scope    string   `json:"scope"`    // Как у SpamRule
+	Priority string   `json:"priority"` // WATCH_*
+	Mentions []string `json:"mentions"` // Кого упомянуть: @username или ID пользователя Telegram
 }
 
 func (c *Config) OpenDB() (*db.DB, error) {
@@ -111,8 +301,9 @@ func (c *Config) GetDB() *db.DB {
 func DefaultConfig() *Config {
 	return &Config{
 		Telegram: TelegramConf{
-			ApiToken: "tg_token",
-			Public:   true,
+			ApiToken:  "tg_token",
+			Public:    true,
+			ParseMode: "HTML",
 		},
 		DB: DBConf{
 			File: "DB.sqlite3",
@@ -142,8 +333,54 @@ func DefaultConfig() *Config {
 		},
 		CheckIntervalMinutes: 10,
 		LogsFile:             "logs.txt",
+		Health: HealthConfig{
+			FailureThreshold: 10,
+		},
+		CatchUp: CatchUpConfig{
+			Enabled:          true,
+			PostsCount:       200,
+			SummaryThreshold: 20,
+		},
+		ThreadByPost: true,
+		Digest: DigestConfig{
+			Enabled:         false,
+			IntervalMinutes: 60,
+			Times:           []string{},
+			ExcerptLength:   100,
+		},
+		Truncation: TruncationConfig{
+			MaxLength: NOTIFICATION_TEXT_DEFAULT,
+			LongText:  LONG_TEXT_SPLIT,
+		},
 		Spam: SpamConfig{
-			FilterSpam: true,
+			FilterSpam:           true,
+			KeywordsAction:       SPAM_ACTION_QUARANTINE,
+			BlockedAuthorsAction: SPAM_ACTION_DROP,
+			Bayes: BayesConfig{
+				Enabled:       true,
+				Threshold:     0.9,
+				KeywordWeight: 0.3,
+				MinDocuments:  20,
+				Action:        SPAM_ACTION_QUARANTINE,
+			},
+			Contacts: ContactsConfig{
+				Enabled:           true,
+				AllowedDomains:    []string{"vk.com", "vk.ru", "ok.ru"},
+				LinksAction:       SPAM_ACTION_TAG,
+				MessengerAction:   SPAM_ACTION_QUARANTINE,
+				PhonesAction:      SPAM_ACTION_TAG,
+				HandlesAction:     SPAM_ACTION_TAG,
+				NewAuthorAction:   SPAM_ACTION_QUARANTINE,
+				NewAuthorComments: 1,
+			},
+			Flood: FloodConfig{
+				Enabled:             true,
+				WindowMinutes:       FLOOD_DEFAULT_WINDOW_MINUTES,
+				Similarity:          FLOOD_DEFAULT_SIMILARITY,
+				MinTextLength:       FLOOD_DEFAULT_MIN_TEXT_LENGTH,
+				AuthorLimit:         FLOOD_DEFAULT_AUTHOR_LIMIT,
+				AuthorWindowMinutes: FLOOD_DEFAULT_AUTHOR_WINDOW_MINUTES,
+			},
 			Keywords: []string{
 				"халтурка",
 				"подработка",
@@ -167,6 +404,12 @@ func DefaultConfig() *Config {
 				"берём только 18+",
 			},
 		},
+		Sentiment: SentimentConfig{
+			Enabled:    true,
+			Lexicon:    map[string]float64{},
+			ToxicWords: []string{},
+			Routes:     map[string]RouteConf{},
+		},
 	}
 }
 
@@ -177,7 +420,9 @@ func (conf *Config) Save(filepath string) error {
 	}
 	defer file.Close()
 
+	conf.mu.RLock()
 	jsonBytes, err := json.MarshalIndent(&conf, "", "\t")
+	conf.mu.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -222,3 +467,13 @@ func (conf *Config) Update() error {
 
 	return conf.Save(CONFIG_PATH)
 }
+
+// Меняет конфигурацию под блокировкой и сохраняет ее. Словари и списки,
+// которые читает мониторинг, меняются только так
+func (conf *Config) Change(change func()) error {
+	conf.mu.Lock()
+	change()
+	conf.mu.Unlock()
+
+	return conf.Update()
+}
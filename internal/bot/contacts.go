@@ -0,0 +1,214 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+)
+
+// Ссылка: со схемой - на любой домен, без схемы - только с известной зоной,
+// чтобы "т.д." или "Mr.Smith" не считались ссылками
+var linkRegexp = regexp.MustCompile(`(?i)(https?://)?((?:[\p{L}\d_](?:[\p{L}\d_-]*[\p{L}\d_])?\.)+[\p{L}]{2,12})(?:[/?#][^\s<>"'«»()]*)?`)
+
+// Телефон: +7 999 123-45-67, 8 (999) 123 45 67, 89991234567
+var phoneRegexp = regexp.MustCompile(`(?:\+\d{1,3}|\b8)[\s\-(]*\d{3}[\s\-)]*\d{3}[\s\-]*\d{2}[\s\-]*\d{2}\b`)
+
+// Имя пользователя мессенджера: @username (не часть адреса почты)
+var handleRegexp = regexp.MustCompile(`(?:^|[^\p{L}\d_@./])@([A-Za-z][A-Za-z0-9_]{3,31})\b`)
+
+// Зоны, домены в которых считаются ссылками и без http://
+var knownZones = map[string]bool{
+	"ru": true, "su": true, "рф": true, "com": true, "net": true, "org": true,
+	"info": true, "biz": true, "me": true, "io": true, "co": true, "cc": true,
+	"ly": true, "gl": true, "to": true, "gg": true, "tv": true, "xyz": true,
+	"top": true, "site": true, "online": true, "shop": true, "store": true,
+	"link": true, "club": true, "pro": true, "app": true, "dev": true,
+	"ua": true, "by": true, "kz": true, "uz": true, "live": true, "click": true,
+	"icu": true, "fun": true, "space": true, "tk": true, "ml": true,
+}
+
+// Домены мессенджеров: ссылки на них уводят из комментариев в личную переписку
+var messengerDomains = []string{
+	"t.me", "telegram.me", "telegram.dog", "wa.me", "whatsapp.com",
+	"viber.com", "viber.click", "vk.me", "m.me", "ig.me", "discord.gg",
+}
+
+// Ссылка из текста комментария
+type contactLink struct {
+	URL    string // Как в тексте
+	Domain string // В нижнем регистре, без www.
+}
+
+// Ссылки, телефоны и имена пользователей из текста комментария
+type commentContacts struct {
+	Links   []contactLink
+	Phones  []string // Как в тексте
+	Handles []string // С @
+}
+
+func (c commentContacts) empty() bool {
+	return len(c.Links) == 0 && len(c.Phones) == 0 && len(c.Handles) == 0
+}
+
+// Находит в тексте ссылки, телефоны и имена пользователей мессенджеров
+func extractContacts(text string) commentContacts {
+	var contacts commentContacts
+
+	for _, match := range linkRegexp.FindAllStringSubmatchIndex(text, -1) {
+		// Домен почтового адреса - не ссылка
+		if match[0] > 0 && text[match[0]-1] == '@' {
+			continue
+		}
+
+		link := strings.TrimRight(text[match[0]:match[1]], ".,!?:;")
+		domain := strings.TrimPrefix(strings.ToLower(text[match[4]:match[5]]), "www.")
+		zone := domain[strings.LastIndex(domain, ".")+1:]
+		if match[2] < 0 && !knownZones[zone] {
+			continue
+		}
+
+		contacts.Links = append(contacts.Links, contactLink{URL: link, Domain: domain})
+	}
+
+	contacts.Phones = phoneRegexp.FindAllString(text, -1)
+
+	for _, match := range handleRegexp.FindAllStringSubmatch(text, -1) {
+		handle := "@" + match[1]
+		if !slices.Contains(contacts.Handles, handle) {
+			contacts.Handles = append(contacts.Handles, handle)
+		}
+	}
+
+	return contacts
+}
+
+// Домен совпадает с одним из domains или является его поддоменом
+func domainMatches(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+		if d != "" && (domain == d || strings.HasSuffix(domain, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ссылка на домен, разрешенный в настройках
+func (bot *Bot) isAllowedLink(link contactLink) bool {
+	return domainMatches(link.Domain, bot.conf.Spam.Contacts.AllowedDomains)
+}
+
+// Домены внешних ссылок для оповещения, ссылки на мессенджеры помечены
+func linkDomains(links []contactLink) []string {
+	var domains []string
+	for _, link := range links {
+		domain := link.Domain
+		if domainMatches(link.Domain, messengerDomains) {
+			domain += " (мессенджер)"
+		}
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// Новый ли автор: меньше Contacts.NewAuthorComments сохраненных комментариев в соцсети
+func (bot *Bot) isNewAuthor(network string, comment db.Comment) bool {
+	count, err := bot.db.CountAuthorComments(network, authorKey(comment), comment.ID)
+	if err != nil {
+		log.Printf("Ошибка подсчета комментариев автора %s: %s", comment.Author, err)
+		return false
+	}
+
+	limit := bot.conf.Spam.Contacts.NewAuthorComments
+	if limit <= 0 {
+		limit = 1
+	}
+	return count < limit
+}
+
+// Правила, сработавшие на контакты в тексте: внешние ссылки, ссылки на
+// мессенджеры, телефоны, имена пользователей и внешние ссылки от новых
+// авторов (если checkNewAuthor). Политики с пустым действием не применяются
+func (bot *Bot) contactRules(network string, comment db.Comment, checkNewAuthor bool) []SpamRule {
+	conf := bot.conf.Spam.Contacts
+	if !conf.Enabled {
+		return nil
+	}
+
+	contacts := extractContacts(comment.Text)
+	if contacts.empty() {
+		return nil
+	}
+
+	var rules []SpamRule
+	add := func(action, description string) {
+		if _, ok := spamActions[action]; ok {
+			rules = append(rules, SpamRule{Type: SPAM_RULE_CONTACT, Pattern: description, Action: action})
+		}
+	}
+
+	var external []contactLink
+	for _, link := range contacts.Links {
+		if !bot.isAllowedLink(link) {
+			external = append(external, link)
+		}
+	}
+
+	for _, link := range external {
+		if domainMatches(link.Domain, messengerDomains) {
+			add(conf.MessengerAction, "ссылка на мессенджер "+link.URL)
+		} else {
+			add(conf.LinksAction, "внешняя ссылка "+link.URL)
+		}
+	}
+	if len(contacts.Phones) > 0 {
+		add(conf.PhonesAction, "телефон "+contacts.Phones[0])
+	}
+	if len(contacts.Handles) > 0 {
+		add(conf.HandlesAction, "контакт "+contacts.Handles[0])
+	}
+
+	if checkNewAuthor && len(external) > 0 && conf.NewAuthorAction != "" && bot.isNewAuthor(network, comment) {
+		add(conf.NewAuthorAction, "ссылка от нового автора "+external[0].URL)
+	}
+
+	return rules
+}
+
+// Описание контактов для /spamrule test
+func describeContacts(contacts commentContacts) string {
+	var parts []string
+	for _, link := range contacts.Links {
+		parts = append(parts, "ссылка "+link.URL)
+	}
+	for _, phone := range contacts.Phones {
+		parts = append(parts, "телефон "+phone)
+	}
+	parts = append(parts, contacts.Handles...)
+
+	return fmt.Sprintf("Найдено: %s", strings.Join(parts, ", "))
+}
@@ -0,0 +1,413 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+const (
+	DIGEST_ON  = "on"
+	DIGEST_OFF = "off"
+
+	// Сколько отрывков показывать под одним постом
+	DIGEST_EXCERPTS_PER_POST = 5
+)
+
+// Собираются ли комментарии группы в дайджест
+func (bot *Bot) isDigestGroup(group db.MonitoredGroup) bool {
+	switch group.Digest {
+	case DIGEST_ON:
+		return true
+	case DIGEST_OFF:
+		return false
+	default:
+		return bot.conf.Digest.Enabled
+	}
+}
+
+// Часовой пояс расписания. Если он не задан или неверен - местное время
+func (bot *Bot) scheduleLocation() *time.Location {
+	loc, err := time.LoadLocation(bot.conf.Schedule.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Запускает периодическую отправку дайджестов
+func (bot *Bot) StartDigests(ctx context.Context) {
+	bot.wg.Add(1)
+	go func() {
+		defer bot.wg.Done()
+
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		lastSent := time.Now()
+		lastSlot := ""
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				slot, due := bot.digestDue(now, lastSent, lastSlot)
+				if !due || !bot.isNotificationAllowed() {
+					continue
+				}
+
+				// Неотправленные комментарии остаются в буфере до следующего
+				// дайджеста, поэтому и при ошибке ждем следующего срока
+				if err := bot.sendDigest(ctx); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("Ошибка отправки дайджеста: %s", err)
+				}
+				lastSent, lastSlot = now, slot
+			}
+		}
+	}()
+}
+
+// Пора ли отправлять дайджест. При отправке по времени возвращает метку
+// слота ("2006-01-02 15:04"), чтобы не отправить дважды за одну минуту
+func (bot *Bot) digestDue(now, lastSent time.Time, lastSlot string) (string, bool) {
+	if len(bot.conf.Digest.Times) > 0 {
+		local := now.In(bot.scheduleLocation())
+		current := local.Format("15:04")
+		for _, t := range bot.conf.Digest.Times {
+			slot := local.Format("2006-01-02 ") + t
+			if t == current && slot != lastSlot {
+				return slot, true
+			}
+		}
+		return lastSlot, false
+	}
+
+	interval := time.Duration(bot.conf.Digest.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		return "", false
+	}
+
+	return "", now.Sub(lastSent) >= interval
+}
+
+// Отрывок комментария для дайджеста в одну строку
+func (bot *Bot) digestExcerpt(comment db.Comment) string {
+	text := strings.Join(strings.Fields(processCommentText(comment)), " ")
+	if len(comment.Attachments) > 0 {
+		text = strings.TrimSpace(text + " 📎 " + attachmentSummary(comment))
+	}
+
+	limit := bot.conf.Digest.ExcerptLength
+	if limit > 0 && utf8.RuneCountInString(text) > limit {
+		text = string([]rune(text)[:limit]) + "…"
+	}
+
+	return escapeMarkdown(text)
+}
+
+// Комментарии одной группы в дайджесте
+type digestGroup struct {
+	Group    db.MonitoredGroup
+	Comments []db.Comment // Упорядочены по посту и времени
+}
+
+// Формирует дайджест. Длинный дайджест делится на несколько сообщений
+// по границам постов
+func (bot *Bot) constructDigest(groups []digestGroup) []string {
+	total := 0
+	for _, group := range groups {
+		total += len(group.Comments)
+	}
+
+	header := fmt.Sprintf("📰 *Дайджест комментариев*: %d в %d группах\n", total, len(groups))
+
+	var messages []string
+	current := header
+	add := func(block string) {
+		if utf16Len(renderMarkup(current+block, "")) > TELEGRAM_MESSAGE_LIMIT-100 && current != header {
+			messages = append(messages, current)
+			current = "📰 *Дайджест комментариев* (продолжение)\n"
+		}
+		current += block
+	}
+
+	for _, group := range groups {
+		icon := networkIcons[group.Group.Network]
+		add(fmt.Sprintf("\n%s *%s* (%s): %d\n",
+			icon, escapeMarkdown(group.Group.GroupName), group.Group.Network, len(group.Comments)))
+
+		for start := 0; start < len(group.Comments); {
+			// Ссылка первого комментария: у Телеграма она ведет на сам комментарий
+			post, postURL := postKey(group.Comments[start]), group.Comments[start].PostURL
+			end := start
+			for end < len(group.Comments) && postKey(group.Comments[end]) == post {
+				end++
+			}
+			postComments := group.Comments[start:end]
+			start = end
+
+			first := postComments[0]
+			bot.attachPostContext(group.Group, &first)
+
+			block := fmt.Sprintf("[Пост](%s): %d\n", postURL, len(postComments))
+			if excerpt := postExcerpt(first.PostText); excerpt != "" {
+				block = fmt.Sprintf("[Пост](%s) «%s»: %d\n", postURL, escapeMarkdown(excerpt), len(postComments))
+			}
+			for i, comment := range postComments {
+				if i == DIGEST_EXCERPTS_PER_POST {
+					block += fmt.Sprintf("…и еще %d\n", len(postComments)-i)
+					break
+				}
+				marker := "•"
+				if emoji, ok := moodEmoji[commentMood(comment)]; ok {
+					marker = emoji
+				}
+				block += fmt.Sprintf("%s *%s*: %s\n", marker, escapeMarkdown(comment.Author), bot.digestExcerpt(comment))
+			}
+			add(block)
+		}
+	}
+
+	return append(messages, current)
+}
+
+// Отправляет накопленные комментарии дайджестом в чаты их групп и
+// очищает буфер. Если отправка прервана, буфер сохраняется до следующего раза
+func (bot *Bot) sendDigest(ctx context.Context) error {
+	until := time.Now().Unix()
+	comments, err := bot.db.GetDigestComments(until)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	// Группы, комментарии которых можно убрать из буфера. Комментарии групп,
+	// дайджест которых не дошел, останутся до следующего дайджеста
+	var delivered []int64
+
+	// Комментарии упорядочены по группе: собираем их по группам и чатам
+	var targets []notificationTarget
+	byTarget := make(map[notificationTarget][]digestGroup)
+	for start := 0; start < len(comments); {
+		groupID := comments[start].GroupID
+		end := start
+		for end < len(comments) && comments[end].GroupID == groupID {
+			end++
+		}
+		groupComments := comments[start:end]
+		start = end
+
+		group, err := bot.db.GetGroupByInternalID(fmt.Sprintf("%d", groupID))
+		if err != nil || group == nil {
+			log.Printf("Группа ID %d для дайджеста не найдена, пропускаем %d комментариев", groupID, len(groupComments))
+			delivered = append(delivered, groupID)
+			continue
+		}
+
+		if err := bot.ensureGroupTopic(ctx, group); err != nil {
+			log.Printf("Топик группы %s: %s. Отправляем в общий раздел", group.GroupName, err)
+		}
+
+		target := bot.groupTarget(*group)
+		if _, ok := byTarget[target]; !ok {
+			targets = append(targets, target)
+		}
+		byTarget[target] = append(byTarget[target], digestGroup{Group: *group, Comments: groupComments})
+	}
+
+	failed := 0
+	for _, target := range targets {
+		sent := true
+		for _, text := range bot.constructDigest(byTarget[target]) {
+			params := &telego.SendMessageParams{
+				ChatID:          telego.ChatID{ID: target.ChatID},
+				MessageThreadID: target.ThreadID,
+			}
+			if _, err := bot.sendMarkup(ctx, params, text); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Ошибка отправки дайджеста в %s: %s. Комментарии останутся до следующего дайджеста", target, err)
+				for _, group := range byTarget[target] {
+					bot.forgetDeletedTopic(&group.Group, target, err)
+				}
+				sent = false
+				break
+			}
+		}
+
+		for _, group := range byTarget[target] {
+			if sent {
+				delivered = append(delivered, group.Group.ID)
+			} else {
+				failed += len(group.Comments)
+			}
+		}
+	}
+
+	for _, groupID := range delivered {
+		if err := bot.db.ClearDigest(groupID, until); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Отправлен дайджест: %d комментариев", len(comments)-failed)
+	if failed > 0 {
+		return fmt.Errorf("не отправлено %d комментариев", failed)
+	}
+	return nil
+}
+
+func (bot *Bot) Digest(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+
+	switch len(parts) {
+	case 1:
+		status := "выключен"
+		if bot.conf.Digest.Enabled {
+			status = "включен"
+		}
+		schedule := fmt.Sprintf("каждые %d мин", bot.conf.Digest.IntervalMinutes)
+		if len(bot.conf.Digest.Times) > 0 {
+			schedule = "в " + strings.Join(bot.conf.Digest.Times, ", ")
+		}
+		bot.answerBack(message, fmt.Sprintf(
+			"*Дайджест для всех групп*: %s\n*Отправка*: %s\n\n"+
+				"Используйте: /digest on|off или /digest <сеть> <ID группы> on|off|default",
+			status, schedule), true)
+		return
+
+	case 2:
+		mode := strings.ToLower(parts[1])
+		if mode != DIGEST_ON && mode != DIGEST_OFF {
+			bot.sendError(message, "Используйте: /digest on|off")
+			return
+		}
+
+		bot.conf.Digest.Enabled = mode == DIGEST_ON
+		bot.conf.Update()
+
+		if bot.conf.Digest.Enabled {
+			bot.sendSuccess(message, "Комментарии групп без отдельной настройки собираются в дайджест")
+		} else {
+			bot.sendSuccess(message, "Комментарии групп без отдельной настройки отправляются сразу")
+		}
+		return
+	}
+
+	if len(parts) < 4 {
+		bot.sendError(message, "Неверный формат. Используйте: /digest <сеть> <ID группы> on|off|default")
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+
+	mode := strings.ToLower(parts[3])
+	switch mode {
+	case DIGEST_ON, DIGEST_OFF:
+	case "default":
+		mode = ""
+	default:
+		bot.sendError(message, "Режим должен быть on, off или default")
+		return
+	}
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	if err := bot.db.SetGroupDigest(group.ID, mode); err != nil {
+		bot.sendError(message, "Ошибка сохранения режима: "+err.Error())
+		return
+	}
+
+	group.Digest = mode
+	if bot.isDigestGroup(*group) {
+		bot.sendSuccess(message, "Комментарии группы "+escapeMarkdown(group.GroupName)+" собираются в дайджест")
+	} else {
+		bot.sendSuccess(message, "Комментарии группы "+escapeMarkdown(group.GroupName)+" отправляются сразу")
+	}
+}
+
+func (bot *Bot) SetDigestSchedule(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 2 {
+		bot.sendError(message, "Неверный формат. Используйте: /setdigestschedule <минуты> или /setdigestschedule 09:00 18:00")
+		return
+	}
+
+	if minutes, err := strconv.Atoi(parts[1]); err == nil {
+		if minutes <= 0 {
+			bot.sendError(message, "Интервал должен быть больше нуля")
+			return
+		}
+
+		bot.conf.Digest.IntervalMinutes = minutes
+		bot.conf.Digest.Times = []string{}
+		bot.conf.Update()
+
+		bot.sendSuccess(message, fmt.Sprintf("Дайджест будет отправляться каждые %d мин", minutes))
+		return
+	}
+
+	var times []string
+	for _, t := range parts[1:] {
+		if !isValidTime(t) {
+			bot.sendError(message, "Неверный формат времени: "+t+". Используйте HH:MM")
+			return
+		}
+
+		// Приводим 9:00 к 09:00, чтобы время совпадало при сравнении
+		parsed, _ := time.Parse("15:04", t)
+		times = append(times, parsed.Format("15:04"))
+	}
+
+	bot.conf.Digest.Times = times
+	bot.conf.Update()
+
+	bot.sendSuccess(message, "Дайджест будет отправляться в "+strings.Join(times, ", "))
+}
+
+func (bot *Bot) SendDigestNow(message *telego.Message) {
+	if err := bot.sendDigest(bot.ctx); err != nil {
+		bot.sendError(message, "Ошибка отправки дайджеста: "+err.Error())
+		return
+	}
+
+	bot.sendSuccess(message, "Дайджест отправлен")
+}
@@ -0,0 +1,445 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+const (
+	FLOOD_DEFAULT_WINDOW_MINUTES        = 30
+	FLOOD_DEFAULT_SIMILARITY            = 0.7
+	FLOOD_DEFAULT_MIN_TEXT_LENGTH       = 15
+	FLOOD_DEFAULT_AUTHOR_LIMIT          = 5
+	FLOOD_DEFAULT_AUTHOR_WINDOW_MINUTES = 10
+
+	// Сколько хранятся серии после последнего повтора
+	FLOOD_CLUSTER_TTL = 24 * time.Hour
+	// Сколько авторов перечисляется в оповещении о серии
+	FLOOD_AUTHORS_SHOWN = 5
+
+	CALLBACK_FLOOD = "flood:"
+)
+
+func (bot *Bot) floodWindow() int64 {
+	if m := bot.conf.Spam.Flood.WindowMinutes; m > 0 {
+		return int64(m) * 60
+	}
+	return FLOOD_DEFAULT_WINDOW_MINUTES * 60
+}
+
+func (bot *Bot) floodSimilarity() float64 {
+	if s := bot.conf.Spam.Flood.Similarity; s > 0 && s <= 1 {
+		return s
+	}
+	return FLOOD_DEFAULT_SIMILARITY
+}
+
+func (bot *Bot) floodMinTextLength() int {
+	if n := bot.conf.Spam.Flood.MinTextLength; n > 0 {
+		return n
+	}
+	return FLOOD_DEFAULT_MIN_TEXT_LENGTH
+}
+
+func (bot *Bot) floodAuthorLimit() int {
+	if n := bot.conf.Spam.Flood.AuthorLimit; n > 0 {
+		return n
+	}
+	return FLOOD_DEFAULT_AUTHOR_LIMIT
+}
+
+func (bot *Bot) floodAuthorWindow() int64 {
+	if m := bot.conf.Spam.Flood.AuthorWindowMinutes; m > 0 {
+		return int64(m) * 60
+	}
+	return FLOOD_DEFAULT_AUTHOR_WINDOW_MINUTES * 60
+}
+
+// Триграммы нормализованного текста (см. normalizeSpamText)
+func trigrams(text string) map[string]bool {
+	runes := []rune(text)
+	grams := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = true
+	}
+	return grams
+}
+
+// Похожесть нормализованных текстов от 0 до 1: доля общих триграмм
+// (коэффициент Жаккара). Переставленные или замененные слова снижают
+// ее понемногу, поэтому слегка измененные копии остаются похожими
+func textSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	gramsA, gramsB := trigrams(a), trigrams(b)
+	if len(gramsA) == 0 || len(gramsB) == 0 {
+		return 0
+	}
+
+	common := 0
+	for gram := range gramsA {
+		if gramsB[gram] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(gramsA)+len(gramsB)-common)
+}
+
+// Ищет серию повторов одного текста. Если серии еще нет, но в окне есть
+// похожие комментарии, возвращает новую серию и ключи этих комментариев
+func (bot *Bot) textFloodCluster(group db.MonitoredGroup, comment db.Comment, recent []db.KeyedComment, at int64) (*db.FloodCluster, []int64) {
+	normalized := normalizeSpamText(comment.Text)
+	if utf8.RuneCountInString(normalized) < bot.floodMinTextLength() {
+		return nil, nil
+	}
+
+	since := at - bot.floodWindow()
+	threshold := bot.floodSimilarity()
+
+	clusters, err := bot.db.GetFloodClusters(group.ID, db.FLOOD_TEXT, since)
+	if err != nil {
+		log.Printf("Ошибка получения серий флуда: %s", err)
+		return nil, nil
+	}
+	for _, cluster := range clusters {
+		if textSimilarity(normalized, cluster.Signature) >= threshold {
+			return &cluster, nil
+		}
+	}
+
+	var earlier []int64
+	for _, other := range recent {
+		if other.ID == comment.ID || other.Timestamp < since {
+			continue
+		}
+		if textSimilarity(normalized, normalizeSpamText(other.Text)) >= threshold {
+			earlier = append(earlier, other.Key)
+		}
+	}
+	if len(earlier) == 0 {
+		return nil, nil
+	}
+
+	return &db.FloodCluster{
+		GroupID:   group.ID,
+		Kind:      db.FLOOD_TEXT,
+		Signature: normalized,
+	}, earlier
+}
+
+// Ищет серию частых комментариев автора. Серия начинается, когда у автора
+// в окне больше floodAuthorLimit комментариев, и включает их все
+func (bot *Bot) authorFloodCluster(group db.MonitoredGroup, comment db.Comment, recent []db.KeyedComment, at int64) (*db.FloodCluster, []int64) {
+	author := authorKey(comment)
+	if author == "" {
+		return nil, nil
+	}
+
+	since := at - bot.floodAuthorWindow()
+	var earlier []int64
+	for _, other := range recent {
+		if other.ID != comment.ID && other.Timestamp >= since && authorKey(other.Comment) == author {
+			earlier = append(earlier, other.Key)
+		}
+	}
+	if len(earlier) < bot.floodAuthorLimit() {
+		return nil, nil
+	}
+
+	clusters, err := bot.db.GetFloodClusters(group.ID, db.FLOOD_AUTHOR, since)
+	if err != nil {
+		log.Printf("Ошибка получения серий флуда: %s", err)
+		return nil, nil
+	}
+	for _, cluster := range clusters {
+		if cluster.Signature == author {
+			return &cluster, nil
+		}
+	}
+
+	return &db.FloodCluster{
+		GroupID:   group.ID,
+		Kind:      db.FLOOD_AUTHOR,
+		Signature: author,
+	}, earlier
+}
+
+// Проверяет, не повтор ли комментарий. Повтор сохраняется в серию, а вместо
+// отдельного оповещения обновляется общее оповещение о серии. Возвращает
+// true, если комментарий свернут и оповещать о нем не нужно
+func (bot *Bot) collapseFlood(ctx context.Context, group db.MonitoredGroup, comment db.Comment) bool {
+	if !bot.conf.Spam.Flood.Enabled {
+		return false
+	}
+
+	at := comment.Timestamp
+	if at == 0 {
+		at = time.Now().Unix()
+	}
+
+	recent, err := bot.db.GetRecentComments(group.ID, at-max(bot.floodWindow(), bot.floodAuthorWindow()))
+	if err != nil {
+		log.Printf("Ошибка получения недавних комментариев %s: %s", group.GroupName, err)
+		return false
+	}
+
+	cluster, earlier := bot.textFloodCluster(group, comment, recent, at)
+	if cluster == nil {
+		cluster, earlier = bot.authorFloodCluster(group, comment, recent, at)
+	}
+	if cluster == nil {
+		return false
+	}
+
+	comment.Network = group.Network
+	key, err := bot.db.SaveSentComment(&group, &comment, time.Now().Unix())
+	if err == nil {
+		err = bot.db.SetCommentStatus(key, ACTION_FLOOD, "", time.Now().Unix())
+	}
+	if err != nil {
+		log.Printf("Ошибка сохранения повторного комментария %s: %s", comment.ID, err)
+		return false
+	}
+
+	if cluster.ID == 0 {
+		cluster.FirstAt, cluster.LastAt = at, at
+		if _, err := bot.db.CreateFloodCluster(cluster); err != nil {
+			log.Printf("Ошибка создания серии флуда: %s", err)
+			return false
+		}
+	}
+
+	for _, earlierKey := range append(earlier, key) {
+		// Время первых комментариев серии берется из их записей
+		added := at
+		for _, other := range recent {
+			if other.Key == earlierKey {
+				added = other.Timestamp
+			}
+		}
+		if err := bot.db.AddFloodComment(cluster.ID, earlierKey, added); err != nil {
+			log.Printf("Ошибка добавления комментария в серию флуда: %s", err)
+		}
+	}
+
+	log.Printf("Комментарий в %s свернут в серию флуда %d: %s", group.GroupName, cluster.ID, comment.Text)
+	bot.updateFloodNotification(ctx, group, cluster.ID)
+
+	return true
+}
+
+// Кнопки под оповещением о серии
+func floodKeyboard(clusterID int64) *telego.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return fmt.Sprintf("%s%s:%d", CALLBACK_FLOOD, action, clusterID)
+	}
+
+	return tu.InlineKeyboard(
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("✅ Обработано").WithCallbackData(data(ACTION_HANDLED)),
+			tu.InlineKeyboardButton("🚫 Все спам").WithCallbackData(data(ACTION_SPAM)),
+		),
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("🚷 Спам, блокировать авторов").WithCallbackData(data(ACTION_BLOCK)),
+		),
+	)
+}
+
+// Текст оповещения о серии
+func (bot *Bot) constructFloodMessage(group db.MonitoredGroup, cluster db.FloodCluster, stats db.FloodStats, comments []db.Comment) string {
+	icon := networkIcons[group.Network]
+	text := fmt.Sprintf("🔁 *Флуд* в %s *%s*\n", icon, escapeMarkdown(group.GroupName))
+
+	period := formatDuration(time.Duration(cluster.LastAt-cluster.FirstAt) * time.Second)
+	if cluster.Kind == db.FLOOD_AUTHOR {
+		text += fmt.Sprintf("Автор *%s* оставил комментариев: %d, под постами: %d, за %s\n",
+			escapeMarkdown(comments[0].Author), stats.Comments, stats.Posts, period)
+	} else {
+		text += fmt.Sprintf("Похожий текст опубликован раз: %d, авторов: %d, постов: %d, за %s\n",
+			stats.Comments, stats.Authors, stats.Posts, period)
+
+		var authors []string
+		seen := make(map[string]bool)
+		for _, comment := range comments {
+			if seen[authorKey(comment)] {
+				continue
+			}
+			seen[authorKey(comment)] = true
+			if len(authors) < FLOOD_AUTHORS_SHOWN {
+				authors = append(authors, escapeMarkdown(comment.Author))
+			}
+		}
+		text += "Авторы: " + strings.Join(authors, ", ")
+		if len(seen) > len(authors) {
+			text += fmt.Sprintf(" и еще %d", len(seen)-len(authors))
+		}
+		text += "\n"
+	}
+
+	last := comments[len(comments)-1]
+	text += fmt.Sprintf("\nПоследний: %s", bot.digestExcerpt(last))
+	if strings.HasPrefix(last.PostURL, "http") {
+		text += fmt.Sprintf("\n[Пост](%s)", last.PostURL)
+	}
+
+	if label, ok := actionLabels[cluster.Status]; ok {
+		text += fmt.Sprintf("\n\n%s: %s", label, escapeMarkdown(cluster.HandledBy))
+	}
+
+	return text
+}
+
+// Отправляет или обновляет оповещение о серии
+func (bot *Bot) updateFloodNotification(ctx context.Context, group db.MonitoredGroup, clusterID int64) {
+	cluster, err := bot.db.GetFloodCluster(clusterID)
+	if err != nil || cluster == nil {
+		log.Printf("Серия флуда %d не найдена: %v", clusterID, err)
+		return
+	}
+	stats, err := bot.db.GetFloodStats(clusterID)
+	if err != nil {
+		log.Printf("Ошибка подсчета серии флуда %d: %s", clusterID, err)
+		return
+	}
+	comments, err := bot.db.GetFloodComments(clusterID)
+	if err != nil || len(comments) == 0 {
+		log.Printf("Ошибка получения комментариев серии флуда %d: %v", clusterID, err)
+		return
+	}
+
+	text := bot.constructFloodMessage(group, *cluster, stats, comments)
+	var keyboard *telego.InlineKeyboardMarkup
+	if cluster.Status == "" {
+		keyboard = floodKeyboard(clusterID)
+	}
+
+	if cluster.ChatID != 0 {
+		params := &telego.EditMessageTextParams{
+			ChatID:      telego.ChatID{ID: cluster.ChatID},
+			MessageID:   cluster.MessageID,
+			ReplyMarkup: keyboard,
+		}
+		if _, err := bot.editMarkup(ctx, params, text); err != nil && !strings.Contains(err.Error(), "not modified") {
+			log.Printf("Ошибка обновления оповещения о серии флуда %d: %s", clusterID, err)
+		}
+		return
+	}
+
+	if err := bot.ensureGroupTopic(ctx, &group); err != nil {
+		log.Printf("Топик группы %s: %s. Отправляем в общий раздел", group.GroupName, err)
+	}
+	target := bot.groupTarget(group)
+	params := &telego.SendMessageParams{
+		ChatID:          telego.ChatID{ID: target.ChatID},
+		MessageThreadID: target.ThreadID,
+		ReplyMarkup:     keyboard,
+	}
+	msg, err := bot.sendMarkup(ctx, params, text)
+	if err != nil {
+		log.Printf("Ошибка отправки оповещения о серии флуда %d: %s", clusterID, err)
+		bot.forgetDeletedTopic(&group, target, err)
+		return
+	}
+
+	if err := bot.db.SetFloodNotification(clusterID, msg.Chat.ID, msg.MessageID); err != nil {
+		log.Printf("Ошибка сохранения оповещения о серии флуда %d: %s", clusterID, err)
+	}
+}
+
+// Кнопки под оповещением о серии: действие применяется ко всем ее комментариям
+func (bot *Bot) handleFloodCallback(query *telego.CallbackQuery, arg string) string {
+	action, idArg, found := strings.Cut(arg, ":")
+	clusterID, err := strconv.ParseInt(idArg, 10, 64)
+	if !found || err != nil {
+		return "Некорректная кнопка"
+	}
+
+	cluster, err := bot.db.GetFloodCluster(clusterID)
+	if err != nil {
+		log.Printf("Ошибка получения серии флуда %d: %s", clusterID, err)
+		return "Ошибка получения серии"
+	}
+	if cluster == nil {
+		return "Серия больше не хранится"
+	}
+	if cluster.Status != "" {
+		return "Серия уже обработана"
+	}
+
+	group, err := bot.db.GetGroupByInternalID(fmt.Sprintf("%d", cluster.GroupID))
+	if err != nil || group == nil {
+		return "Группа серии не найдена"
+	}
+
+	keys, err := bot.db.GetFloodCommentKeys(clusterID)
+	if err != nil {
+		log.Printf("Ошибка получения комментариев серии флуда %d: %s", clusterID, err)
+		return "Ошибка получения комментариев серии"
+	}
+
+	var answer string
+	moderator := formatUserName(&query.From)
+	switch action {
+	case ACTION_HANDLED:
+		answer = "Серия отмечена как обработанная"
+	case ACTION_SPAM, ACTION_BLOCK:
+		for _, key := range keys {
+			comment, err := bot.db.GetCommentByKey(key)
+			if err != nil || comment == nil {
+				continue
+			}
+			if action == ACTION_BLOCK {
+				if err := bot.setAuthorList(group.Network, *comment, db.AUTHOR_BLOCKED, moderator); err != nil {
+					log.Printf("Ошибка добавления автора %s в черный список: %s", comment.Author, err)
+				}
+			}
+			bot.spamFeedback(*comment, true)
+			bot.setCommentStatus(key, comment, ACTION_SPAM, moderator)
+		}
+		answer = fmt.Sprintf("Отмечено как спам: %d", len(keys))
+		if action == ACTION_BLOCK {
+			answer += ", авторы в черном списке"
+		}
+	default:
+		return "Неизвестное действие"
+	}
+
+	if err := bot.db.SetFloodClusterStatus(clusterID, action, moderator); err != nil {
+		log.Printf("Ошибка сохранения состояния серии флуда %d: %s", clusterID, err)
+	}
+	bot.audit(query.From, action, group, nil, fmt.Sprintf("серия флуда %d: %d комментариев", clusterID, len(keys)))
+	bot.updateFloodNotification(bot.ctx, *group, clusterID)
+
+	return answer
+}
@@ -0,0 +1,188 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf16"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+const (
+	// Максимальная длина сообщения Telegram в UTF-16 символах
+	TELEGRAM_MESSAGE_LIMIT = 4096
+	// Сколько символов комментария помещается в оповещение вместе с шаблоном
+	NOTIFICATION_TEXT_LIMIT = 3000
+	// Обрезка по умолчанию, в том числе для конфигов без truncation.max_length
+	NOTIFICATION_TEXT_DEFAULT = 500
+
+	CALLBACK_FULL_TEXT = "full:"
+)
+
+// Обрезается ли текст по настройке. Отрицательный max_length - весь текст
+func (bot *Bot) truncationEnabled() bool {
+	return bot.conf.Truncation.MaxLength >= 0
+}
+
+// Сколько символов текста комментария показывать в оповещении
+func (bot *Bot) notificationTextLimit() int {
+	maxLength := bot.conf.Truncation.MaxLength
+	switch {
+	case maxLength == 0:
+		return NOTIFICATION_TEXT_DEFAULT
+	case maxLength < 0 || maxLength > NOTIFICATION_TEXT_LIMIT:
+		return NOTIFICATION_TEXT_LIMIT
+	}
+
+	return maxLength
+}
+
+// Длина строки так, как ее считает Telegram
+func utf16Len(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Делит текст на части не длиннее limit UTF-16 символов, по возможности
+// по переводу строки или пробелу
+func splitText(text string, limit int) []string {
+	var parts []string
+
+	runes := []rune(text)
+	for len(runes) > 0 {
+		size, end := 0, 0
+		for end < len(runes) && size+utf16.RuneLen(runes[end]) <= limit {
+			size += utf16.RuneLen(runes[end])
+			end++
+		}
+
+		if end < len(runes) {
+			// Ищем место разрыва во второй половине части
+			for i := end - 1; i > end/2; i-- {
+				if runes[i] == '\n' || runes[i] == ' ' {
+					end = i + 1
+					break
+				}
+			}
+		}
+
+		if part := strings.TrimSpace(string(runes[:end])); part != "" {
+			parts = append(parts, part)
+		}
+		runes = runes[end:]
+	}
+
+	return parts
+}
+
+// Отправляет полный текст комментария ответом на оповещение: несколькими
+// сообщениями или файлом .txt, в зависимости от настроек
+func (bot *Bot) sendFullText(ctx context.Context, notification *telego.Message, group db.MonitoredGroup, comment db.Comment) error {
+	chatID := telego.ChatID{ID: notification.Chat.ID}
+	threadID := notification.MessageThreadID
+	reply := &telego.ReplyParameters{MessageID: notification.MessageID, AllowSendingWithoutReply: true}
+
+	if bot.conf.Truncation.LongText == LONG_TEXT_FILE {
+		name := fmt.Sprintf("%s-%s.txt", group.Network, comment.CommentID)
+		_, err := bot.api.SendDocument(ctx, &telego.SendDocumentParams{
+			ChatID:          chatID,
+			MessageThreadID: threadID,
+			Document:        tu.File(tu.NameReader(strings.NewReader(comment.Text), name)),
+			Caption:         fmt.Sprintf("📄 Полный текст комментария (%s)", comment.Author),
+			ReplyParameters: reply,
+		})
+		return err
+	}
+
+	// Оставляем место под нумерацию частей
+	parts := splitText(comment.Text, TELEGRAM_MESSAGE_LIMIT-16)
+	for i, part := range parts {
+		text := part
+		if len(parts) > 1 {
+			text = fmt.Sprintf("(%d/%d)\n%s", i+1, len(parts), part)
+		}
+
+		// Обычным текстом: без разметки текст комментария не нужно экранировать
+		_, err := bot.api.SendMessage(ctx, &telego.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: threadID,
+			Text:            text,
+			ReplyParameters: reply,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Обработка кнопки "Показать полностью": оповещение заменяется полным,
+// если оно помещается в одно сообщение, иначе текст отправляется ответом
+func (bot *Bot) handleFullTextCallback(query *telego.CallbackQuery, arg string) string {
+	key, comment, group, problem := bot.callbackComment(arg)
+	if problem != "" {
+		return problem
+	}
+
+	notification := query.Message.Message()
+	if notification == nil {
+		return "Сообщение с оповещением недоступно"
+	}
+
+	keyboard := bot.notificationKeyboard(key, *comment, false)
+
+	if bot.fitsFullNotification(*group, *comment, notificationLimit(notification)) {
+		if err := bot.editNotification(bot.ctx, notification, bot.notificationWithStatus(*group, *comment, 0), keyboard); err != nil {
+			log.Printf("Ошибка замены оповещения полным текстом: %s", err)
+			return "Не удалось показать текст"
+		}
+		return ""
+	}
+
+	// Убираем кнопку, чтобы текст не отправлялся повторно
+	bot.api.EditMessageReplyMarkup(bot.ctx, &telego.EditMessageReplyMarkupParams{
+		ChatID:      telego.ChatID{ID: notification.Chat.ID},
+		MessageID:   notification.MessageID,
+		ReplyMarkup: keyboard,
+	})
+
+	if err := bot.sendFullText(bot.ctx, notification, *group, *comment); err != nil {
+		log.Printf("Ошибка отправки полного текста комментария: %s", err)
+		return "Не удалось отправить текст"
+	}
+
+	return ""
+}
+
+// Помещается ли оповещение с полным текстом в limit символов
+func (bot *Bot) fitsFullNotification(group db.MonitoredGroup, comment db.Comment, limit int) bool {
+	text := bot.notificationWithStatus(group, comment, 0)
+	return utf16Len(renderMarkup(text, "")) <= limit
+}
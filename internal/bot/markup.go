@@ -0,0 +1,310 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Сообщения бота и шаблоны оповещений пишутся в простой разметке в духе
+// Telegram Markdown (legacy): *жирный*, _курсив_, `код`, ```блок```,
+// [текст](ссылка), \ экранирует следующий символ. Перед отправкой разметка
+// разбирается на сегменты и переводится в HTML или MarkdownV2 с полным
+// экранированием, а при отказе Telegram - в обычный текст
+
+type segmentKind int
+
+const (
+	segText segmentKind = iota
+	segBold
+	segItalic
+	segCode
+	segPre
+	segLink
+)
+
+type segment struct {
+	kind segmentKind
+	text string
+	url  string
+}
+
+const (
+	PARSE_MODE_HTML       = "HTML"
+	PARSE_MODE_MARKDOWNV2 = "MarkdownV2"
+)
+
+// Разбирает разметку. В строгом режиме незакрытая сущность - ошибка,
+// иначе ее открывающий символ считается обычным текстом
+func parseMarkup(text string, strict bool) ([]segment, error) {
+	runes := []rune(text)
+	var segments []segment
+	var plain strings.Builder
+
+	emit := func(kind segmentKind, text, url string) {
+		if kind == segText {
+			plain.WriteString(text)
+			return
+		}
+		if plain.Len() > 0 {
+			segments = appendSegment(segments, segment{kind: segText, text: plain.String()})
+			plain.Reset()
+		}
+		segments = appendSegment(segments, segment{kind: kind, text: text, url: url})
+	}
+
+	// Совпадает ли текст с delim на позиции i. Без выделения памяти:
+	// поиск разделителей вызывается для каждого символа разметки
+	matchesAt := func(i int, delim string) bool {
+		for _, r := range delim {
+			if i >= len(runes) || runes[i] != r {
+				return false
+			}
+			i++
+		}
+		return true
+	}
+
+	// Позиция, начиная с которой delim уже не нашелся. Без этого текст из
+	// одних незакрытых "[" разбирается за квадратичное время
+	missedFrom := make(map[string]int)
+
+	// Ищет delim начиная с from. Если escapes, пропускает экранированные символы
+	closing := func(from int, delim string, escapes bool) int {
+		if missed, ok := missedFrom[delim]; ok && from >= missed && (from == 0 || runes[from-1] != '\\') {
+			return -1
+		}
+
+		for i := from; i < len(runes); i++ {
+			if escapes && runes[i] == '\\' {
+				i++
+				continue
+			}
+			if matchesAt(i, delim) {
+				return i
+			}
+		}
+
+		if missed, ok := missedFrom[delim]; !ok || from < missed {
+			missedFrom[delim] = from
+		}
+		return -1
+	}
+
+	unclosed := func(what string, pos int) error {
+		return fmt.Errorf("незакрытый %s на позиции %d", what, pos)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			emit(segText, string(runes[i]), "")
+		case '*', '_':
+			end := closing(i+1, string(runes[i]), true)
+			if end == -1 {
+				if strict {
+					return nil, unclosed(fmt.Sprintf("'%c'", runes[i]), i)
+				}
+				emit(segText, string(runes[i]), "")
+				continue
+			}
+
+			kind := segBold
+			if runes[i] == '_' {
+				kind = segItalic
+			}
+			emit(kind, unescapeMarkup(string(runes[i+1:end])), "")
+			i = end
+		case '`':
+			delim, kind := "`", segCode
+			if matchesAt(i, "```") {
+				delim, kind = "```", segPre
+			}
+			start := i + len([]rune(delim))
+			end := closing(start, delim, false)
+			if end == -1 {
+				if strict {
+					return nil, unclosed(fmt.Sprintf("'%s'", delim), i)
+				}
+				emit(segText, string(runes[i:start]), "")
+				i = start - 1
+				continue
+			}
+
+			emit(kind, string(runes[start:end]), "")
+			i = end + len([]rune(delim)) - 1
+		case '[':
+			textEnd := closing(i+1, "](", true)
+			urlEnd := -1
+			if textEnd != -1 {
+				urlEnd = closing(textEnd+2, ")", false)
+			}
+			if urlEnd == -1 {
+				if strict {
+					return nil, unclosed("'['", i)
+				}
+				emit(segText, "[", "")
+				continue
+			}
+
+			emit(segLink, unescapeMarkup(string(runes[i+1:textEnd])), strings.TrimSpace(string(runes[textEnd+2:urlEnd])))
+			i = urlEnd
+		default:
+			emit(segText, string(runes[i]), "")
+		}
+	}
+
+	if plain.Len() > 0 {
+		segments = appendSegment(segments, segment{kind: segText, text: plain.String()})
+	}
+
+	return segments, nil
+}
+
+// Добавляет сегмент, склеивая соседние однотипные (кроме ссылок)
+func appendSegment(segments []segment, seg segment) []segment {
+	if seg.text == "" {
+		return segments
+	}
+
+	if n := len(segments); n > 0 && seg.kind != segLink && segments[n-1].kind == seg.kind {
+		segments[n-1].text += seg.text
+		return segments
+	}
+
+	return append(segments, seg)
+}
+
+func unescapeMarkup(text string) string {
+	if !strings.Contains(text, "\\") {
+		return text
+	}
+
+	runes := []rune(text)
+	var out strings.Builder
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+		}
+		out.WriteRune(runes[i])
+	}
+
+	return out.String()
+}
+
+// Проверяет, что в тексте нет незакрытых сущностей разметки
+func validateMarkdown(text string) error {
+	_, err := parseMarkup(text, true)
+	return err
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+func segmentsToHTML(segments []segment) string {
+	var out strings.Builder
+	for _, seg := range segments {
+		text := htmlEscaper.Replace(seg.text)
+		switch seg.kind {
+		case segBold:
+			out.WriteString("<b>" + text + "</b>")
+		case segItalic:
+			out.WriteString("<i>" + text + "</i>")
+		case segCode:
+			out.WriteString("<code>" + text + "</code>")
+		case segPre:
+			out.WriteString("<pre>" + text + "</pre>")
+		case segLink:
+			out.WriteString("<a href=\"" + htmlEscaper.Replace(seg.url) + "\">" + text + "</a>")
+		default:
+			out.WriteString(text)
+		}
+	}
+
+	return out.String()
+}
+
+// Символы, которые в MarkdownV2 нужно экранировать вне сущностей кода
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+func escapeMarkdownV2(text string, reserved string) string {
+	var out strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(reserved, r) {
+			out.WriteRune('\\')
+		}
+		out.WriteRune(r)
+	}
+
+	return out.String()
+}
+
+func segmentsToMarkdownV2(segments []segment) string {
+	var out strings.Builder
+	for _, seg := range segments {
+		switch seg.kind {
+		case segBold:
+			out.WriteString("*" + escapeMarkdownV2(seg.text, markdownV2Reserved) + "*")
+		case segItalic:
+			out.WriteString("_" + escapeMarkdownV2(seg.text, markdownV2Reserved) + "_")
+		case segCode:
+			out.WriteString("`" + escapeMarkdownV2(seg.text, "`\\") + "`")
+		case segPre:
+			out.WriteString("```\n" + escapeMarkdownV2(seg.text, "`\\") + "```")
+		case segLink:
+			out.WriteString(
+				"[" + escapeMarkdownV2(seg.text, markdownV2Reserved) + "](" +
+					escapeMarkdownV2(seg.url, ")\\") + ")",
+			)
+		default:
+			out.WriteString(escapeMarkdownV2(seg.text, markdownV2Reserved))
+		}
+	}
+
+	return out.String()
+}
+
+func segmentsToPlain(segments []segment) string {
+	var out strings.Builder
+	for _, seg := range segments {
+		out.WriteString(seg.text)
+		if seg.kind == segLink && seg.url != "" && seg.url != seg.text {
+			out.WriteString(" (" + seg.url + ")")
+		}
+	}
+
+	return out.String()
+}
+
+// Переводит разметку в текст для parseMode. Пустой parseMode - обычный текст
+func renderMarkup(text string, parseMode string) string {
+	segments, _ := parseMarkup(text, false)
+
+	switch parseMode {
+	case PARSE_MODE_MARKDOWNV2:
+		return segmentsToMarkdownV2(segments)
+	case PARSE_MODE_HTML:
+		return segmentsToHTML(segments)
+	default:
+		return segmentsToPlain(segments)
+	}
+}
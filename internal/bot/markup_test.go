@@ -0,0 +1,215 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Тексты комментариев, на которых раньше ломалась разметка
+var markupSeeds = []string{
+	"",
+	"Заказ_123 *срочно* `важно`",
+	"[ссылка](https://vk.ru/wall-1_1)",
+	"a\\b\\\\c\\",
+	"_*`[]()~>#+-=|{}.!",
+	"```\nкод ` \\ ```",
+	"*незакрытый _курсив [ссылка](",
+	"<b>&amp;\"кавычки\"</b>",
+	"эмодзи 👍🏻 и ​невидимые символы",
+	"[текст](tg://user?id=123)",
+	"[](пустой) [a]() ****",
+}
+
+// Видимый текст сегментов: то, что увидит пользователь в Telegram
+func segmentsText(segments []segment) string {
+	var out strings.Builder
+	for _, seg := range segments {
+		out.WriteString(seg.text)
+	}
+	return out.String()
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func htmlVisibleText(text string) string {
+	return html.UnescapeString(htmlTag.ReplaceAllString(text, ""))
+}
+
+// Разбирает MarkdownV2 так же строго, как Telegram: зарезервированный
+// символ вне сущности без экранирования - ошибка. Возвращает видимый текст
+func markdownV2VisibleText(text string) (string, error) {
+	runes := []rune(text)
+	var out strings.Builder
+	inLink := false
+
+	hasPrefixAt := func(i int, prefix string) bool {
+		for _, r := range prefix {
+			if i >= len(runes) || runes[i] != r {
+				return false
+			}
+			i++
+		}
+		return true
+	}
+
+	// Читает сущность кода до закрывающего разделителя
+	readCode := func(i int, closing string) (int, error) {
+		for ; i < len(runes); i++ {
+			switch {
+			case runes[i] == '\\' && i+1 < len(runes):
+				i++
+				out.WriteRune(runes[i])
+			case hasPrefixAt(i, closing):
+				return i + len([]rune(closing)) - 1, nil
+			case runes[i] == '`' || runes[i] == '\\':
+				return 0, fmt.Errorf("неэкранированный %q в коде", runes[i])
+			default:
+				out.WriteRune(runes[i])
+			}
+		}
+		return 0, fmt.Errorf("незакрытый код")
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 == len(runes) {
+				return "", fmt.Errorf("\\ в конце текста")
+			}
+			i++
+			out.WriteRune(runes[i])
+
+		case hasPrefixAt(i, "```\n"):
+			end, err := readCode(i+4, "```")
+			if err != nil {
+				return "", err
+			}
+			i = end
+
+		case r == '`':
+			end, err := readCode(i+1, "`")
+			if err != nil {
+				return "", err
+			}
+			i = end
+
+		case r == '*' || r == '_':
+			// Разделители жирного и курсива не видны
+
+		case r == '[' && !inLink:
+			inLink = true
+
+		case r == ']' && inLink:
+			if i+1 == len(runes) || runes[i+1] != '(' {
+				return "", fmt.Errorf("ссылка без адреса")
+			}
+			i += 2
+			for ; i < len(runes) && runes[i] != ')'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return "", fmt.Errorf("незакрытый адрес ссылки")
+			}
+			inLink = false
+
+		case strings.ContainsRune(markdownV2Reserved, r):
+			return "", fmt.Errorf("неэкранированный %q", r)
+
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	if inLink {
+		return "", fmt.Errorf("незакрытая ссылка")
+	}
+	return out.String(), nil
+}
+
+// Экранированный текст комментария всегда корректен и выглядит как исходный
+func FuzzEscapeMarkdown(f *testing.F) {
+	for _, seed := range markupSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		// Тексты из API соцсетей всегда в UTF-8
+		if !utf8.ValidString(text) {
+			t.Skip()
+		}
+
+		escaped := escapeMarkdown(text)
+		if err := validateMarkdown(escaped); err != nil {
+			t.Fatalf("escapeMarkdown(%q) = %q не разбирается: %s", text, escaped, err)
+		}
+
+		if plain := renderMarkup(escaped, ""); plain != text {
+			t.Fatalf("обычный текст %q, ожидался %q", plain, text)
+		}
+		if visible := htmlVisibleText(renderMarkup(escaped, PARSE_MODE_HTML)); visible != text {
+			t.Fatalf("HTML показывает %q, ожидался %q", visible, text)
+		}
+		visible, err := markdownV2VisibleText(renderMarkup(escaped, PARSE_MODE_MARKDOWNV2))
+		if err != nil {
+			t.Fatalf("MarkdownV2 для %q некорректен: %s", text, err)
+		}
+		if visible != text {
+			t.Fatalf("MarkdownV2 показывает %q, ожидался %q", visible, text)
+		}
+	})
+}
+
+// Любая разметка, в том числе сломанная, переводится в HTML и MarkdownV2
+// без паники, корректно и с тем же видимым текстом
+func FuzzRenderMarkup(f *testing.F) {
+	for _, seed := range markupSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		// Тексты из API соцсетей всегда в UTF-8
+		if !utf8.ValidString(text) {
+			t.Skip()
+		}
+
+		segments, _ := parseMarkup(text, false)
+		expected := segmentsText(segments)
+
+		if visible := htmlVisibleText(renderMarkup(text, PARSE_MODE_HTML)); visible != expected {
+			t.Fatalf("HTML для %q показывает %q, ожидался %q", text, visible, expected)
+		}
+
+		visible, err := markdownV2VisibleText(renderMarkup(text, PARSE_MODE_MARKDOWNV2))
+		if err != nil {
+			t.Fatalf("MarkdownV2 для %q некорректен: %s", text, err)
+		}
+		if visible != expected {
+			t.Fatalf("MarkdownV2 для %q показывает %q, ожидался %q", text, visible, expected)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+const (
+	TELEGRAM_CAPTION_LIMIT = 1024 // Максимальная длина подписи к фото
+	MEDIA_GROUP_LIMIT      = 10   // Максимум фото в одном альбоме
+
+	// Запас в подписи под строку о действии модератора, которая добавляется позже
+	CAPTION_STATUS_RESERVE = 100
+)
+
+var attachmentNames = map[string]string{
+	db.ATTACHMENT_PHOTO:    "фото",
+	db.ATTACHMENT_STICKER:  "стикер",
+	db.ATTACHMENT_DOC:      "документ",
+	db.ATTACHMENT_LINK:     "ссылка",
+	db.ATTACHMENT_VIDEO:    "видео",
+	db.ATTACHMENT_AUDIO:    "аудио",
+	db.ATTACHMENT_TELEGRAM: "медиа",
+}
+
+var attachmentIcons = map[string]string{
+	db.ATTACHMENT_PHOTO:    "🖼",
+	db.ATTACHMENT_STICKER:  "🙂",
+	db.ATTACHMENT_DOC:      "📄",
+	db.ATTACHMENT_LINK:     "🔗",
+	db.ATTACHMENT_VIDEO:    "🎬",
+	db.ATTACHMENT_AUDIO:    "🎵",
+	db.ATTACHMENT_TELEGRAM: "📎",
+}
+
+// Ссылки на изображения вложений (фото и стикеры), которые отправляются картинками
+func attachmentImages(comment db.Comment) []string {
+	var images []string
+	for _, attachment := range comment.Attachments {
+		if attachment.URL == "" {
+			continue
+		}
+		if attachment.Type == db.ATTACHMENT_PHOTO || attachment.Type == db.ATTACHMENT_STICKER {
+			images = append(images, attachment.URL)
+		}
+	}
+
+	return images
+}
+
+// Есть ли у комментария Telegram медиа, которое копируется из исходного чата
+func hasTelegramMedia(comment db.Comment) bool {
+	for _, attachment := range comment.Attachments {
+		if attachment.Type == db.ATTACHMENT_TELEGRAM {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Краткий перечень вложений в одну строку: "фото, документ"
+func attachmentSummary(comment db.Comment) string {
+	names := make([]string, 0, len(comment.Attachments))
+	for _, attachment := range comment.Attachments {
+		name, ok := attachmentNames[attachment.Type]
+		if !ok {
+			name = attachment.Type
+		}
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Список вложений в разметке для текста оповещения
+func attachmentLines(comment db.Comment) string {
+	var lines []string
+	for _, attachment := range comment.Attachments {
+		icon := attachmentIcons[attachment.Type]
+		if icon == "" {
+			icon = "📎"
+		}
+
+		title := attachment.Title
+		if title == "" {
+			title = attachmentNames[attachment.Type]
+		}
+		if title == "" {
+			title = attachment.Type
+		}
+
+		if strings.HasPrefix(attachment.URL, "http") {
+			lines = append(lines, fmt.Sprintf("%s [%s](%s)", icon, escapeMarkdown(title), attachment.URL))
+		} else {
+			lines = append(lines, icon+" "+escapeMarkdown(title))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Помещается ли текст оповещения в подпись к фото
+func fitsCaption(text string) bool {
+	return utf16Len(renderMarkup(text, "")) <= TELEGRAM_CAPTION_LIMIT-CAPTION_STATUS_RESERVE
+}
+
+// Отправляет оповещение. Единственное изображение комментария отправляется
+// фото с текстом оповещения в подписи, если текст помещается. Возвращает
+// отправленное сообщение и было ли изображение отправлено вместе с ним
+func (bot *Bot) sendNotification(ctx context.Context, params *telego.SendMessageParams, text string, comment db.Comment) (*telego.Message, bool, error) {
+	images := attachmentImages(comment)
+	if len(images) != 1 || !fitsCaption(text) {
+		msg, err := bot.sendMarkup(ctx, params, text)
+		return msg, false, err
+	}
+
+	photo := &telego.SendPhotoParams{
+		ChatID:          params.ChatID,
+		MessageThreadID: params.MessageThreadID,
+		Photo:           tu.FileFromURL(images[0]),
+		ParseMode:       bot.parseMode(),
+		Caption:         renderMarkup(text, bot.parseMode()),
+		ReplyParameters: params.ReplyParameters,
+		ReplyMarkup:     params.ReplyMarkup,
+	}
+
+	msg, err := bot.api.SendPhoto(ctx, photo)
+	if err != nil && isEntitiesError(err) {
+		log.Printf("Telegram не разобрал разметку (%s), отправляем обычным текстом", err)
+		photo.ParseMode = ""
+		photo.Caption = renderMarkup(text, "")
+		msg, err = bot.api.SendPhoto(ctx, photo)
+	}
+	if err == nil || ctx.Err() != nil {
+		return msg, err == nil, err
+	}
+
+	// Telegram не смог загрузить изображение: отправляем текстом, фото останется ссылкой
+	log.Printf("Не удалось отправить оповещение с фото: %s. Отправляем текстом", err)
+	msg, err = bot.sendMarkup(ctx, params, text)
+	return msg, false, err
+}
+
+// Отправляет вложения комментария ответом на оповещение: изображения
+// фото или альбомом, медиа из Telegram - копией исходного сообщения
+func (bot *Bot) sendAttachments(ctx context.Context, notification *telego.Message, group db.MonitoredGroup, comment db.Comment, withPhoto bool) error {
+	reply := &telego.ReplyParameters{
+		MessageID:                notification.MessageID,
+		AllowSendingWithoutReply: true,
+	}
+
+	images := attachmentImages(comment)
+	if withPhoto {
+		images = nil
+	}
+
+	switch {
+	case len(images) == 1:
+		_, err := bot.api.SendPhoto(ctx, &telego.SendPhotoParams{
+			ChatID:          telego.ChatID{ID: notification.Chat.ID},
+			MessageThreadID: notification.MessageThreadID,
+			Photo:           tu.FileFromURL(images[0]),
+			ReplyParameters: reply,
+		})
+		if err != nil {
+			return fmt.Errorf("фото: %w", err)
+		}
+	case len(images) > 1:
+		for start := 0; start < len(images); start += MEDIA_GROUP_LIMIT {
+			end := start + MEDIA_GROUP_LIMIT
+			if end > len(images) {
+				end = len(images)
+			}
+			media := make([]telego.InputMedia, 0, end-start)
+			for _, image := range images[start:end] {
+				media = append(media, tu.MediaPhoto(tu.FileFromURL(image)))
+			}
+
+			_, err := bot.api.SendMediaGroup(ctx, &telego.SendMediaGroupParams{
+				ChatID:          telego.ChatID{ID: notification.Chat.ID},
+				MessageThreadID: notification.MessageThreadID,
+				Media:           media,
+				ReplyParameters: reply,
+			})
+			if err != nil {
+				return fmt.Errorf("альбом: %w", err)
+			}
+		}
+	}
+
+	if hasTelegramMedia(comment) {
+		chatID, err := strconv.ParseInt(group.GroupID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ID чата %s: %w", group.GroupID, err)
+		}
+		messageID, err := strconv.Atoi(comment.CommentID)
+		if err != nil {
+			return fmt.Errorf("ID сообщения %s: %w", comment.CommentID, err)
+		}
+
+		_, err = bot.api.CopyMessage(ctx, &telego.CopyMessageParams{
+			ChatID:          telego.ChatID{ID: notification.Chat.ID},
+			MessageThreadID: notification.MessageThreadID,
+			FromChatID:      telego.ChatID{ID: chatID},
+			MessageID:       messageID,
+			ReplyParameters: reply,
+		})
+		if err != nil {
+			return fmt.Errorf("копия сообщения: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Максимальная длина текста оповещения: у оповещений с фото текст в подписи
+func notificationLimit(notification *telego.Message) int {
+	if len(notification.Photo) > 0 {
+		return TELEGRAM_CAPTION_LIMIT
+	}
+
+	return TELEGRAM_MESSAGE_LIMIT
+}
+
+// Заменяет текст оповещения и кнопки под ним. У оповещений с фото меняется подпись
+func (bot *Bot) editNotification(ctx context.Context, notification *telego.Message, text string, keyboard *telego.InlineKeyboardMarkup) error {
+	if len(notification.Photo) == 0 {
+		_, err := bot.editMarkup(ctx, &telego.EditMessageTextParams{
+			ChatID:      telego.ChatID{ID: notification.Chat.ID},
+			MessageID:   notification.MessageID,
+			ReplyMarkup: keyboard,
+		}, text)
+		return err
+	}
+
+	params := &telego.EditMessageCaptionParams{
+		ChatID:      telego.ChatID{ID: notification.Chat.ID},
+		MessageID:   notification.MessageID,
+		ParseMode:   bot.parseMode(),
+		Caption:     renderMarkup(text, bot.parseMode()),
+		ReplyMarkup: keyboard,
+	}
+
+	_, err := bot.api.EditMessageCaption(ctx, params)
+	if err != nil && isEntitiesError(err) {
+		log.Printf("Telegram не разобрал разметку (%s), редактируем обычным текстом", err)
+		params.ParseMode = ""
+		params.Caption = renderMarkup(text, "")
+		_, err = bot.api.EditMessageCaption(ctx, params)
+	}
+
+	return err
+}
@@ -26,6 +26,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/mymmrac/telego"
 )
@@ -67,6 +68,19 @@ func min(a, b, c int) int {
 	return c
 }
 
+// Спит d, прерываясь при отмене ctx. Возвращает false, если ctx отменен
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 func (bot *Bot) findSimilarCommands(input string) []string {
 	type cmdDistance struct {
 		name     string
@@ -91,20 +105,82 @@ func (bot *Bot) findSimilarCommands(input string) []string {
 	return suggestions
 }
 
+// Режим разбора сообщений Telegram из конфигурации (по умолчанию HTML)
+func (bot *Bot) parseMode() string {
+	if bot.conf.Telegram.ParseMode == PARSE_MODE_MARKDOWNV2 {
+		return PARSE_MODE_MARKDOWNV2
+	}
+
+	return PARSE_MODE_HTML
+}
+
+func isEntitiesError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
+}
+
+// Отправляет текст в разметке бота (см. markup.go), переводя его в режим
+// из конфигурации. Если Telegram все равно не разобрал сущности,
+// сообщение отправляется обычным текстом
+func (bot *Bot) sendMarkup(ctx context.Context, params *telego.SendMessageParams, text string) (*telego.Message, error) {
+	params.ParseMode = bot.parseMode()
+	params.Text = renderMarkup(text, params.ParseMode)
+
+	msg, err := bot.api.SendMessage(ctx, params)
+	if err != nil && isEntitiesError(err) {
+		log.Printf("Telegram не разобрал разметку (%s), отправляем обычным текстом", err)
+		params.ParseMode = ""
+		params.Text = renderMarkup(text, "")
+		return bot.api.SendMessage(ctx, params)
+	}
+
+	return msg, err
+}
+
+// То же, что sendMarkup, но для редактирования сообщения
+func (bot *Bot) editMarkup(ctx context.Context, params *telego.EditMessageTextParams, text string) (*telego.Message, error) {
+	params.ParseMode = bot.parseMode()
+	params.Text = renderMarkup(text, params.ParseMode)
+
+	msg, err := bot.api.EditMessageText(ctx, params)
+	if err != nil && isEntitiesError(err) {
+		log.Printf("Telegram не разобрал разметку (%s), редактируем обычным текстом", err)
+		params.ParseMode = ""
+		params.Text = renderMarkup(text, "")
+		return bot.api.EditMessageText(ctx, params)
+	}
+
+	return msg, err
+}
+
 func (bot *Bot) sendMessage(chatID int64, threadID int, text string) {
 	params := &telego.SendMessageParams{
 		ChatID: telego.ChatID{
 			ID: chatID,
 		},
-		Text:      text,
-		ParseMode: "Markdown",
 	}
 
 	if threadID != 0 {
 		params.MessageThreadID = threadID
 	}
 
-	bot.api.SendMessage(context.Background(), params)
+	bot.sendMarkup(bot.ctx, params, text)
+}
+
+// Отправляет сообщение администраторам (разрешенным пользователям).
+// Если список пуст, сообщение отправляется в мониторинговый чат
+func (bot *Bot) notifyAdmins(text string) {
+	if len(bot.conf.Telegram.AllowedUserIDs) == 0 {
+		bot.sendMessage(
+			bot.conf.Telegram.MonitoringChannelID,
+			int(bot.conf.Telegram.MonitoringThreadID),
+			text,
+		)
+		return
+	}
+
+	for _, id := range bot.conf.Telegram.AllowedUserIDs {
+		bot.sendMessage(id, 0, text)
+	}
 }
 
 func (bot *Bot) answerBack(message *telego.Message, text string, reply bool) {
@@ -112,8 +188,6 @@ func (bot *Bot) answerBack(message *telego.Message, text string, reply bool) {
 		ChatID: telego.ChatID{
 			ID: message.Chat.ID,
 		},
-		Text:      text,
-		ParseMode: "Markdown",
 	}
 
 	if message.MessageThreadID != 0 {
@@ -126,7 +200,7 @@ func (bot *Bot) answerBack(message *telego.Message, text string, reply bool) {
 		}
 	}
 
-	bot.api.SendMessage(context.Background(), params)
+	bot.sendMarkup(bot.ctx, params, text)
 }
 
 func (bot *Bot) sendError(message *telego.Message, text string) {
@@ -262,7 +336,7 @@ func (bot *Bot) generateTelegramLink(msg *telego.Message) string {
 
 	// Обычный режим (не комментарий)
 	chat, err := bot.api.GetChat(
-		context.Background(),
+		bot.ctx,
 		&telego.GetChatParams{
 			ChatID: telego.ChatID{ID: msg.Chat.ID},
 		})
@@ -287,17 +361,20 @@ func formatChatID(id int64) string {
 	return strconv.FormatInt(id, 10)
 }
 
-func (bot *Bot) isSpam(text string) bool {
-	// If spam filtering is disabled, nothing is spam
-	if !bot.conf.Spam.FilterSpam {
-		return false
-	}
-
-	text = strings.ToLower(text)
-	for _, keyword := range bot.conf.Spam.Keywords {
-		if strings.Contains(text, strings.ToLower(keyword)) {
-			return true
+// Делит текст на первые n слов и остаток, сохраняя в остатке пробелы и переводы строк
+func cutFields(text string, n int) ([]string, string) {
+	var fields []string
+	rest := strings.TrimSpace(text)
+	for len(fields) < n && rest != "" {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end == -1 {
+			fields = append(fields, rest)
+			return fields, ""
 		}
+
+		fields = append(fields, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
 	}
-	return false
+
+	return fields, rest
 }
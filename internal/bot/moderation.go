@@ -0,0 +1,277 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+// Может ли пользователь удалять комментарии и блокировать авторов. Если
+// модераторы не назначены, это могут разрешенные пользователи. Публичный
+// доступ к боту права модерации не дает
+func (bot *Bot) canModerate(userID int64) bool {
+	ids := bot.conf.Telegram.ModeratorIDs
+	if len(ids) == 0 {
+		ids = bot.conf.Telegram.AllowedUserIDs
+	}
+
+	for _, id := range ids {
+		if id == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Поддерживает ли соцсеть удаление комментариев и блокировку авторов
+func (bot *Bot) canModerateNetwork(network string) bool {
+	return network == "tg" || bot.social.Moderator(network) != nil
+}
+
+// Удаляет комментарий в соцсети
+func (bot *Bot) deleteComment(ctx context.Context, group db.MonitoredGroup, comment db.Comment) error {
+	if group.Network == "tg" {
+		chatID, err := strconv.ParseInt(group.GroupID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("неверный ID чата группы: %w", err)
+		}
+		messageID, err := strconv.Atoi(comment.CommentID)
+		if err != nil {
+			return fmt.Errorf("неверный ID сообщения: %w", err)
+		}
+
+		return bot.api.DeleteMessage(ctx, &telego.DeleteMessageParams{
+			ChatID:    telego.ChatID{ID: chatID},
+			MessageID: messageID,
+		})
+	}
+
+	moderator := bot.social.Moderator(group.Network)
+	if moderator == nil {
+		return fmt.Errorf("модерация не поддерживается для %s", group.Network)
+	}
+	if comment.CommentID == "" {
+		return fmt.Errorf("у комментария нет ID (получен до обновления бота)")
+	}
+
+	return moderator.DeleteComment(ctx, group.GroupID, comment.PostID, comment.CommentID)
+}
+
+// Блокирует автора комментария в сообществе
+func (bot *Bot) banAuthor(ctx context.Context, group db.MonitoredGroup, comment db.Comment) error {
+	if comment.AuthorID == "" {
+		return fmt.Errorf("у комментария нет ID автора (получен до обновления бота)")
+	}
+
+	if group.Network == "tg" {
+		chatID, err := strconv.ParseInt(group.GroupID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("неверный ID чата группы: %w", err)
+		}
+		userID, err := strconv.ParseInt(comment.AuthorID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("неверный ID автора: %w", err)
+		}
+
+		return bot.api.BanChatMember(ctx, &telego.BanChatMemberParams{
+			ChatID: telego.ChatID{ID: chatID},
+			UserID: userID,
+		})
+	}
+
+	moderator := bot.social.Moderator(group.Network)
+	if moderator == nil {
+		return fmt.Errorf("модерация не поддерживается для %s", group.Network)
+	}
+
+	return moderator.BanAuthor(ctx, group.GroupID, comment.AuthorID)
+}
+
+// Обработка кнопок удаления и блокировки. Первое нажатие отправляет
+// запрос подтверждения ответом на оповещение, действие выполняется
+// только после подтверждения
+func (bot *Bot) handleModerationCallback(query *telego.CallbackQuery, action string, key int64, comment *db.Comment, group *db.MonitoredGroup) string {
+	if !bot.canModerate(query.From.ID) {
+		return "Удалять комментарии и блокировать авторов могут только модераторы"
+	}
+
+	if !bot.canModerateNetwork(group.Network) {
+		return "Модерация не поддерживается для этой соцсети"
+	}
+
+	message := query.Message.Message()
+	data := func(action string) string {
+		return CALLBACK_ACTION + action + ":" + strconv.FormatInt(key, 10)
+	}
+
+	switch action {
+	case ACTION_DELETE, ACTION_BAN:
+		question := fmt.Sprintf("🗑 Удалить комментарий %s в \"%s\"?", escapeMarkdown(comment.Author), escapeMarkdown(group.GroupName))
+		confirm := ACTION_CONFIRM_DELETE
+		if action == ACTION_BAN {
+			question = fmt.Sprintf("⛔ Заблокировать %s в \"%s\"?", escapeMarkdown(comment.Author), escapeMarkdown(group.GroupName))
+			confirm = ACTION_CONFIRM_BAN
+		}
+
+		params := &telego.SendMessageParams{
+			ChatID:          telego.ChatID{ID: message.Chat.ID},
+			MessageThreadID: message.MessageThreadID,
+			ReplyParameters: &telego.ReplyParameters{MessageID: message.MessageID},
+			ReplyMarkup: tu.InlineKeyboard(tu.InlineKeyboardRow(
+				tu.InlineKeyboardButton("Да").WithCallbackData(data(confirm)),
+				tu.InlineKeyboardButton("Отмена").WithCallbackData(data(ACTION_CANCEL)),
+			)),
+		}
+		if _, err := bot.sendMarkup(bot.ctx, params, question); err != nil {
+			log.Printf("Ошибка отправки подтверждения: %s", err)
+			return "Не удалось запросить подтверждение"
+		}
+		return ""
+
+	case ACTION_CANCEL:
+		bot.deleteMessage(message)
+		return "Отменено"
+	}
+
+	// Подтверждение: сообщение с вопросом - ответ на оповещение
+	notification := message.ReplyToMessage
+	moderator := formatUserName(&query.From)
+
+	var status, answer string
+	var err error
+	if action == ACTION_CONFIRM_DELETE {
+		status, answer = ACTION_DELETED, "Комментарий удален"
+		err = bot.deleteComment(bot.ctx, *group, *comment)
+	} else {
+		status, answer = ACTION_BANNED, "Автор заблокирован"
+		err = bot.banAuthor(bot.ctx, *group, *comment)
+	}
+
+	if err != nil {
+		log.Printf("[%s] %s: ошибка для комментария %s: %s", moderator, status, comment.ID, err)
+		bot.audit(query.From, status, group, comment, "ошибка: "+err.Error())
+		return "Не удалось: " + err.Error()
+	}
+
+	log.Printf("[%s] %s: комментарий %s в %s", moderator, status, comment.ID, group.GroupName)
+	bot.setCommentStatus(key, comment, status, moderator)
+	bot.audit(query.From, status, group, comment, "")
+	bot.deleteMessage(message)
+	if notification != nil {
+		bot.refreshNotification(notification, key, *group, *comment)
+	}
+
+	return answer
+}
+
+func (bot *Bot) deleteMessage(message *telego.Message) {
+	err := bot.api.DeleteMessage(bot.ctx, &telego.DeleteMessageParams{
+		ChatID:    telego.ChatID{ID: message.Chat.ID},
+		MessageID: message.MessageID,
+	})
+	if err != nil {
+		log.Printf("Ошибка удаления сообщения: %s", err)
+	}
+}
+
+func (bot *Bot) AddModerator(message *telego.Message) {
+	if !bot.canModerate(message.From.ID) {
+		bot.sendError(message, "Назначать модераторов могут только модераторы")
+		return
+	}
+
+	parts := strings.Fields(message.Text)
+	if len(parts) < 2 {
+		bot.sendError(message, "Неверный формат. Используйте: /addmoderator <ID пользователя>")
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		bot.sendError(message, "Указан неверный ID")
+		return
+	}
+
+	// Первый назначенный модератор заменяет allowed_user_ids: переносим их,
+	// чтобы не лишить текущих модераторов прав
+	if len(bot.conf.Telegram.ModeratorIDs) == 0 {
+		bot.conf.Telegram.ModeratorIDs = append([]int64{}, bot.conf.Telegram.AllowedUserIDs...)
+	}
+
+	for _, existing := range bot.conf.Telegram.ModeratorIDs {
+		if existing == id {
+			bot.sendError(message, "Этот пользователь уже модератор")
+			return
+		}
+	}
+
+	bot.conf.Telegram.ModeratorIDs = append(bot.conf.Telegram.ModeratorIDs, id)
+	bot.conf.Update()
+	bot.audit(*message.From, "add_moderator", nil, nil, strconv.FormatInt(id, 10))
+
+	bot.sendSuccess(message, fmt.Sprintf("Пользователь %d назначен модератором", id))
+}
+
+func (bot *Bot) RemoveModerator(message *telego.Message) {
+	if !bot.canModerate(message.From.ID) {
+		bot.sendError(message, "Снимать модераторов могут только модераторы")
+		return
+	}
+
+	parts := strings.Fields(message.Text)
+	if len(parts) < 2 {
+		bot.sendError(message, "Неверный формат. Используйте: /rmmoderator <ID пользователя>")
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		bot.sendError(message, "Указан неверный ID")
+		return
+	}
+
+	for i, existing := range bot.conf.Telegram.ModeratorIDs {
+		if existing == id {
+			// Пустой список означает права у всех из allowed_user_ids
+			if len(bot.conf.Telegram.ModeratorIDs) == 1 {
+				bot.sendError(message, "Нельзя снять последнего модератора: права модерации перешли бы всем пользователям из `allowed_user_ids`. Сначала назначьте другого модератора")
+				return
+			}
+
+			bot.conf.Telegram.ModeratorIDs = append(bot.conf.Telegram.ModeratorIDs[:i], bot.conf.Telegram.ModeratorIDs[i+1:]...)
+			bot.conf.Update()
+			bot.audit(*message.From, "remove_moderator", nil, nil, strconv.FormatInt(id, 10))
+
+			bot.sendSuccess(message, fmt.Sprintf("Пользователь %d больше не модератор", id))
+			return
+		}
+	}
+
+	bot.sendError(message, "Этот пользователь не модератор")
+}
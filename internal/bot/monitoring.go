@@ -20,101 +20,272 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
 	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
 
 	"github.com/mymmrac/telego"
 )
 
-func (bot *Bot) StartMonitoring(intervalMins int) {
+func (bot *Bot) StartMonitoring(ctx context.Context, intervalMins int) {
 	log.Printf("Запускаем мониторинг с интервалом %d минут", intervalMins)
 
+	bot.wg.Add(1)
 	go func(intervalMins int) {
+		defer bot.wg.Done()
+
+		// Наверстываем пропущенное за время простоя до первого тика
+		bot.catchUp(ctx, time.Duration(intervalMins)*time.Minute)
+
 		ticker := time.NewTicker(time.Duration(intervalMins) * time.Minute)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			groups, err := bot.conf.GetDB().GetGroups()
-			if err != nil {
-				log.Printf("Ошибка получения групп: %v", err)
-				continue
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("Мониторинг остановлен")
+				return
+			case <-ticker.C:
+				bot.checkGroups(ctx)
 			}
+		}
+	}(intervalMins)
+}
 
-			// Проверяем кэш при каждой итерации
-			err = bot.processPendingComments()
-			if err != nil {
-				log.Printf("Ошибка обработки кэшированных сообщений: %s", err)
+// Один проход проверки всех групп. При отмене ctx прерывается между группами,
+// не обновляя время последней проверки непроверенных групп
+func (bot *Bot) checkGroups(ctx context.Context) {
+	bot.resumeExpiredPauses()
+
+	if err := bot.db.DeletePostThreadsBefore(time.Now().Add(-POST_THREAD_TTL).Unix()); err != nil {
+		log.Printf("Ошибка удаления старых веток постов: %s", err)
+	}
+	if err := bot.db.DeletePostsBefore(time.Now().Add(-POST_CACHE_TTL).Unix()); err != nil {
+		log.Printf("Ошибка удаления старых постов: %s", err)
+	}
+	if err := bot.db.DeleteFloodClustersBefore(time.Now().Add(-FLOOD_CLUSTER_TTL).Unix()); err != nil {
+		log.Printf("Ошибка удаления старых серий флуда: %s", err)
+	}
+
+	groups, err := bot.conf.GetDB().GetGroups()
+	if err != nil {
+		log.Printf("Ошибка получения групп: %v", err)
+		return
+	}
+
+	// Проверяем кэш при каждой итерации
+	err = bot.processPendingComments(ctx)
+	if err != nil {
+		log.Printf("Ошибка обработки кэшированных сообщений: %s", err)
+	}
+
+	log.Printf("Проверка %d групп...", len(groups))
+
+	for _, group := range groups {
+		if group.Network == "tg" || bot.isGroupPaused(group) {
+			continue
+		}
+
+		if !sleepContext(ctx, time.Second*5) {
+			return
+		}
+
+		comments, err := bot.checkGroupComments(ctx, group, social.DefaultPostsCount)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Проверка %s прервана завершением работы", group.GroupName)
+				return
 			}
 
-			log.Printf("Проверка %d групп...", len(groups))
+			log.Printf("Ошибка проверки группы %s (%s): %v. Дополнительно ждем...",
+				group.GroupName, group.Network, err,
+			)
 
-			for _, group := range groups {
-				if group.Network == "tg" {
-					continue
+			if !sleepContext(ctx, time.Second*15) {
+				return
+			}
+			comments, err = bot.checkGroupComments(ctx, group, social.DefaultPostsCount)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Ошибка дополнительной проверки %s: %s. Комментарии не проверены.", group.GroupName, err)
+				// Лимиты API - беда токенов, а не группы: не приближаем ее приостановку
+				if !errors.Is(err, social.ErrRateLimited) {
+					bot.recordGroupFailure(group, err)
 				}
+				continue
+			}
+		}
 
-				time.Sleep(time.Second * 5)
+		if err := bot.db.RecordGroupSuccess(group.ID, time.Now().Unix()); err != nil {
+			log.Printf("Ошибка обновления состояния группы %s: %s", group.GroupName, err)
+		}
 
-				comments, err := bot.checkGroupComments(group)
-				if err != nil {
-					log.Printf("Ошибка проверки группы %s (%s): %v. Дополнительно ждем...",
-						group.GroupName, group.Network, err,
-					)
-
-					time.Sleep(time.Second * 15)
-					comments, err = bot.checkGroupComments(group)
-					if err != nil {
-						log.Printf("Ошибка дополнительной проверки %s: %s. Комментарии не проверены.", group.GroupName, err)
-						continue
-					}
+		if len(comments) > 0 {
+			log.Printf("Найдено %d новых комментариев в %s (%s)",
+				len(comments),
+				group.GroupName,
+				group.Network,
+			)
+
+			if bot.isNotificationAllowed() {
+				log.Printf("Оповещения разрешены, оповещение...")
+				bot.notifyNewComments(ctx, group, comments)
+			} else {
+				// Срочные комментарии (см. WATCH_HIGH) не ждут рабочего времени
+				urgent, rest := bot.splitUrgentComments(group, comments)
+				if len(urgent) > 0 {
+					log.Printf("Оповещения запрещены, но %d комментариев срочные, оповещение...", len(urgent))
+					bot.notifyNewComments(ctx, group, urgent)
 				}
 
-				if len(comments) > 0 {
-					log.Printf("Найдено %d новых комментариев в %s (%s)",
-						len(comments),
-						group.GroupName,
-						group.Network,
-					)
-
-					if bot.isNotificationAllowed() {
-						log.Printf("Оповещения разрешены, оповещение...")
-						bot.notifyNewComments(group, comments)
-					} else {
-						log.Printf("Оповещения запрещены, добавление в кэш...")
-						err = bot.cacheComments(group, comments)
-						if err != nil {
-							log.Printf("Ошибка добавления новых комментариев в кэш: %s. Не обновляем время последней проверки.", err)
-							continue
-						}
-					}
+				log.Printf("Оповещения запрещены, добавление в кэш...")
+				err = bot.cacheComments(group, rest)
+				if err != nil {
+					log.Printf("Ошибка добавления новых комментариев в кэш: %s. Не обновляем время последней проверки.", err)
+					continue
 				}
-
-				// Обновляем время последней проверки
-				bot.conf.GetDB().UpdateLastCheck(group.ID, time.Now().Unix())
 			}
 		}
-	}(intervalMins)
+
+		// Обновляем время последней проверки
+		bot.conf.GetDB().UpdateLastCheck(group.ID, time.Now().Unix())
+	}
+}
+
+// Приостановлен ли мониторинг группы - ее самой или всей ее соцсети -
+// с учетом срока приостановки
+func (bot *Bot) isGroupPaused(group db.MonitoredGroup) bool {
+	now := time.Now().Unix()
+	if group.Paused && (group.PausedUntil == 0 || group.PausedUntil > now) {
+		return true
+	}
+
+	return bot.isNetworkPaused(group.Network, now)
+}
+
+func (bot *Bot) isNetworkPaused(network string, now int64) bool {
+	bot.conf.mu.RLock()
+	until, ok := bot.conf.PausedNetworks[network]
+	bot.conf.mu.RUnlock()
+
+	return ok && (until == 0 || until > now)
+}
+
+// Снимает приостановку соцсети. Если skipMissed, комментарии, оставленные
+// за время паузы, пропускаются: время последней проверки групп переносится на сейчас
+func (bot *Bot) resumeNetwork(network string, skipMissed bool) error {
+	err := bot.conf.Change(func() {
+		delete(bot.conf.PausedNetworks, network)
+	})
+	if err != nil || !skipMissed {
+		return err
+	}
+
+	_, err = bot.db.UpdateNetworkLastCheck(network, time.Now().Unix())
+	return err
 }
 
-func (bot *Bot) checkGroupComments(group db.MonitoredGroup) ([]db.Comment, error) {
+// Возобновляет группы и соцсети, срок приостановки которых истек.
+// Комментарии за время паузы пропускаются, как и при /resume без all
+func (bot *Bot) resumeExpiredPauses() {
+	now := time.Now().Unix()
+
+	resumed, err := bot.db.ResumeExpiredPauses(now)
+	if err != nil {
+		log.Printf("Ошибка возобновления приостановленных групп: %s", err)
+		return
+	}
+
+	for _, group := range resumed {
+		if err := bot.db.UpdateLastCheck(group.ID, now); err != nil {
+			log.Printf("Ошибка обновления времени проверки группы %s: %s", group.GroupName, err)
+		}
+		log.Printf("Срок приостановки группы %s (%s) истек, мониторинг возобновлен", group.GroupName, group.Network)
+	}
+
+	var expired []string
+	bot.conf.mu.RLock()
+	for network, until := range bot.conf.PausedNetworks {
+		if until != 0 && until <= now {
+			expired = append(expired, network)
+		}
+	}
+	bot.conf.mu.RUnlock()
+
+	for _, network := range expired {
+		if err := bot.resumeNetwork(network, true); err != nil {
+			log.Printf("Ошибка возобновления соцсети %s: %s", network, err)
+			continue
+		}
+		log.Printf("Срок приостановки %s истек, мониторинг возобновлен", strings.ToUpper(network))
+	}
+}
+
+// Учитывает неудачную проверку группы и приостанавливает группу
+// при достижении порога ошибок подряд
+func (bot *Bot) recordGroupFailure(group db.MonitoredGroup, checkErr error) {
+	failures, err := bot.db.RecordGroupFailure(group.ID, checkErr.Error())
+	if err != nil {
+		log.Printf("Ошибка обновления состояния группы %s: %s", group.GroupName, err)
+		return
+	}
+
+	threshold := bot.conf.Health.FailureThreshold
+	if threshold <= 0 || failures < threshold {
+		return
+	}
+
+	if err := bot.db.PauseGroup(group.ID, 0); err != nil {
+		log.Printf("Не удалось приостановить группу %s: %s", group.GroupName, err)
+		return
+	}
+
+	log.Printf("Группа %s (%s) приостановлена после %d ошибок подряд", group.GroupName, group.Network, failures)
+	bot.notifyAdmins(fmt.Sprintf(
+		"⚠️ *Мониторинг группы приостановлен*\n\n"+
+			"Группа: %s (%s)\n"+
+			"ID: `%s`\n"+
+			"Ошибок подряд: %d\n"+
+			"Последняя ошибка: `%s`\n\n"+
+			"Для возобновления: `/resume %s %s` (с `all` в конце - получить и комментарии, пропущенные за это время)",
+		escapeMarkdown(group.GroupName),
+		group.Network,
+		group.GroupID,
+		failures,
+		strings.ReplaceAll(checkErr.Error(), "`", "'"),
+		group.Network,
+		group.GroupID,
+	))
+}
+
+func (bot *Bot) checkGroupComments(ctx context.Context, group db.MonitoredGroup, postsCount int) ([]db.Comment, error) {
 	switch group.Network {
 	case "vk":
-		return bot.social.VKClient.GetComments(context.Background(), group.GroupID, group.LastCheck)
+		return bot.social.VKClient.GetComments(ctx, group.GroupID, group.LastCheck, postsCount)
 	case "ok":
-		return bot.social.OKClient.GetComments(context.Background(), group.GroupID, group.LastCheck)
+		return bot.social.OKClient.GetComments(ctx, group.GroupID, group.LastCheck, postsCount)
 	default:
 		return nil, nil
 	}
 }
 
-// processCommentText обрабатывает текст комментария, заменяя специальные теги на понятные сообщения
-func processCommentText(text string) string {
+// processCommentText обрабатывает текст комментария, заменяя специальные теги на понятные сообщения.
+// Если вложения комментария уже разобраны, пустой текст остается пустым
+func processCommentText(comment db.Comment) string {
+	text := comment.Text
 	if text == "" {
+		if len(comment.Attachments) > 0 {
+			return ""
+		}
 		return "((Пустой текст, возможно файл или стикер))"
 	}
 
@@ -135,8 +306,10 @@ func processCommentText(text string) string {
 	return text
 }
 
+// Экранирует текст для вставки в разметку сообщений (см. markup.go)
 func escapeMarkdown(text string) string {
 	replacer := strings.NewReplacer(
+		"\\", "\\\\",
 		"_", "\\_",
 		"*", "\\*",
 		"`", "\\`",
@@ -158,143 +331,197 @@ func formatTimeAgo(timestamp int64) string {
 		return fmt.Sprintf("%d мин назад", int(ago.Minutes()))
 	case ago.Hours() < 24:
 		return fmt.Sprintf("%d ч назад", int(ago.Hours()))
+	case ago.Hours() < 30*24:
+		return fmt.Sprintf("%d дн назад", int(ago.Hours()/24))
 	default:
 		return "давно"
 	}
 }
 
-func (bot *Bot) constructNotificationMessage(group db.MonitoredGroup, comment db.Comment) string {
-	safeAuthor := escapeMarkdown(comment.Author)
-	safeGroupName := escapeMarkdown(group.GroupName)
-	if len([]rune(comment.Text)) > 500 {
-		comment.Text = string([]rune(comment.Text)[:500]) + "\n\n⚠️ Сообщение было обрезано."
-	}
-	safeText := escapeMarkdown(processCommentText(comment.Text))
+func (bot *Bot) constructNotificationMessage(group db.MonitoredGroup, comment db.Comment, maxLength int) string {
+	data := newNotificationData(group, comment, maxLength)
 
-	status := "Только что"
-	if comment.IsPending {
-		status = "Отправлено с задержкой: (комментарий получен в нерабочее время)"
+	name := bot.activeTemplateName()
+	source, ok := bot.templateSource(name)
+	if !ok {
+		log.Printf("Шаблон оповещения %s не найден, используем %s", name, TEMPLATE_FULL)
+		source = builtinTemplates[TEMPLATE_FULL]
 	}
 
-	// Форматируем время в человекочитаемый вид
-	commentTime := time.Unix(comment.Timestamp, 0)
-	var timeStr string
-	if commentTime.Day() == time.Now().Day() && commentTime.Month() == time.Now().Month() && commentTime.Year() == time.Now().Year() {
-		timeStr = commentTime.Format("сегодня в 15:04")
-	} else {
-		timeStr = commentTime.Format("02.01.2006 в 15:04")
-	}
-
-	var msgText string
-	switch bot.conf.NotificationMessageType {
-	case NOTIFICATION_FULL:
-		msgText = fmt.Sprintf(
-			"💬 *Новый комментарий в \"%s\" (%s)*:\n\n"+
-				"📝 *Текст*: %s\n\n"+
-				"👤 *Автор*: %s\n"+
-				"🔗 *Ссылка*: [Перейти к посту](%s)\n"+
-				"⏰ *Время публикации комментария*: %s\n"+
-				"📌 *Статус оповещения*: %s",
-			safeGroupName,
-			group.Network,
-			safeText,
-			safeAuthor,
-			comment.PostURL,
-			timeStr,
-			status,
-		)
-	case NOTIFICATION_MINIMALISTIC:
-		ago := formatTimeAgo(comment.Timestamp)
-
-		// Обрезаем текст комментария для минималистичного вида
-		msgText = fmt.Sprintf(
-			"🌐 (%s) *%s*\n"+
-				"💬 %s\n"+
-				"⏰ %s | (статус: %s)\n"+
-				"👤 *%s*\n"+
-				"🔗 [Перейти к посту](%s) • %s",
-			group.Network,
-			group.GroupName,
-			safeText,
-			timeStr,
-			status,
-			safeAuthor,
-			comment.PostURL,
-			ago,
-		)
-
-	case NOTIFICATION_SPACED:
-		// Добавляем визуальные разделители и отступы
-		divider := strings.Repeat("•", 35) + "\n"
-
-		msgText = fmt.Sprintf(
-			"*💬 НОВЫЙ КОММЕНТАРИЙ*\n"+
-				"*Группа:* _%s_ (%s)\n"+
-				divider+
-				"*📝 Текст комментария:*\n%s\n"+
-				divider+
-				"*👤 Автор:* %s\n"+
-				"*⏰ Время:* %s\n"+
-				"*📌 Статус:* %s\n"+
-				"*🔗 Ссылка:* [Перейти к посту](%s)",
-			safeGroupName,
-			group.Network,
-			safeText,
-			safeAuthor,
-			timeStr,
-			status,
-			comment.PostURL,
-		)
-
-	default:
-		msgText = fmt.Sprintf(
-			"💬 *Новый комментарий в \"%s\" (%s)*:\n\n"+
-				"👤 *Автор*: %s\n"+
-				"📝 *Текст*: %s\n"+
-				"🔗 *Ссылка*: [Перейти к посту](%s)\n"+
-				"⏰ *Время публикации комментария*: %s\n"+
-				"📌 *Статус оповещения*: %s",
-			safeGroupName,
-			group.Network,
-			safeAuthor,
-			safeText,
-			comment.PostURL,
-			time.Unix(comment.Timestamp, 0).Format("2006-01-02 15:04"),
-			status,
-		)
+	msgText, err := renderTemplate(source, data)
+	if err != nil {
+		log.Printf("Ошибка шаблона оповещения %s: %s. Используем %s", name, err, TEMPLATE_FULL)
+		msgText, _ = renderTemplate(builtinTemplates[TEMPLATE_FULL], data)
 	}
 
 	return msgText
 }
 
-func (bot *Bot) notifyNewComments(group db.MonitoredGroup, comments []db.Comment) {
-	for _, comment := range comments {
-		// Check if comment is spam
-		if bot.isSpam(comment.Text) {
-			log.Printf("Пропускаем спам-комментарий в %s: %s", group.GroupName, comment.Text)
+// Отправляет оповещения о комментариях. Если отправка прервана отменой ctx,
+// неотправленные комментарии сохраняются в кэш и будут отправлены позже
+func (bot *Bot) notifyNewComments(ctx context.Context, group db.MonitoredGroup, comments []db.Comment) error {
+	return bot.processComments(ctx, group, comments, false)
+}
+
+// Проводит комментарии через спам-фильтр, отслеживание и сворачивание флуда.
+// При toDigest несрочные комментарии любой группы копятся для дайджеста
+// вместо отдельных оповещений (сводка после простоя)
+func (bot *Bot) processComments(ctx context.Context, group db.MonitoredGroup, comments []db.Comment, toDigest bool) error {
+	for i, comment := range comments {
+		sentiment := bot.scoreSentiment(&comment)
+
+		if rule := bot.checkSpam(group, comment); rule != nil {
+			comment.SpamRule = describeSpamRule(*rule)
+
+			switch rule.Action {
+			case SPAM_ACTION_DROP:
+				log.Printf("Пропускаем спам-комментарий в %s (%s): %s", group.GroupName, comment.SpamRule, comment.Text)
+				continue
+			case SPAM_ACTION_QUARANTINE:
+				bot.quarantineComment(ctx, group, comment)
+				continue
+			}
+		}
+
+		if bot.isAuthorMuted(group.Network, comment) {
+			continue
+		}
+
+		// Короткие благодарности вроде "Спасибо!" не требуют ответа
+		if bot.isIgnoredPositive(comment, sentiment) {
+			log.Printf("Пропускаем положительный комментарий в %s: %s", group.GroupName, comment.Text)
 			continue
 		}
 
-		msgText := bot.constructNotificationMessage(group, comment)
+		bot.attachPostContext(group, &comment)
 
-		params := &telego.SendMessageParams{
-			ChatID:    telego.ChatID{ID: bot.conf.Telegram.MonitoringChannelID},
-			Text:      msgText,
-			ParseMode: "Markdown",
+		// Повторы сворачиваются в одно оповещение о серии, срочные - нет
+		urgent := bot.isUrgentComment(group, comment)
+		if !urgent && bot.collapseFlood(ctx, group, comment) {
+			continue
 		}
 
-		// Указываем ID топика, если он установлен
-		if bot.conf.Telegram.MonitoringThreadID != 0 {
-			params.MessageThreadID = int(bot.conf.Telegram.MonitoringThreadID)
+		// Малозначимые группы: комментарий ждет ближайшего дайджеста
+		if (toDigest || bot.isDigestGroup(group)) && !urgent {
+			if err := bot.db.SaveDigestComment(&group, &comment, time.Now().Unix()); err != nil {
+				log.Printf("Ошибка добавления комментария в дайджест: %s", err)
+			}
+			continue
 		}
 
-		if _, err := bot.api.SendMessage(context.Background(), params); err != nil {
+		if err := bot.sendCommentNotification(ctx, &group, comment); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Отправка оповещений прервана, сохраняем %d комментариев в кэш", len(comments)-i)
+				if err := bot.cacheComments(group, comments[i:]); err != nil {
+					log.Printf("Не удалось сохранить комментарии в кэш: %s. Потеря комментариев.", err)
+				}
+				return ctx.Err()
+			}
 			log.Printf("Ошибка отправки уведомления: %v", err)
 		}
 	}
+
+	return nil
+}
+
+// Отправляет оповещение о комментарии в чат группы. Возвращает ошибку,
+// только если оповещение не отправлено
+func (bot *Bot) sendCommentNotification(ctx context.Context, group *db.MonitoredGroup, comment db.Comment) error {
+	watch := bot.checkWatch(*group, comment)
+	if watch != nil {
+		comment.WatchRule = describeWatchRule(*watch)
+	}
+
+	limit := bot.notificationTextLimit()
+	truncated := utf8.RuneCountInString(comment.Text) > limit
+	msgText := bot.constructNotificationMessage(*group, comment, limit)
+
+	if err := bot.ensureGroupTopic(ctx, group); err != nil {
+		log.Printf("Топик группы %s: %s. Отправляем в общий раздел", group.GroupName, err)
+	}
+
+	// Маршрут по тональности важнее маршрута группы: негатив - в эскалацию
+	target := bot.groupTarget(*group)
+	if moodTarget, ok := bot.moodTarget(comment); ok {
+		target = moodTarget
+	}
+	params := &telego.SendMessageParams{
+		ChatID:          telego.ChatID{ID: target.ChatID},
+		MessageThreadID: target.ThreadID,
+	}
+
+	// Комментарий сохраняется, чтобы кнопки действий работали и после перезапуска.
+	// При обрезке по настройке полный текст доступен по кнопке
+	comment.Network = group.Network
+	key, err := bot.db.SaveSentComment(group, &comment, time.Now().Unix())
+	if err != nil {
+		log.Printf("Не удалось сохранить комментарий %s для кнопок: %s", comment.ID, err)
+	} else {
+		params.ReplyMarkup = bot.notificationKeyboard(key, comment, truncated && bot.truncationEnabled())
+	}
+
+	// Продолжаем ветку поста, если оповещения о нем уже были
+	thread := bot.postThread(*group, comment, target)
+	if thread != nil {
+		params.ReplyParameters = &telego.ReplyParameters{
+			MessageID:                thread.MessageID,
+			AllowSendingWithoutReply: true,
+		}
+	}
+
+	msg, withPhoto, err := bot.sendNotification(ctx, params, msgText, comment)
+	if err != nil && bot.forgetDeletedTopic(group, target, err) {
+		// Топик группы удалили в чате: создаем новый и отправляем туда
+		if err := bot.ensureGroupTopic(ctx, group); err != nil {
+			log.Printf("Топик группы %s: %s. Отправляем в общий раздел", group.GroupName, err)
+		}
+		target = bot.groupTarget(*group)
+		params.ChatID = telego.ChatID{ID: target.ChatID}
+		params.MessageThreadID = target.ThreadID
+		params.ReplyParameters = nil
+		thread = nil
+		msg, withPhoto, err = bot.sendNotification(ctx, params, msgText, comment)
+	}
+	if err != nil {
+		return err
+	}
+
+	if thread == nil {
+		bot.startPostThread(*group, comment, target, msg)
+	}
+
+	// Ответ модератора на оповещение публикуется ответом на комментарий
+	if key != 0 {
+		if err := bot.db.SetCommentNotification(key, msg.Chat.ID, msg.MessageID); err != nil {
+			log.Printf("Ошибка сохранения оповещения о комментарии %s: %s", comment.ID, err)
+		}
+
+		if watch != nil && watch.Priority == WATCH_CRITICAL {
+			bot.sendWatchAlert(ctx, *group, comment, key, msg)
+		}
+	}
+
+	if err := bot.sendAttachments(ctx, msg, *group, comment, withPhoto); err != nil {
+		log.Printf("Ошибка отправки вложений комментария %s: %v", comment.ID, err)
+	}
+
+	// Обрезка только из-за лимита Telegram: полный текст отправляем сразу
+	if truncated && !bot.truncationEnabled() {
+		if err := bot.sendFullText(ctx, msg, *group, comment); err != nil {
+			log.Printf("Ошибка отправки полного текста комментария: %v", err)
+		}
+	}
+
+	return nil
 }
 
 func (bot *Bot) handleTelegramComment(msg *telego.Message) {
+	// Пост канала в группе обсуждения: запоминаем для оповещений о комментариях к нему
+	if msg.IsAutomaticForward {
+		bot.saveTelegramPost(msg)
+		return
+	}
+
 	// Пропускаем служебные сообщения и сообщения от самого бота
 	if msg.From == nil {
 		return
@@ -314,16 +541,11 @@ func (bot *Bot) handleTelegramComment(msg *telego.Message) {
 		msg.Text = msg.Caption
 	}
 
-	// Check if message is spam
-	if bot.isSpam(msg.Text) {
-		log.Printf("Пропускаем спам-сообщение в Telegram от %d: %s", msg.From.ID, msg.Text)
-		return
-	}
-
 	comment := db.Comment{
-		ID:         fmt.Sprintf("tg-%d", msg.MessageID),
+		ID:         fmt.Sprintf("tg-%d-%d", msg.Chat.ID, msg.MessageID),
 		CommentID:  fmt.Sprintf("%d", msg.MessageID),
 		Author:     formatUserName(msg.From),
+		AuthorID:   strconv.FormatInt(msg.From.ID, 10),
 		Text:       msg.Text,
 		Timestamp:  int64(msg.Date),
 		PostURL:    bot.generateTelegramLink(msg),
@@ -331,22 +553,55 @@ func (bot *Bot) handleTelegramComment(msg *telego.Message) {
 		ReceivedAt: time.Now().Unix(),
 	}
 
+	// Медиа копируется в оповещение из исходного сообщения
+	if len(msg.Photo) > 0 || msg.Sticker != nil || msg.Document != nil || msg.Video != nil ||
+		msg.Animation != nil || msg.Voice != nil || msg.Audio != nil || msg.VideoNote != nil {
+		comment.Attachments = []db.Attachment{{Type: db.ATTACHMENT_TELEGRAM}}
+	}
+
+	// Комментарии к посту канала приходят в ветке пересланного поста
+	// (в форумах же ветка - это топик)
+	if msg.MessageThreadID != 0 && !msg.IsTopicMessage {
+		comment.PostID = strconv.Itoa(msg.MessageThreadID)
+	}
+
+	if parent := msg.ReplyToMessage; parent != nil {
+		text := parent.Text
+		if text == "" {
+			text = parent.Caption
+		}
+
+		if parent.IsAutomaticForward {
+			// Ответ на сам пост канала
+			comment.PostID = strconv.Itoa(parent.MessageID)
+			comment.PostText = text
+			comment.PostDate = int64(parent.Date)
+		} else {
+			// Ответ на другой комментарий
+			comment.ParentText = text
+		}
+	}
+
 	group, err := bot.db.GetGroupByNetworkAndID("tg", strconv.FormatInt(msg.Chat.ID, 10))
 	if err != nil {
 		log.Printf("Failed to get tg group by ID: %s", err)
 		return
 	}
 
+	if bot.isGroupPaused(*group) {
+		return
+	}
+
 	log.Printf("Новый комментарий в телеграм от %d в %s (%s).",
 		msg.From.ID,
 		group.GroupName,
 		group.Network,
 	)
 
-	// Обрабатываем комментарий
-	if bot.isNotificationAllowed() {
+	// Обрабатываем комментарий. Срочные не ждут рабочего времени
+	if bot.isNotificationAllowed() || bot.isUrgentComment(*group, comment) {
 		log.Printf("Оповещение о телеграм комментарии...")
-		bot.notifyNewComments(*group, []db.Comment{comment})
+		bot.notifyNewComments(bot.ctx, *group, []db.Comment{comment})
 	} else {
 		log.Printf("Добавление телеграм комментария в кэш...")
 		comment.IsPending = true
@@ -359,21 +614,8 @@ func (bot *Bot) handleTelegramComment(msg *telego.Message) {
 
 func (bot *Bot) cacheComments(group db.MonitoredGroup, comments []db.Comment) error {
 	for i := range comments {
-		_, err := bot.db.Exec(`
-            INSERT OR REPLACE INTO comments 
-            (id, group_id, network, comment_id, author, text, timestamp, post_url, is_pending, received_at)
-            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			comments[i].ID,
-			group.ID,
-			group.Network,
-			comments[i].CommentID,
-			comments[i].Author,
-			comments[i].Text,
-			comments[i].Timestamp,
-			comments[i].PostURL,
-			true,              // is_pending = true
-			time.Now().Unix(), // received_at
-		)
+		bot.attachPostContext(group, &comments[i])
+		err := bot.db.SavePendingComment(&group, &comments[i], time.Now().Unix())
 		if err != nil {
 			return err
 		}
@@ -381,36 +623,16 @@ func (bot *Bot) cacheComments(group db.MonitoredGroup, comments []db.Comment) er
 	return nil
 }
 
-func (bot *Bot) processPendingComments() error {
+func (bot *Bot) processPendingComments(ctx context.Context) error {
 	if !bot.isNotificationAllowed() {
 		return nil
 	}
 
 	// Получаем все отложенные комментарии
-	rows, err := bot.db.Query(`
-        SELECT * FROM comments 
-        WHERE is_pending = TRUE 
-        AND received_at > ?`,
-		time.Now().Add(-7*24*time.Hour).Unix(),
-	)
+	comments, err := bot.db.GetPendingComments(time.Now().Add(-7 * 24 * time.Hour).Unix())
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	var comments []db.Comment
-	for rows.Next() {
-		var c db.Comment
-		err := rows.Scan(
-			&c.ID, &c.GroupID, &c.Network, &c.CommentID,
-			&c.Author, &c.Text, &c.Timestamp, &c.PostURL,
-			&c.IsPending, &c.ReceivedAt,
-		)
-		if err != nil {
-			return err
-		}
-		comments = append(comments, c)
-	}
 
 	// Отправляем и помечаем как отправленные
 	for _, c := range comments {
@@ -421,16 +643,17 @@ func (bot *Bot) processPendingComments() error {
 
 		if group == nil {
 			log.Printf("Группа ID %d не найдена, удаляю комментарии", c.GroupID)
-			bot.db.Exec(`DELETE FROM comments WHERE group_id = ?`, c.GroupID)
+			bot.db.DeleteGroupComments(c.GroupID)
 			continue
 		}
 
-		bot.notifyNewComments(*group, []db.Comment{c})
+		if err := bot.notifyNewComments(ctx, *group, []db.Comment{c}); err != nil {
+			// Прервано завершением работы: оставшиеся остаются в кэше
+			return err
+		}
 
 		// Обновляем статус в БД
-		_, err = bot.db.Exec(`
-            UPDATE comments SET is_pending = FALSE 
-            WHERE id = ?`, c.ID)
+		err = bot.db.MarkCommentSent(c.ID)
 		if err != nil {
 			log.Printf("Ошибка обновления комментария: %v", err)
 		}
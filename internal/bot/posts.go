@@ -0,0 +1,103 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+const (
+	POST_CACHE_TTL      = 30 * 24 * time.Hour // Сколько хранится пост, к которому больше не приходят комментарии
+	POST_EXCERPT_LENGTH = 100                 // Длина отрывка поста в оповещении
+)
+
+// Дополняет комментарий постом: пришедший вместе с комментарием пост
+// сохраняется в кэш, иначе пост берется из кэша
+func (bot *Bot) attachPostContext(group db.MonitoredGroup, comment *db.Comment) {
+	if comment.PostID == "" {
+		return
+	}
+
+	if comment.PostText != "" || comment.PostDate != 0 {
+		err := bot.db.SavePost(&db.Post{
+			GroupID:   group.ID,
+			PostID:    comment.PostID,
+			Text:      comment.PostText,
+			Date:      comment.PostDate,
+			UpdatedAt: time.Now().Unix(),
+		})
+		if err != nil {
+			log.Printf("Ошибка сохранения поста %s группы %s: %s", comment.PostID, group.GroupName, err)
+		}
+		return
+	}
+
+	post, err := bot.db.GetPost(group.ID, comment.PostID)
+	if err != nil {
+		log.Printf("Ошибка получения поста %s группы %s: %s", comment.PostID, group.GroupName, err)
+		return
+	}
+	if post != nil {
+		comment.PostText = post.Text
+		comment.PostDate = post.Date
+	}
+}
+
+// Отрывок поста в одну строку
+func postExcerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > POST_EXCERPT_LENGTH {
+		text = string([]rune(text)[:POST_EXCERPT_LENGTH]) + "…"
+	}
+
+	return text
+}
+
+// Запоминает пост канала, пересланный в группу обсуждения.
+// Комментарии к нему приходят в ветке с ID этого сообщения
+func (bot *Bot) saveTelegramPost(msg *telego.Message) {
+	group, err := bot.db.GetGroupByNetworkAndID("tg", strconv.FormatInt(msg.Chat.ID, 10))
+	if err != nil || group == nil {
+		return
+	}
+
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+
+	err = bot.db.SavePost(&db.Post{
+		GroupID:   group.ID,
+		PostID:    strconv.Itoa(msg.MessageID),
+		Text:      text,
+		Date:      int64(msg.Date),
+		UpdatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения поста канала %s: %s", group.GroupName, err)
+	}
+}
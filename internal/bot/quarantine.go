@@ -0,0 +1,252 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+// Кнопки под комментарием в чате карантина
+func quarantineKeyboard(key int64) *telego.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return fmt.Sprintf("%s%s:%d", CALLBACK_ACTION, action, key)
+	}
+
+	return tu.InlineKeyboard(
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("✅ Не спам").WithCallbackData(data(ACTION_NOT_SPAM)),
+			tu.InlineKeyboardButton("✅ Не спам и запомнить").WithCallbackData(data(ACTION_NOT_SPAM_ALWAYS)),
+		),
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("🤝 Не спам, доверять автору").WithCallbackData(data(ACTION_TRUST)),
+		),
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("🚫 Спам").WithCallbackData(data(ACTION_SPAM)),
+			tu.InlineKeyboardButton("🚷 Спам, блокировать автора").WithCallbackData(data(ACTION_BLOCK)),
+		),
+	)
+}
+
+// Сохраняет комментарий, задержанный спам-правилом, без оповещения в
+// мониторинговый чат. Если задан чат карантина, комментарий пересылается туда
+func (bot *Bot) quarantineComment(ctx context.Context, group db.MonitoredGroup, comment db.Comment) {
+	log.Printf("Комментарий в %s задержан в карантине (%s): %s", group.GroupName, comment.SpamRule, comment.Text)
+
+	bot.attachPostContext(group, &comment)
+
+	comment.Network = group.Network
+	key, err := bot.db.SaveSentComment(&group, &comment, time.Now().Unix())
+	if err == nil {
+		err = bot.db.SetCommentStatus(key, ACTION_QUARANTINED, "", time.Now().Unix())
+	}
+	if err != nil {
+		log.Printf("Ошибка сохранения комментария %s в карантин: %s", comment.ID, err)
+		return
+	}
+
+	if bot.conf.Spam.QuarantineChatID == 0 {
+		return
+	}
+
+	params := &telego.SendMessageParams{
+		ChatID:          telego.ChatID{ID: bot.conf.Spam.QuarantineChatID},
+		MessageThreadID: int(bot.conf.Spam.QuarantineThreadID),
+		ReplyMarkup:     quarantineKeyboard(key),
+	}
+	text := bot.constructNotificationMessage(group, comment, bot.notificationTextLimit())
+	if _, err := bot.sendMarkup(ctx, params, text); err != nil {
+		log.Printf("Ошибка отправки комментария %s в чат карантина: %s", comment.ID, err)
+	}
+}
+
+// Кнопки под задержанным комментарием. "Спам" подтверждает решение фильтра,
+// "Не спам" доставляет комментарий в мониторинговый чат группы, а при
+// ACTION_NOT_SPAM_ALWAYS его текст больше не считается спамом.
+// ACTION_BLOCK и ACTION_TRUST дополнительно вносят автора в список
+func (bot *Bot) handleQuarantineCallback(query *telego.CallbackQuery, notification *telego.Message, action string, key int64, comment *db.Comment, group *db.MonitoredGroup) string {
+	if comment.Status != ACTION_QUARANTINED {
+		return "Комментарий уже обработан"
+	}
+
+	moderator := formatUserName(&query.From)
+
+	if action == ACTION_SPAM || action == ACTION_BLOCK {
+		answer := "Отмечено как спам"
+		if action == ACTION_BLOCK {
+			if err := bot.setAuthorList(group.Network, *comment, db.AUTHOR_BLOCKED, moderator); err != nil {
+				log.Printf("Ошибка добавления автора %s в черный список: %s", comment.Author, err)
+				return "Не удалось добавить автора в черный список"
+			}
+			answer = "Отмечено как спам, автор в черном списке"
+		}
+
+		bot.spamFeedback(*comment, true)
+		bot.setCommentStatus(key, comment, action, moderator)
+		bot.audit(query.From, action, group, comment, comment.SpamRule)
+
+		err := bot.editNotification(bot.ctx, notification, bot.notificationWithStatus(*group, *comment, bot.notificationTextLimit()), nil)
+		if err != nil {
+			log.Printf("Ошибка обновления сообщения карантина: %s", err)
+		}
+		return answer
+	}
+
+	status := ACTION_NOT_SPAM
+	if action == ACTION_TRUST {
+		if err := bot.setAuthorList(group.Network, *comment, db.AUTHOR_TRUSTED, moderator); err != nil {
+			log.Printf("Ошибка добавления автора %s в доверенные: %s", comment.Author, err)
+			return "Не удалось добавить автора в доверенные"
+		}
+		status = ACTION_TRUST
+	}
+
+	details := comment.SpamRule
+	var exception string
+	if action == ACTION_NOT_SPAM_ALWAYS {
+		normalized := normalizeSpamText(comment.Text)
+		if normalized == "" {
+			return "В тексте нет слов, запомнить исключение нельзя. Используйте \"Не спам\""
+		}
+		if !slices.Contains(bot.conf.Spam.Exceptions, normalized) {
+			bot.conf.Spam.Exceptions = append(bot.conf.Spam.Exceptions, normalized)
+			if err := bot.conf.Update(); err != nil {
+				log.Printf("Ошибка сохранения исключения спам-фильтра: %s", err)
+				return "Не удалось сохранить исключение"
+			}
+		}
+		exception = normalized
+		details += "; исключение: " + exception
+	}
+
+	bot.spamFeedback(*comment, false)
+	bot.setCommentStatus(key, comment, status, moderator)
+	bot.audit(query.From, status, group, comment, details)
+
+	err := bot.editNotification(bot.ctx, notification, bot.notificationWithStatus(*group, *comment, bot.notificationTextLimit()), nil)
+	if err != nil {
+		log.Printf("Ошибка обновления сообщения карантина: %s", err)
+	}
+
+	// Доставленное оповещение уже не помечается как спам
+	delivered := *comment
+	delivered.SpamRule = ""
+	if err := bot.sendCommentNotification(bot.ctx, group, delivered); err != nil {
+		log.Printf("Ошибка доставки комментария %s из карантина: %s", comment.ID, err)
+		return "Не удалось отправить комментарий в мониторинговый чат"
+	}
+
+	if exception != "" {
+		return "Комментарий доставлен, такой текст больше не считается спамом"
+	}
+	if status == ACTION_TRUST {
+		return "Комментарий доставлен, автор больше не проверяется спам-фильтром"
+	}
+	return "Комментарий доставлен в мониторинговый чат"
+}
+
+// Сколько задержанных комментариев показывает /quarantine по умолчанию
+const QUARANTINE_LIST_DEFAULT = 10
+
+// Показывает последние задержанные комментарии с кнопками "Не спам"
+func (bot *Bot) ListQuarantine(message *telego.Message) {
+	limit := QUARANTINE_LIST_DEFAULT
+	if parts := strings.Fields(message.Text); len(parts) > 1 {
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n <= 0 {
+			bot.sendError(message, "Неверное количество. Используйте: /quarantine [количество]")
+			return
+		}
+		limit = n
+		if limit > 50 {
+			limit = 50
+		}
+	}
+
+	keys, err := bot.db.GetCommentKeysByStatus(ACTION_QUARANTINED, limit)
+	if err != nil {
+		bot.sendError(message, "Ошибка получения карантина: "+err.Error())
+		return
+	}
+	if len(keys) == 0 {
+		bot.answerBack(message, "Карантин пуст", true)
+		return
+	}
+
+	for _, key := range keys {
+		_, comment, group, problem := bot.callbackComment(strconv.FormatInt(key, 10))
+		if problem != "" {
+			continue
+		}
+
+		params := &telego.SendMessageParams{
+			ChatID:          message.Chat.ChatID(),
+			MessageThreadID: message.MessageThreadID,
+			ReplyMarkup:     quarantineKeyboard(key),
+		}
+		text := bot.notificationWithStatus(*group, *comment, bot.notificationTextLimit())
+		if _, err := bot.sendMarkup(bot.ctx, params, text); err != nil {
+			log.Printf("Ошибка отправки комментария из карантина: %s", err)
+		}
+	}
+}
+
+func (bot *Bot) SetQuarantine(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 2 {
+		bot.sendError(message, "Неверный формат. Используйте: /setquarantine <ID чата> [ID топика] или /setquarantine off")
+		return
+	}
+
+	if strings.ToLower(parts[1]) == "off" {
+		bot.conf.Spam.QuarantineChatID = 0
+		bot.conf.Spam.QuarantineThreadID = 0
+		bot.conf.Update()
+		bot.sendSuccess(message, "Задержанные комментарии больше не пересылаются, но по-прежнему сохраняются")
+		return
+	}
+
+	route, err := parseRoute(parts[1:])
+	if err != nil {
+		bot.sendError(message, err.Error())
+		return
+	}
+
+	if err := bot.testRoute(route, "задержанные спам-фильтром комментарии"); err != nil {
+		bot.sendError(message, "Не удалось отправить тестовое сообщение, чат карантина не сохранен: "+err.Error())
+		return
+	}
+
+	bot.conf.Spam.QuarantineChatID = route.ChatID
+	bot.conf.Spam.QuarantineThreadID = route.ThreadID
+	bot.conf.Update()
+
+	bot.sendSuccess(message, fmt.Sprintf("Задержанные комментарии будут пересылаться в %s",
+		notificationTarget{ChatID: route.ChatID, ThreadID: int(route.ThreadID)}))
+}
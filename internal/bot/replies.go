@@ -0,0 +1,197 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Можно ли отвечать на комментарии соцсети из Telegram
+func (bot *Bot) canReply(network string) bool {
+	return network == "tg" || bot.social.Replier(network) != nil
+}
+
+// Публикует ответ на комментарий в соцсети
+func (bot *Bot) replyToComment(ctx context.Context, group db.MonitoredGroup, comment db.Comment, text string) error {
+	if group.Network == "tg" {
+		chatID, err := strconv.ParseInt(group.GroupID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("неверный ID чата группы: %w", err)
+		}
+		messageID, err := strconv.Atoi(comment.CommentID)
+		if err != nil {
+			return fmt.Errorf("неверный ID сообщения: %w", err)
+		}
+
+		_, err = bot.api.SendMessage(ctx, &telego.SendMessageParams{
+			ChatID:          telego.ChatID{ID: chatID},
+			Text:            text,
+			ReplyParameters: &telego.ReplyParameters{MessageID: messageID},
+		})
+		return err
+	}
+
+	replier := bot.social.Replier(group.Network)
+	if replier == nil {
+		return fmt.Errorf("ответы не поддерживаются для %s", group.Network)
+	}
+
+	if comment.PostID == "" || comment.CommentID == "" {
+		return fmt.Errorf("у комментария нет ID поста или комментария (получен до обновления бота)")
+	}
+
+	_, err := replier.CreateComment(ctx, group.GroupID, comment.PostID, comment.CommentID, text)
+	return err
+}
+
+// Обрабатывает ответ модератора на оповещение: публикует текст ответом
+// на комментарий. Возвращает false, если сообщение не ответ на оповещение
+func (bot *Bot) handleModeratorReply(message *telego.Message) bool {
+	notification := message.ReplyToMessage
+	if notification == nil || notification.From == nil || notification.From.ID != bot.api.ID() {
+		return false
+	}
+
+	text := strings.TrimSpace(message.Text)
+	if text == "" || strings.HasPrefix(text, "/") {
+		return false
+	}
+
+	key, err := bot.db.GetCommentKeyByNotification(notification.Chat.ID, notification.MessageID)
+	if err != nil {
+		log.Printf("Ошибка поиска комментария по оповещению: %s", err)
+		return false
+	}
+	if key == 0 {
+		return false
+	}
+
+	// Ответ публикуется от имени сообщества, поэтому только модераторам
+	if message.From == nil || !bot.canModerate(message.From.ID) {
+		bot.sendError(message, "Отвечать на комментарии могут только модераторы")
+		return true
+	}
+
+	_, comment, group, problem := bot.callbackComment(strconv.FormatInt(key, 10))
+	if problem != "" {
+		bot.sendError(message, problem)
+		return true
+	}
+
+	if !bot.canReply(group.Network) {
+		bot.sendError(message, "Ответы из Telegram не поддерживаются для этой соцсети, ответьте в самой группе")
+		return true
+	}
+
+	if err := bot.replyToComment(bot.ctx, *group, *comment, text); err != nil {
+		log.Printf("Ошибка публикации ответа на комментарий %s: %s", comment.ID, err)
+		bot.sendError(message, "Не удалось опубликовать ответ: "+err.Error())
+		return true
+	}
+
+	moderator := formatUserName(message.From)
+	bot.setCommentStatus(key, comment, ACTION_REPLIED, moderator)
+	bot.audit(*message.From, ACTION_REPLIED, group, comment, text)
+	bot.refreshNotification(notification, key, *group, *comment)
+
+	log.Printf("[%s] ответ на комментарий %s в %s", moderator, comment.ID, group.GroupName)
+	bot.sendSuccess(message, "Ответ опубликован")
+	return true
+}
+
+// Записывает действие модератора в журнал
+func (bot *Bot) audit(user telego.User, action string, group *db.MonitoredGroup, comment *db.Comment, details string) {
+	entry := &db.AuditEntry{
+		CreatedAt:   time.Now().Unix(),
+		Moderator:   formatUserName(&user),
+		ModeratorID: user.ID,
+		Action:      action,
+		Details:     details,
+	}
+	if group != nil {
+		entry.Network = group.Network
+		entry.GroupID = group.GroupID
+	}
+	if comment != nil {
+		entry.CommentID = comment.ID
+	}
+
+	if err := bot.db.AddAuditEntry(entry); err != nil {
+		log.Printf("Ошибка записи в журнал действий: %s", err)
+	}
+}
+
+func (bot *Bot) AuditLog(message *telego.Message) {
+	limit := 20
+	parts := strings.Fields(message.Text)
+	if len(parts) > 1 {
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n <= 0 {
+			bot.sendError(message, "Неверное количество записей")
+			return
+		}
+		limit = n
+		if limit > 100 {
+			limit = 100
+		}
+	}
+
+	entries, err := bot.db.GetAuditLog(limit)
+	if err != nil {
+		bot.sendError(message, "Ошибка получения журнала: "+err.Error())
+		return
+	}
+
+	if len(entries) == 0 {
+		bot.answerBack(message, "Журнал действий пуст", true)
+		return
+	}
+
+	response := "*Журнал действий*\n\n"
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s - *%s*: %s",
+			time.Unix(entry.CreatedAt, 0).Format("02.01.2006 15:04"),
+			escapeMarkdown(entry.Moderator), entry.Action)
+		if entry.Network != "" {
+			line += fmt.Sprintf(" (%s %s)", entry.Network, entry.GroupID)
+		}
+		if entry.CommentID != "" {
+			line += " `" + entry.CommentID + "`"
+		}
+		if entry.Details != "" {
+			details := []rune(entry.Details)
+			if len(details) > 100 {
+				details = append(details[:100], '…')
+			}
+			line += ": " + escapeMarkdown(string(details))
+		}
+		response += line + "\n"
+	}
+
+	bot.answerBack(message, response, true)
+}
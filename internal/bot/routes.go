@@ -0,0 +1,309 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Куда отправлять оповещения
+type notificationTarget struct {
+	ChatID   int64
+	ThreadID int
+}
+
+// Задан ли для группы собственный маршрут или маршрут ее метки
+func (bot *Bot) hasRoute(group db.MonitoredGroup) bool {
+	if group.RouteChatID != 0 {
+		return true
+	}
+
+	_, ok := bot.tagRoute(group.Tag)
+	return ok
+}
+
+// Маршрут метки групп из конфигурации
+func (bot *Bot) tagRoute(tag string) (RouteConf, bool) {
+	if tag == "" {
+		return RouteConf{}, false
+	}
+
+	bot.conf.mu.RLock()
+	defer bot.conf.mu.RUnlock()
+
+	route, ok := bot.conf.TagRoutes[tag]
+	return route, ok
+}
+
+// Чат оповещений группы: собственный маршрут группы, затем маршрут ее
+// метки, затем топик группы в мониторинговом чате, затем общий мониторинговый чат
+func (bot *Bot) groupTarget(group db.MonitoredGroup) notificationTarget {
+	if group.RouteChatID != 0 {
+		return notificationTarget{ChatID: group.RouteChatID, ThreadID: int(group.RouteThreadID)}
+	}
+
+	if route, ok := bot.tagRoute(group.Tag); ok {
+		return notificationTarget{ChatID: route.ChatID, ThreadID: int(route.ThreadID)}
+	}
+
+	if bot.hasGroupTopic(group) {
+		return notificationTarget{ChatID: group.TopicChatID, ThreadID: int(group.TopicThreadID)}
+	}
+
+	return notificationTarget{
+		ChatID:   bot.conf.Telegram.MonitoringChannelID,
+		ThreadID: int(bot.conf.Telegram.MonitoringThreadID),
+	}
+}
+
+func (target notificationTarget) String() string {
+	if target.ThreadID != 0 {
+		return fmt.Sprintf("%d (топик %d)", target.ChatID, target.ThreadID)
+	}
+	return fmt.Sprintf("%d", target.ChatID)
+}
+
+// Разбирает "<chat_id> [thread_id]"
+func parseRoute(args []string) (RouteConf, error) {
+	var route RouteConf
+	if len(args) == 0 {
+		return route, fmt.Errorf("не указан ID чата")
+	}
+
+	chatID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || chatID == 0 {
+		return route, fmt.Errorf("неверный ID чата")
+	}
+	route.ChatID = chatID
+
+	if len(args) > 1 {
+		threadID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || threadID < 0 {
+			return route, fmt.Errorf("неверный ID топика")
+		}
+		route.ThreadID = threadID
+	}
+
+	return route, nil
+}
+
+// Проверяет маршрут тестовым сообщением: бот должен иметь право писать в чат и топик
+func (bot *Bot) testRoute(route RouteConf, description string) error {
+	params := &telego.SendMessageParams{
+		ChatID:          telego.ChatID{ID: route.ChatID},
+		MessageThreadID: int(route.ThreadID),
+	}
+
+	_, err := bot.sendMarkup(bot.ctx, params, "🔀 Сюда будут приходить оповещения: "+escapeMarkdown(description))
+	return err
+}
+
+func (bot *Bot) Route(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 4 {
+		bot.sendError(message,
+			"Неверный формат. Используйте: /route <сеть> <ID группы> <ID чата> [ID топика] "+
+				"или /route tag <метка> <ID чата> [ID топика]",
+		)
+		return
+	}
+
+	route, err := parseRoute(parts[3:])
+	if err != nil {
+		bot.sendError(message, err.Error())
+		return
+	}
+
+	if strings.ToLower(parts[1]) == "tag" {
+		tag := parts[2]
+		if err := bot.testRoute(route, "группы с меткой "+tag); err != nil {
+			bot.sendError(message, "Не удалось отправить тестовое сообщение, маршрут не сохранен: "+err.Error())
+			return
+		}
+
+		bot.conf.Change(func() {
+			if bot.conf.TagRoutes == nil {
+				bot.conf.TagRoutes = make(map[string]RouteConf)
+			}
+			bot.conf.TagRoutes[tag] = route
+		})
+
+		bot.sendSuccess(message, fmt.Sprintf("Оповещения групп с меткой %s направлены в %s",
+			escapeMarkdown(tag), notificationTarget{ChatID: route.ChatID, ThreadID: int(route.ThreadID)}))
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	if err := bot.testRoute(route, group.GroupName); err != nil {
+		bot.sendError(message, "Не удалось отправить тестовое сообщение, маршрут не сохранен: "+err.Error())
+		return
+	}
+
+	if err := bot.db.SetGroupRoute(group.ID, route.ChatID, route.ThreadID); err != nil {
+		bot.sendError(message, "Ошибка сохранения маршрута: "+err.Error())
+		return
+	}
+
+	bot.sendSuccess(message, fmt.Sprintf("Оповещения группы %s направлены в %s",
+		escapeMarkdown(group.GroupName), notificationTarget{ChatID: route.ChatID, ThreadID: int(route.ThreadID)}))
+}
+
+func (bot *Bot) Unroute(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 3 {
+		bot.sendError(message, "Неверный формат. Используйте: /unroute <сеть> <ID группы> или /unroute tag <метка>")
+		return
+	}
+
+	if strings.ToLower(parts[1]) == "tag" {
+		tag := parts[2]
+		if _, ok := bot.tagRoute(tag); !ok {
+			bot.sendError(message, "Для метки "+escapeMarkdown(tag)+" нет маршрута")
+			return
+		}
+
+		bot.conf.Change(func() {
+			delete(bot.conf.TagRoutes, tag)
+		})
+
+		bot.sendSuccess(message, "Группы с меткой "+escapeMarkdown(tag)+" снова оповещают в общий чат")
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	if err := bot.db.SetGroupRoute(group.ID, 0, 0); err != nil {
+		bot.sendError(message, "Ошибка удаления маршрута: "+err.Error())
+		return
+	}
+
+	group.RouteChatID, group.RouteThreadID = 0, 0
+	bot.sendSuccess(message, fmt.Sprintf("Оповещения группы %s идут в %s",
+		escapeMarkdown(group.GroupName), bot.groupTarget(*group)))
+}
+
+func (bot *Bot) SetGroupTag(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 3 {
+		bot.sendError(message, "Неверный формат. Используйте: /tag <сеть> <ID группы> [метка] (без метки - убрать)")
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	var tag string
+	if len(parts) > 3 {
+		tag = parts[3]
+	}
+
+	if err := bot.db.SetGroupTag(group.ID, tag); err != nil {
+		bot.sendError(message, "Ошибка сохранения метки: "+err.Error())
+		return
+	}
+
+	if tag == "" {
+		bot.sendSuccess(message, "Метка группы "+escapeMarkdown(group.GroupName)+" убрана")
+		return
+	}
+
+	bot.sendSuccess(message, fmt.Sprintf("Группе %s назначена метка %s", escapeMarkdown(group.GroupName), escapeMarkdown(tag)))
+}
+
+func (bot *Bot) ListRoutes(message *telego.Message) {
+	groups, err := bot.db.GetGroups()
+	if err != nil {
+		log.Printf("Ошибка получения групп: %s", err)
+		bot.sendError(message, "Ошибка получения групп")
+		return
+	}
+
+	response := "*Маршруты оповещений*\n\n"
+	response += fmt.Sprintf("*По умолчанию*: %s\n", bot.groupTarget(db.MonitoredGroup{}))
+
+	bot.conf.mu.RLock()
+	if len(bot.conf.TagRoutes) > 0 {
+		tags := make([]string, 0, len(bot.conf.TagRoutes))
+		for tag := range bot.conf.TagRoutes {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		response += "\n*Метки*:\n"
+		for _, tag := range tags {
+			route := bot.conf.TagRoutes[tag]
+			response += fmt.Sprintf("- %s → %s\n", escapeMarkdown(tag),
+				notificationTarget{ChatID: route.ChatID, ThreadID: int(route.ThreadID)})
+		}
+	}
+	bot.conf.mu.RUnlock()
+
+	response += "\n*Группы*:\n"
+	routed := 0
+	for _, group := range groups {
+		if group.RouteChatID == 0 && group.Tag == "" {
+			continue
+		}
+		routed++
+
+		line := fmt.Sprintf("- (%s) %s `%s`", group.Network, escapeMarkdown(group.GroupName), group.GroupID)
+		if group.Tag != "" {
+			line += ", метка " + escapeMarkdown(group.Tag)
+		}
+		response += line + " → " + bot.groupTarget(group).String() + "\n"
+	}
+
+	if routed == 0 {
+		response += "Все группы оповещают в чат по умолчанию\n"
+	}
+
+	bot.answerBack(message, response, true)
+}
@@ -0,0 +1,457 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Тональность комментария
+const (
+	MOOD_TOXIC    = "toxic"    // Оскорбления и мат, независимо от оценки
+	MOOD_NEGATIVE = "negative" // Оценка не выше SENTIMENT_NEGATIVE
+	MOOD_POSITIVE = "positive" // Оценка не ниже SENTIMENT_POSITIVE
+	MOOD_NEUTRAL  = "neutral"
+)
+
+const (
+	SENTIMENT_NEGATIVE = -1.0
+	SENTIMENT_POSITIVE = 1.0
+)
+
+// Метки тональности в оповещениях. У нейтральных метки нет
+var moodEmoji = map[string]string{
+	MOOD_TOXIC:    "🤬",
+	MOOD_NEGATIVE: "😠",
+	MOOD_POSITIVE: "🙂",
+}
+
+var moodNames = map[string]string{
+	MOOD_TOXIC:    "токсичный",
+	MOOD_NEGATIVE: "негативный",
+	MOOD_POSITIVE: "позитивный",
+	MOOD_NEUTRAL:  "нейтральный",
+}
+
+// Встроенный словарь: основа слова -> вес. Слово учитывается, если
+// начинается с основы. Основы подобраны так, чтобы не задевать
+// однокоренные слова с другим смыслом ("любл", а не "люб" из-за "любой")
+var builtinLexicon = map[string]float64{
+	"спасиб": 2, "благодар": 2, "отличн": 2, "прекрасн": 2, "замечательн": 2,
+	"великолепн": 3, "шикарн": 2, "супер": 2, "класс": 1, "круто": 2, "крутой": 2,
+	"нрав": 1, "понрав": 2, "любл": 2, "обожа": 2, "рекоменд": 1, "вкусн": 2,
+	"восторг": 3, "восхит": 3, "молодц": 2, "удобн": 1, "хорош": 1, "доволен": 2,
+	"довольн": 2, "лучш": 1, "приятн": 1, "радует": 1, "радуют": 1,
+
+	"плох": -2, "ужасн": -3, "ужас": -2, "отврат": -3, "кошмар": -2, "обман": -2,
+	"мошенн": -3, "жалоб": -1, "недовол": -2, "разочаров": -2, "хамств": -2,
+	"хамск": -2, "грубо": -1, "грубы": -1, "худш": -2, "гадост": -2, "тухл": -2,
+	"испорч": -2, "просроч": -2, "слома": -1, "верните": -2,
+	"отравл": -3, "позор": -2, "безобраз": -2, "бесит": -2, "бесят": -2,
+	"ненавиж": -3, "отстой": -2, "фигн": -1, "ерунд": -1, "жалк": -2,
+	"неудобн": -1, "невкусн": -2, "грязн": -2, "опозда": -1, "задерж": -1,
+	"некачествен": -2, "бракован": -2, "воняет": -2, "вонь": -2,
+}
+
+// Эмодзи, которые тоже считаются словами словаря
+var emojiLexicon = map[string]float64{
+	"👍": 1, "❤": 1, "😍": 2, "🔥": 1, "🙏": 1, "😊": 1,
+	"👎": -1, "😡": -2, "🤬": -2, "💩": -2, "😠": -1,
+}
+
+// Основы оскорблений и мата. Текст сначала приводится к кириллице
+// (см. homoglyphs), чтобы "xyй" и "д3бил" тоже находились
+var builtinToxicWords = []string{
+	"хуй", "хуе", "хуя", "хуи", "пизд", "ебан", "ебат", "ебал", "еблан", "уеб",
+	"заеб", "выеб", "долбоеб", "бля", "сука", "суки", "сучк", "мудак", "мудил",
+	"гандон", "пидор", "пидар", "шлюх", "дебил", "идиот", "урод", "мраз",
+	"тварь", "твари", "кретин", "придур", "дурак", "козел", "козлы", "сволоч",
+	"скотин", "ублюд", "говн", "гнид", "чмо", "даун",
+}
+
+// Частицы, меняющие знак следующего слова: "не нравится"
+var negations = map[string]bool{"не": true, "ни": true}
+
+// Результат оценки текста
+type sentimentResult struct {
+	Score    float64
+	Toxicity int
+	Words    int      // Сколько в тексте слов
+	Matches  []string // Найденные слова с весами, для /sentiment test
+}
+
+// Слова текста в нижнем регистре, латиница и цифры-двойники заменены кириллицей
+func sentimentWords(text string) []string {
+	var folded strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if replacement, ok := homoglyphs[r]; ok {
+			r = replacement
+		}
+		folded.WriteRune(r)
+	}
+
+	return strings.FieldsFunc(folded.String(), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// Вес слова по словарю: основы из настроек важнее встроенных
+func (bot *Bot) lexiconWeight(word string) (string, float64) {
+	best, weight := "", 0.0
+	consider := func(stem string, w float64) {
+		// Самая длинная подходящая основа точнее
+		if strings.HasPrefix(word, stem) && len(stem) > len(best) {
+			best, weight = stem, w
+		}
+	}
+
+	bot.conf.mu.RLock()
+	defer bot.conf.mu.RUnlock()
+
+	for stem, w := range builtinLexicon {
+		if _, overridden := bot.conf.Sentiment.Lexicon[stem]; !overridden {
+			consider(stem, w)
+		}
+	}
+	for stem, w := range bot.conf.Sentiment.Lexicon {
+		consider(strings.ToLower(stem), w)
+	}
+
+	return best, weight
+}
+
+func (bot *Bot) isToxicWord(word string) bool {
+	for _, stem := range builtinToxicWords {
+		if strings.HasPrefix(word, stem) {
+			return true
+		}
+	}
+	bot.conf.mu.RLock()
+	defer bot.conf.mu.RUnlock()
+
+	for _, stem := range bot.conf.Sentiment.ToxicWords {
+		if stem = strings.ToLower(strings.TrimSpace(stem)); stem != "" && strings.HasPrefix(word, stem) {
+			return true
+		}
+	}
+	return false
+}
+
+// Оценивает текст по словарю: сумма весов найденных слов, знак слова
+// после отрицания меняется, а вес уменьшается вдвое ("не плохо" - слабый плюс)
+func (bot *Bot) analyzeSentiment(text string) sentimentResult {
+	var result sentimentResult
+	words := sentimentWords(text)
+	result.Words = len(words)
+
+	negated := false
+	for _, word := range words {
+		if negations[word] {
+			negated = true
+			continue
+		}
+
+		if bot.isToxicWord(word) {
+			result.Toxicity++
+			result.Matches = append(result.Matches, word+" (оскорбление)")
+			negated = false
+			continue
+		}
+
+		stem, weight := bot.lexiconWeight(word)
+		if stem != "" && weight != 0 {
+			if negated {
+				weight = -weight / 2
+			}
+			result.Score += weight
+			result.Matches = append(result.Matches, fmt.Sprintf("%s (%+g)", word, weight))
+		}
+		negated = false
+	}
+
+	for emoji, weight := range emojiLexicon {
+		if count := strings.Count(text, emoji); count > 0 {
+			result.Score += weight * float64(count)
+			result.Matches = append(result.Matches, fmt.Sprintf("%s×%d (%+g)", emoji, count, weight))
+		}
+	}
+
+	result.Score = math.Round(result.Score*10) / 10
+	return result
+}
+
+// Оценивает комментарий и запоминает оценку в нем
+func (bot *Bot) scoreSentiment(comment *db.Comment) sentimentResult {
+	if !bot.conf.Sentiment.Enabled {
+		return sentimentResult{}
+	}
+
+	result := bot.analyzeSentiment(comment.Text)
+	comment.Sentiment = result.Score
+	comment.Toxicity = result.Toxicity
+	return result
+}
+
+// Тональность комментария по сохраненной оценке (MOOD_*)
+func commentMood(comment db.Comment) string {
+	switch {
+	case comment.Toxicity > 0:
+		return MOOD_TOXIC
+	case comment.Sentiment <= SENTIMENT_NEGATIVE:
+		return MOOD_NEGATIVE
+	case comment.Sentiment >= SENTIMENT_POSITIVE:
+		return MOOD_POSITIVE
+	default:
+		return MOOD_NEUTRAL
+	}
+}
+
+// Не отправлять ли оповещение: короткий положительный комментарий вроде "Спасибо!"
+func (bot *Bot) isIgnoredPositive(comment db.Comment, result sentimentResult) bool {
+	limit := bot.conf.Sentiment.IgnorePositiveWords
+	return limit > 0 && commentMood(comment) == MOOD_POSITIVE && result.Words <= limit
+}
+
+// Маршрут по тональности комментария. Токсичные комментарии без
+// собственного маршрута идут по маршруту негативных
+func (bot *Bot) moodTarget(comment db.Comment) (notificationTarget, bool) {
+	mood := commentMood(comment)
+	bot.conf.mu.RLock()
+	route, ok := bot.conf.Sentiment.Routes[mood]
+	if !ok && mood == MOOD_TOXIC {
+		route, ok = bot.conf.Sentiment.Routes[MOOD_NEGATIVE]
+	}
+	bot.conf.mu.RUnlock()
+	if !ok || route.ChatID == 0 {
+		return notificationTarget{}, false
+	}
+
+	return notificationTarget{ChatID: route.ChatID, ThreadID: int(route.ThreadID)}, true
+}
+
+const sentimentUsage = "Используйте:\n" +
+	"`/sentiment` - настройки\n" +
+	"`/sentiment test <текст>` - оценить текст\n" +
+	"`/sentiment route <тональность> <ID чата> [ID топика]` или `/sentiment route <тональность> off` - маршрут оповещений\n" +
+	"`/sentiment ignore <N>` - не оповещать о положительных комментариях не длиннее N слов (0 - оповещать)\n" +
+	"`/sentiment word <основа> <вес>` - добавить слово в словарь (вес 0 - не учитывать слово)\n" +
+	"`/sentiment toxic <основа>` или `/sentiment toxic rm <основа>` - оскорбления\n" +
+	"`/sentiment on` или `/sentiment off` - включить или выключить оценку\n\n" +
+	"Тональности: `toxic`, `negative`, `positive`, `neutral`"
+
+func (bot *Bot) SentimentCommand(message *telego.Message) {
+	args, rest := cutFields(message.Text, 2)
+	if len(args) < 2 {
+		bot.ShowSentimentSettings(message)
+		return
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "test":
+		if rest == "" {
+			bot.sendError(message, "Укажите текст: `/sentiment test спасибо, все отлично`")
+			return
+		}
+		bot.TestSentiment(message, rest)
+
+	case "route":
+		bot.setMoodRoute(message, strings.Fields(rest))
+
+	case "ignore":
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			bot.sendError(message, "Укажите количество слов: `/sentiment ignore 2`")
+			return
+		}
+		bot.conf.Sentiment.IgnorePositiveWords = n
+		bot.conf.Update()
+		if n == 0 {
+			bot.sendSuccess(message, "Оповещения о положительных комментариях отправляются все")
+		} else {
+			bot.sendSuccess(message, fmt.Sprintf("Положительные комментарии не длиннее %d слов больше не отправляются", n))
+		}
+
+	case "word":
+		fields := strings.Fields(rest)
+		if len(fields) != 2 {
+			bot.sendError(message, "Используйте: `/sentiment word <основа> <вес>`, например `/sentiment word пересол -2`")
+			return
+		}
+		weight, err := strconv.ParseFloat(strings.Replace(fields[1], ",", ".", 1), 64)
+		if err != nil {
+			bot.sendError(message, "Вес должен быть числом, например -2 или 1.5")
+			return
+		}
+		stem := strings.ToLower(fields[0])
+		bot.conf.Change(func() {
+			if bot.conf.Sentiment.Lexicon == nil {
+				bot.conf.Sentiment.Lexicon = make(map[string]float64)
+			}
+			bot.conf.Sentiment.Lexicon[stem] = weight
+		})
+		bot.sendSuccess(message, fmt.Sprintf("Вес слов на «%s»: %+g", escapeMarkdown(stem), weight))
+
+	case "toxic":
+		bot.setToxicWord(message, strings.Fields(rest))
+
+	case "on", "off":
+		bot.conf.Sentiment.Enabled = strings.ToLower(args[1]) == "on"
+		bot.conf.Update()
+		if bot.conf.Sentiment.Enabled {
+			bot.sendSuccess(message, "Оценка тональности включена")
+		} else {
+			bot.sendSuccess(message, "Оценка тональности выключена")
+		}
+
+	default:
+		bot.answerBack(message, sentimentUsage, true)
+	}
+}
+
+func (bot *Bot) setMoodRoute(message *telego.Message, fields []string) {
+	if len(fields) < 2 {
+		bot.sendError(message, "Используйте: `/sentiment route negative <ID чата> [ID топика]`")
+		return
+	}
+
+	mood := strings.ToLower(fields[0])
+	if _, ok := moodNames[mood]; !ok {
+		bot.sendError(message, "Неизвестная тональность "+escapeMarkdown(mood))
+		return
+	}
+
+	if strings.ToLower(fields[1]) == "off" {
+		bot.conf.Change(func() {
+			delete(bot.conf.Sentiment.Routes, mood)
+		})
+		bot.sendSuccess(message, fmt.Sprintf("Оповещения о комментариях с тональностью «%s» идут в обычный чат группы", moodNames[mood]))
+		return
+	}
+
+	route, err := parseRoute(fields[1:])
+	if err != nil {
+		bot.sendError(message, escapeMarkdown(err.Error()))
+		return
+	}
+	if err := bot.testRoute(route, "комментарии с тональностью «"+moodNames[mood]+"»"); err != nil {
+		bot.sendError(message, "Не удалось отправить сообщение в этот чат: "+escapeMarkdown(err.Error()))
+		return
+	}
+
+	bot.conf.Change(func() {
+		if bot.conf.Sentiment.Routes == nil {
+			bot.conf.Sentiment.Routes = make(map[string]RouteConf)
+		}
+		bot.conf.Sentiment.Routes[mood] = route
+	})
+	bot.sendSuccess(message, fmt.Sprintf("Оповещения о комментариях с тональностью «%s» будут приходить в %d", moodNames[mood], route.ChatID))
+}
+
+func (bot *Bot) setToxicWord(message *telego.Message, fields []string) {
+	remove := len(fields) == 2 && strings.ToLower(fields[0]) == "rm"
+	if remove {
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		bot.sendError(message, "Используйте: `/sentiment toxic <основа>` или `/sentiment toxic rm <основа>`")
+		return
+	}
+	stem := strings.ToLower(fields[0])
+
+	found := false
+	bot.conf.Change(func() {
+		words := make([]string, 0, len(bot.conf.Sentiment.ToxicWords)+1)
+		for _, existing := range bot.conf.Sentiment.ToxicWords {
+			if existing == stem {
+				found = true
+				if remove {
+					continue
+				}
+			}
+			words = append(words, existing)
+		}
+		if !found && !remove {
+			words = append(words, stem)
+		}
+		bot.conf.Sentiment.ToxicWords = words
+	})
+
+	switch {
+	case found && !remove:
+		bot.sendError(message, "Эта основа уже в списке")
+		return
+	case found:
+		bot.sendSuccess(message, "Основа «"+escapeMarkdown(stem)+"» убрана из оскорблений")
+		return
+	case remove:
+		bot.sendError(message, "Такой основы нет в списке. Встроенные основы не удаляются")
+		return
+	}
+	bot.sendSuccess(message, "Слова на «"+escapeMarkdown(stem)+"» считаются оскорблениями")
+}
+
+func (bot *Bot) ShowSentimentSettings(message *telego.Message) {
+	bot.conf.mu.RLock()
+	conf := bot.conf.Sentiment
+
+	response := fmt.Sprintf("*Оценка тональности*: `%v`\n", conf.Enabled)
+	response += fmt.Sprintf("*Слов в словаре*: %d встроенных, %d своих\n", len(builtinLexicon), len(conf.Lexicon))
+	response += fmt.Sprintf("*Основ оскорблений*: %d встроенных, %d своих\n", len(builtinToxicWords), len(conf.ToxicWords))
+	if conf.IgnorePositiveWords > 0 {
+		response += fmt.Sprintf("*Не оповещать о положительных*: до %d слов\n", conf.IgnorePositiveWords)
+	}
+
+	moods := make([]string, 0, len(conf.Routes))
+	for mood := range conf.Routes {
+		moods = append(moods, mood)
+	}
+	sort.Strings(moods)
+	for _, mood := range moods {
+		route := conf.Routes[mood]
+		response += fmt.Sprintf("*Маршрут «%s»*: `%d` (топик `%d`)\n", moodNames[mood], route.ChatID, route.ThreadID)
+	}
+	bot.conf.mu.RUnlock()
+
+	bot.answerBack(message, response+"\n"+sentimentUsage, true)
+}
+
+func (bot *Bot) TestSentiment(message *telego.Message, text string) {
+	result := bot.analyzeSentiment(text)
+	mood := commentMood(db.Comment{Sentiment: result.Score, Toxicity: result.Toxicity})
+
+	response := fmt.Sprintf("Оценка: %+g, оскорблений: %d, слов: %d\nТональность: %s %s\n",
+		result.Score, result.Toxicity, result.Words, moodEmoji[mood], moodNames[mood])
+	if len(result.Matches) > 0 {
+		response += "\nНайдено: " + escapeMarkdown(strings.Join(result.Matches, ", "))
+	}
+	if !bot.conf.Sentiment.Enabled {
+		response += "\n\n⚠️ Оценка тональности выключена (`/sentiment on`)"
+	}
+
+	bot.answerBack(message, response, true)
+}
@@ -20,6 +20,7 @@ package ok
 
 import (
 	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
@@ -38,20 +39,20 @@ const (
 )
 
 type Client struct {
-	accessToken string
-	publicKey   string
-	secretKey   string
-	appID       string
-	http        *http.Client
+	tokens    *social.TokenPool
+	publicKey string
+	secretKey string
+	appID     string
+	http      *http.Client
 }
 
-func NewClient(accessToken, publicKey, secretKey, appID string) *Client {
+func NewClient(tokens *social.TokenPool, publicKey, secretKey, appID string) *Client {
 	return &Client{
-		accessToken: accessToken,
-		publicKey:   publicKey,
-		secretKey:   secretKey,
-		appID:       appID,
-		http:        &http.Client{Timeout: 30 * time.Second},
+		tokens:    tokens,
+		publicKey: publicKey,
+		secretKey: secretKey,
+		appID:     appID,
+		http:      &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
@@ -79,22 +80,65 @@ func (c *Client) signRequest(params url.Values) string {
 	return strings.ToLower(hex.EncodeToString(hash[:]))
 }
 
-func (c *Client) callMethod(ctx context.Context, method string, params url.Values) (json.RawMessage, error) {
+// Вызывает метод API токеном, назначенным группе group. При ошибках
+// лимитов токен отстраняется и запрос повторяется следующим токеном
+func (c *Client) callMethod(ctx context.Context, group string, method string, params url.Values) (json.RawMessage, error) {
+	attempts := max(c.tokens.Len(), 1)
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		token, err := c.tokens.Acquire(group)
+		if err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (%s)", lastErr, err)
+			}
+			return nil, err
+		}
+
+		response, err := c.doCall(ctx, token.Value, method, params)
+		if err == nil {
+			return response, nil
+		}
+
+		okErr, isAPIErr := err.(*OKError)
+		if !isAPIErr {
+			return nil, err
+		}
+
+		benchFor, shouldBench := benchDuration(okErr)
+		if !shouldBench {
+			c.tokens.Fail(token, okErr.Error())
+			return nil, err
+		}
+
+		c.tokens.Bench(token, benchFor, okErr.Error())
+		lastErr = fmt.Errorf("%w: %w", social.ErrRateLimited, err)
+	}
+
+	return nil, lastErr
+}
+
+func (c *Client) doCall(ctx context.Context, accessToken string, method string, params url.Values) (json.RawMessage, error) {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+
 	// Устанавливаем общие параметры
-	params.Set("application_key", c.publicKey)
-	params.Set("format", "json")
-	params.Set("method", method)
+	query.Set("application_key", c.publicKey)
+	query.Set("format", "json")
+	query.Set("method", method)
 
 	// Добавляем access_token, если он есть
-	if c.accessToken != "" {
-		params.Set("access_token", c.accessToken)
+	if accessToken != "" {
+		query.Set("access_token", accessToken)
 	}
 
 	// Создаем подпись
-	sig := c.signRequest(params)
-	params.Set("sig", sig)
+	sig := c.signRequest(query)
+	query.Set("sig", sig)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(params.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(query.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -112,9 +156,51 @@ func (c *Client) callMethod(ctx context.Context, method string, params url.Value
 		return nil, fmt.Errorf("failed to decode raw response: %w", err)
 	}
 
+	// Ошибки приходят объектом с полем error_code
+	trimmed := bytes.TrimSpace(rawResponse)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var apiErr OKError
+		if err := json.Unmarshal(trimmed, &apiErr); err == nil && apiErr.Code != 0 {
+			return nil, &apiErr
+		}
+	}
+
 	return rawResponse, nil
 }
 
+type OKError struct {
+	Code    int    `json:"error_code"`
+	Message string `json:"error_msg"`
+}
+
+func (e *OKError) Error() string {
+	return fmt.Sprintf("OK API error %d: %s", e.Code, e.Message)
+}
+
+// Коды ошибок OK API, при которых токен нужно временно отстранить
+const (
+	errCodeActionBlocked  = 7
+	errCodeFloodBlocked   = 8
+	errCodeIPBlocked      = 9
+	errCodeLimitReached   = 11
+	errCodeSessionExpired = 102
+	errCodeSessionKey     = 103
+)
+
+// На сколько отстранить токен после ошибки
+func benchDuration(err *OKError) (time.Duration, bool) {
+	switch err.Code {
+	case errCodeFloodBlocked:
+		return time.Minute, true
+	case errCodeActionBlocked, errCodeIPBlocked:
+		return 15 * time.Minute, true
+	case errCodeLimitReached, errCodeSessionExpired, errCodeSessionKey:
+		return time.Hour, true
+	default:
+		return 0, false
+	}
+}
+
 // GetGroupName возвращает название группы
 func (c *Client) GetGroupName(ctx context.Context, groupID string) (string, error) {
 	info, err := c.GetGroupInfo(ctx, groupID)
@@ -154,7 +240,7 @@ func (c *Client) tryGetGroupInfo(ctx context.Context, groupID string) (*social.G
 	params.Set("uids", groupID)
 	params.Set("fields", "name,description,members_count")
 
-	response, err := c.callMethod(ctx, "group.getInfo", params)
+	response, err := c.callMethod(ctx, groupID, "group.getInfo", params)
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +280,7 @@ func (c *Client) resolveGroupID(ctx context.Context, shortName string) (string,
 	params := url.Values{}
 	params.Set("url", urlToCheck)
 
-	response, err := c.callMethod(ctx, "url.getInfo", params)
+	response, err := c.callMethod(ctx, "", "url.getInfo", params)
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve group ID: %w", err)
 	}
@@ -211,12 +297,12 @@ func (c *Client) resolveGroupID(ctx context.Context, shortName string) (string,
 }
 
 // Получаем информацию о пользователе по ID
-func (c *Client) getUserName(ctx context.Context, userID string) (string, error) {
+func (c *Client) getUserName(ctx context.Context, group string, userID string) (string, error) {
 	params := url.Values{}
 	params.Set("uids", userID)
 	params.Set("fields", "name") // Запрашиваем только имя пользователя
 
-	response, err := c.callMethod(ctx, "users.getInfo", params)
+	response, err := c.callMethod(ctx, group, "users.getInfo", params)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,53 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ok
+
+import (
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Код стикера в тексте комментария: #ud6f8934c00#192:192s#
+	stickerCode = regexp.MustCompile(`#u[0-9a-z]+#\d+:\d+s?#`)
+	// Ссылка на медиа, которую OK подставляет в текст вместо вложения
+	mediaURL = regexp.MustCompile(`media_url"?\s*[:=]\s*"?(https?://[^"\s,}]+)`)
+)
+
+// OK не отдает вложения комментариев отдельным полем, они приходят
+// служебной разметкой в тексте. Возвращает текст без нее и найденные вложения
+func parseAttachments(text string) (string, []db.Attachment) {
+	var attachments []db.Attachment
+
+	for range stickerCode.FindAllString(text, -1) {
+		attachments = append(attachments, db.Attachment{Type: db.ATTACHMENT_STICKER})
+	}
+	text = stickerCode.ReplaceAllString(text, "")
+
+	if match := mediaURL.FindStringSubmatch(text); match != nil {
+		attachments = append(attachments, db.Attachment{
+			Type: db.ATTACHMENT_PHOTO,
+			URL:  match[1],
+		})
+		text = ""
+	}
+
+	return strings.TrimSpace(text), attachments
+}
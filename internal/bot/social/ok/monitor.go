@@ -19,22 +19,25 @@
 package ok
 
 import (
+	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
 	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int64) ([]db.Comment, error) {
+func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int64, postsCount int) ([]db.Comment, error) {
 	if !isValidOKGroupID(groupID) {
 		return nil, fmt.Errorf("invalid group ID")
 	}
 
 	// 1. Получаем последние посты
-	posts, err := c.getGroupFeed(ctx, groupID)
+	posts, err := c.getGroupFeed(ctx, groupID, postsCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get posts: %w", err)
 	}
@@ -42,13 +45,23 @@ func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int6
 	var comments []db.Comment
 
 	// 2. Для каждого поста получаем комментарии
-	for _, post := range posts {
+	for i, post := range posts {
 		if post.Type != "GROUP_THEME" {
 			continue
 		}
+		if i > 0 {
+			if err := social.Pace(ctx, social.PostRequestInterval); err != nil {
+				return nil, err
+			}
+		}
 
-		postComments, err := c.getPostComments(ctx, post.ID, groupID, lastCheck)
+		postComments, err := c.getPostComments(ctx, post, groupID, lastCheck)
 		if err != nil {
+			// Без токенов не проверить и остальные посты: проверка группы
+			// неудачна, чтобы время последней проверки не сдвинулось
+			if ctx.Err() != nil || errors.Is(err, social.ErrRateLimited) {
+				return nil, fmt.Errorf("failed to get comments: %w", err)
+			}
 			continue
 		}
 
@@ -58,27 +71,46 @@ func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int6
 	return comments, nil
 }
 
-func (c *Client) getGroupFeed(ctx context.Context, groupID string) ([]OKPost, error) {
-	params := url.Values{}
-	params.Set("gid", groupID)
-	params.Set("count", "50") // N последних постов
+// Максимальное количество топиков в одном запросе mediatopic.getTopics
+const feedPageSize = 50
+
+func (c *Client) getGroupFeed(ctx context.Context, groupID string, count int) ([]OKPost, error) {
+	var topics []OKTopic
+	anchor := ""
+	for len(topics) < count {
+		params := url.Values{}
+		params.Set("gid", groupID)
+		params.Set("count", strconv.Itoa(min(feedPageSize, count-len(topics)))) // N последних постов
+		if anchor != "" {
+			params.Set("anchor", anchor)
+			params.Set("direction", "FORWARD")
+		}
 
-	response, err := c.callMethod(ctx, "mediatopic.getTopics", params)
-	if err != nil {
-		return nil, err
-	}
+		response, err := c.callMethod(ctx, groupID, "mediatopic.getTopics", params)
+		if err != nil {
+			return nil, err
+		}
 
-	var feed struct {
-		MediaTopics []OKTopic `json:"media_topics"`
-	}
+		var feed struct {
+			MediaTopics []OKTopic `json:"media_topics"`
+			Anchor      string    `json:"anchor"`
+			HasMore     bool      `json:"has_more"`
+		}
 
-	if err := json.Unmarshal(response, &feed); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal feed: %w", err)
+		if err := json.Unmarshal(response, &feed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal feed: %w", err)
+		}
+
+		topics = append(topics, feed.MediaTopics...)
+		if !feed.HasMore || feed.Anchor == "" || len(feed.MediaTopics) == 0 {
+			break
+		}
+		anchor = feed.Anchor
 	}
 
 	// Преобразуем OKTopic в OKPost
 	var posts []OKPost
-	for _, topic := range feed.MediaTopics {
+	for _, topic := range topics {
 		// log.Printf("TOPIC: %+v", topic)
 
 		// Извлекаем текст из media
@@ -143,13 +175,15 @@ type OKPost struct {
 	Text string `json:"text"`
 }
 
-func (c *Client) getPostComments(ctx context.Context, postID, groupID string, lastCheck int64) ([]db.Comment, error) {
+func (c *Client) getPostComments(ctx context.Context, post OKPost, groupID string, lastCheck int64) ([]db.Comment, error) {
+	postID := post.ID
+
 	params := url.Values{}
 	params.Set("discussionId", postID)
 	params.Set("discussionType", "GROUP_TOPIC")
 	params.Set("count", "100")
 
-	response, err := c.callMethod(ctx, "discussions.getComments", params)
+	response, err := c.callMethod(ctx, groupID, "discussions.getComments", params)
 	if err != nil {
 		return nil, err
 	}
@@ -168,6 +202,12 @@ func (c *Client) getPostComments(ctx context.Context, postID, groupID string, la
 	var comments []db.Comment
 	postURL := fmt.Sprintf("https://ok.ru/group/%s/topic/%s ", groupID, postID)
 
+	// Тексты комментариев для подстановки родительского комментария в ответах
+	texts := make(map[string]string, len(result.Comments))
+	for _, comment := range result.Comments {
+		texts[comment.ID] = comment.Text
+	}
+
 	for _, comment := range result.Comments {
 		commentTime, err := time.ParseInLocation("2006-01-02 15:04:05", comment.Date, time.Local)
 		if err != nil {
@@ -187,19 +227,28 @@ func (c *Client) getPostComments(ctx context.Context, postID, groupID string, la
 		authorName := userMap[comment.AuthorID]
 		if authorName == "" {
 			// Делаем дополнительный запрос к users.getInfo
-			name, err := c.getUserName(ctx, comment.AuthorID)
+			name, err := c.getUserName(ctx, groupID, comment.AuthorID)
 			if err != nil {
 				name = "Unknown"
 			}
 			authorName = name
 		}
 
+		text, attachments := parseAttachments(comment.Text)
+
 		comments = append(comments, db.Comment{
-			ID:        fmt.Sprintf("ok-%s", comment.ID),
-			Author:    authorName,
-			Text:      comment.Text,
-			Timestamp: commentTimeUTC.Unix(),
-			PostURL:   postURL,
+			ID:          fmt.Sprintf("ok-%s", comment.ID),
+			CommentID:   comment.ID,
+			Author:      authorName,
+			AuthorID:    comment.AuthorID,
+			PostID:      postID,
+			Text:        text,
+			Timestamp:   commentTimeUTC.Unix(),
+			PostURL:     postURL,
+			ParentText:  texts[comment.ReplyToCommentID],
+			Attachments: attachments,
+			PostText:    post.Text,
+			PostDate:    post.Created / 1000, // created_ms
 		})
 	}
 
@@ -219,6 +268,8 @@ type OKComment struct {
 	Date       string `json:"date"`
 	AuthorID   string `json:"author_id"`
 	AuthorName string `json:"-"`
+	// ID комментария, на который это ответ (пусто - не ответ)
+	ReplyToCommentID string `json:"reply_to_comment_id"`
 }
 
 type OKAuthor struct {
@@ -22,6 +22,7 @@ import (
 	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
 	"context"
 	"fmt"
+	"time"
 )
 
 type GroupInfo struct {
@@ -30,21 +31,57 @@ type GroupInfo struct {
 	ScreenName string `json:"screen_name"`
 }
 
+// Сколько последних постов просматривается при обычной проверке
+const DefaultPostsCount = 50
+
+// Пауза между запросами комментариев к постам одной группы. VK разрешает
+// 3 запроса в секунду на токен; при наверстывании постов бывают сотни
+const PostRequestInterval = 350 * time.Millisecond
+
+// Ждет d или отмены ctx
+func Pace(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 type APIClient interface {
 	GetGroupName(ctx context.Context, groupID string) (string, error)
-	GetComments(ctx context.Context, groupID string, lastCheck int64) ([]db.Comment, error)
+	// Возвращает комментарии новее lastCheck под postsCount последними постами
+	GetComments(ctx context.Context, groupID string, lastCheck int64, postsCount int) ([]db.Comment, error)
 	GetGroupInfo(ctx context.Context, groupIdentifier string) (*GroupInfo, error)
 }
 
+// Клиент, умеющий публиковать ответы на комментарии от имени сообщества.
+// Клиент ОК его не реализует: ответы для ОК не сделаны
+type CommentReplier interface {
+	CreateComment(ctx context.Context, groupID, postID, replyToCommentID, text string) (string, error)
+}
+
+// Клиент, умеющий удалять комментарии и блокировать авторов в сообществе.
+// Клиент ОК его не реализует: модерация для ОК не сделана
+type CommentModerator interface {
+	DeleteComment(ctx context.Context, groupID, postID, commentID string) error
+	BanAuthor(ctx context.Context, groupID, authorID string) error
+}
+
 type SocialManager struct {
 	VKClient APIClient
 	OKClient APIClient
 	TGClient APIClient
-}
 
-func (sm *SocialManager) GetGroupName(network, groupID string) (string, error) {
-	ctx := context.Background()
+	// Пулы токенов, используемые клиентами
+	VKTokens *TokenPool
+	OKTokens *TokenPool
+}
 
+func (sm *SocialManager) GetGroupName(ctx context.Context, network, groupID string) (string, error) {
 	switch network {
 	case "vk":
 		return sm.VKClient.GetGroupName(ctx, groupID)
@@ -57,6 +94,29 @@ func (sm *SocialManager) GetGroupName(network, groupID string) (string, error) {
 	}
 }
 
+func (sm *SocialManager) client(network string) APIClient {
+	switch network {
+	case "vk":
+		return sm.VKClient
+	case "ok":
+		return sm.OKClient
+	default:
+		return nil
+	}
+}
+
+// Клиент для публикации ответов в соцсети. nil, если соцсеть не поддерживает ответы
+func (sm *SocialManager) Replier(network string) CommentReplier {
+	replier, _ := sm.client(network).(CommentReplier)
+	return replier
+}
+
+// Клиент для модерации в соцсети. nil, если соцсеть не поддерживает модерацию
+func (sm *SocialManager) Moderator(network string) CommentModerator {
+	moderator, _ := sm.client(network).(CommentModerator)
+	return moderator
+}
+
 type Monitor interface {
 	CheckNewComments(groupID int64, lastCheck int64) ([]db.Comment, error)
 }
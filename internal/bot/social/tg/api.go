@@ -42,7 +42,7 @@ func (c *Client) GetGroupName(ctx context.Context, groupID string) (string, erro
 	return groupID, nil
 }
 
-func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int64) ([]db.Comment, error) {
+func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int64, postsCount int) ([]db.Comment, error) {
 	// Для Telegram мы обрабатываем комментарии в реальном времени
 	// Этот метод не используется
 	return nil, nil
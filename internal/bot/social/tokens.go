@@ -0,0 +1,215 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package social
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Запрос не выполнен из-за лимитов API: все токены отстранены. Проверка
+// группы с такой ошибкой должна считаться неудачной, а не пропускать пост
+var ErrRateLimited = errors.New("API rate limit")
+
+// Токен API в пуле
+type Token struct {
+	Name  string
+	Value string
+
+	benchedUntil time.Time
+	lastError    string
+	requests     int
+	failures     int
+}
+
+// Состояние токена без самого секрета
+type TokenStatus struct {
+	Name         string
+	Masked       string
+	BenchedUntil time.Time
+	LastError    string
+	Requests     int
+	Failures     int
+	Groups       int
+}
+
+// Пул токенов одной соцсети. Группы распределяются по токенам по кругу
+// либо закрепляются за токеном явно. Токен, упершийся в лимиты,
+// временно отстраняется, и запросы уходят на следующий
+type TokenPool struct {
+	mu       sync.Mutex
+	tokens   []*Token
+	pinned   map[string]string // ID группы -> имя токена
+	assigned map[string]int    // ID группы -> индекс токена
+	next     int
+}
+
+func NewTokenPool(tokens []Token, pinned map[string]string) *TokenPool {
+	pool := &TokenPool{
+		pinned:   pinned,
+		assigned: make(map[string]int),
+	}
+	if pool.pinned == nil {
+		pool.pinned = make(map[string]string)
+	}
+
+	for i := range tokens {
+		if tokens[i].Value == "" {
+			continue
+		}
+		token := tokens[i]
+		pool.tokens = append(pool.tokens, &token)
+	}
+
+	return pool
+}
+
+func (p *TokenPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.tokens)
+}
+
+func (p *TokenPool) available(token *Token, now time.Time) bool {
+	return now.After(token.benchedUntil)
+}
+
+// Возвращает токен для запроса от имени группы. Пустой group означает
+// запрос без привязки к группе. Если закрепленный или назначенный токен
+// отстранен, используется следующий доступный
+func (p *TokenPool) Acquire(group string) (*Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("no API tokens configured")
+	}
+
+	now := time.Now()
+
+	preferred := -1
+	if name, ok := p.pinned[group]; ok {
+		for i, token := range p.tokens {
+			if token.Name == name {
+				preferred = i
+				break
+			}
+		}
+	}
+	if preferred == -1 && group != "" {
+		idx, ok := p.assigned[group]
+		if !ok || idx >= len(p.tokens) {
+			idx = p.next % len(p.tokens)
+			p.next++
+			p.assigned[group] = idx
+		}
+		preferred = idx
+	}
+	if preferred == -1 {
+		preferred = p.next % len(p.tokens)
+		p.next++
+	}
+
+	for i := 0; i < len(p.tokens); i++ {
+		token := p.tokens[(preferred+i)%len(p.tokens)]
+		if p.available(token, now) {
+			token.requests++
+			return token, nil
+		}
+	}
+
+	// Все отстранены: сообщаем, когда освободится ближайший
+	soonest := p.tokens[0].benchedUntil
+	for _, token := range p.tokens[1:] {
+		if token.benchedUntil.Before(soonest) {
+			soonest = token.benchedUntil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: all API tokens are benched until %s", ErrRateLimited, soonest.Format("15:04:05"))
+}
+
+// Отстраняет токен на duration после ошибки reason
+func (p *TokenPool) Bench(token *Token, duration time.Duration, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token.benchedUntil = time.Now().Add(duration)
+	token.lastError = reason
+	token.failures++
+}
+
+// Отмечает неудачный запрос без отстранения токена
+func (p *TokenPool) Fail(token *Token, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token.lastError = reason
+	token.failures++
+}
+
+// Состояние всех токенов пула
+func (p *TokenPool) Status() []TokenStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	groups := make(map[int]int)
+	for _, idx := range p.assigned {
+		groups[idx]++
+	}
+	for _, name := range p.pinned {
+		for i, token := range p.tokens {
+			if token.Name == name {
+				groups[i]++
+			}
+		}
+	}
+
+	var statuses []TokenStatus
+	for i, token := range p.tokens {
+		statuses = append(statuses, TokenStatus{
+			Name:         token.Name,
+			Masked:       maskToken(token.Value),
+			BenchedUntil: token.benchedUntil,
+			LastError:    token.lastError,
+			Requests:     token.requests,
+			Failures:     token.failures,
+			Groups:       groups[i],
+		})
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// Оставляет от токена лишь последние 4 символа
+func maskToken(value string) string {
+	if len(value) <= 8 {
+		return "••••"
+	}
+
+	return "••••" + value[len(value)-4:]
+}
@@ -37,30 +37,76 @@ const (
 )
 
 type Client struct {
-	token      string
-	http       *http.Client
-	usersCache map[int]UserInfo
-	cacheMutex sync.Mutex
+	tokens *social.TokenPool
+	// Токены сообществ для публикации от имени сообщества: ID группы -> токен
+	communityTokens map[string]string
+	http            *http.Client
+	usersCache      map[int]UserInfo
+	cacheMutex      sync.Mutex
 }
 
-func NewClient(token string) *Client {
+func NewClient(tokens *social.TokenPool, communityTokens map[string]string) *Client {
 	return &Client{
-		token:      token,
-		http:       &http.Client{Timeout: 30 * time.Second},
-		usersCache: make(map[int]UserInfo),
-		cacheMutex: sync.Mutex{},
+		tokens:          tokens,
+		communityTokens: communityTokens,
+		http:            &http.Client{Timeout: 30 * time.Second},
+		usersCache:      make(map[int]UserInfo),
+		cacheMutex:      sync.Mutex{},
 	}
 }
 
-func (c *Client) callMethod(ctx context.Context, method string, params url.Values) (json.RawMessage, error) {
-	params.Set("access_token", c.token)
-	params.Set("v", apiVersion)
+// Вызывает метод API токеном, назначенным группе group. При ошибках
+// лимитов токен отстраняется и запрос повторяется следующим токеном
+func (c *Client) callMethod(ctx context.Context, group string, method string, params url.Values) (json.RawMessage, error) {
+	attempts := max(c.tokens.Len(), 1)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL+method, nil)
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		token, err := c.tokens.Acquire(group)
+		if err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (%s)", lastErr, err)
+			}
+			return nil, err
+		}
+
+		response, err := c.doCall(ctx, token.Value, method, params)
+		if err == nil {
+			return response, nil
+		}
+
+		vkErr, ok := err.(*VKError)
+		if !ok {
+			return nil, err
+		}
+
+		benchFor, shouldBench := benchDuration(vkErr)
+		if !shouldBench {
+			c.tokens.Fail(token, vkErr.Error())
+			return nil, err
+		}
+
+		c.tokens.Bench(token, benchFor, vkErr.Error())
+		lastErr = fmt.Errorf("%w: %w", social.ErrRateLimited, err)
+	}
+
+	return nil, lastErr
+}
+
+func (c *Client) doCall(ctx context.Context, token string, method string, params url.Values) (json.RawMessage, error) {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Set("access_token", token)
+	query.Set("v", apiVersion)
+
+	// POST: тексты комментариев могут не поместиться в URL
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL+method, strings.NewReader(query.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.URL.RawQuery = params.Encode()
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := c.http.Do(req)
 	if err != nil {
@@ -84,6 +130,29 @@ func (c *Client) callMethod(ctx context.Context, method string, params url.Value
 	return result.Response, nil
 }
 
+// Коды ошибок VK API, при которых токен нужно временно отстранить
+const (
+	errCodeAuthFailed     = 5
+	errCodeTooManyPerSec  = 6
+	errCodeFloodControl   = 9
+	errCodeCaptchaNeeded  = 14
+	errCodeRateLimitReach = 29
+)
+
+// На сколько отстранить токен после ошибки
+func benchDuration(err *VKError) (time.Duration, bool) {
+	switch err.Code {
+	case errCodeTooManyPerSec:
+		return 10 * time.Second, true
+	case errCodeFloodControl, errCodeCaptchaNeeded:
+		return 15 * time.Minute, true
+	case errCodeRateLimitReach, errCodeAuthFailed:
+		return time.Hour, true
+	default:
+		return 0, false
+	}
+}
+
 type VKError struct {
 	Code    int    `json:"error_code"`
 	Message string `json:"error_msg"`
@@ -129,7 +198,7 @@ func (c *Client) GetGroupInfo(ctx context.Context, groupIdentifier string) (*soc
 	}
 	params.Set("fields", "name,description,members_count")
 
-	response, err := c.callMethod(ctx, "groups.getById", params)
+	response, err := c.callMethod(ctx, groupIdentifier, "groups.getById", params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get group info: %w", err)
 	}
@@ -161,7 +230,7 @@ func (c *Client) GetGroupName(ctx context.Context, groupID string) (string, erro
 	}
 	return info.Name, nil
 }
-func (c *Client) getUsersInfo(ctx context.Context, userIDs []int) (map[int]UserInfo, error) {
+func (c *Client) getUsersInfo(ctx context.Context, group string, userIDs []int) (map[int]UserInfo, error) {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 
@@ -182,7 +251,7 @@ func (c *Client) getUsersInfo(ctx context.Context, userIDs []int) (map[int]UserI
 	}
 
 	// Запрашиваем только недостающие ID
-	users, err := c.fetchUsersInfo(ctx, missingIDs)
+	users, err := c.fetchUsersInfo(ctx, group, missingIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -202,7 +271,7 @@ type UserInfo struct {
 	LastName  string `json:"last_name"`
 }
 
-func (c *Client) fetchUsersInfo(ctx context.Context, userIDs []int) (map[int]UserInfo, error) {
+func (c *Client) fetchUsersInfo(ctx context.Context, group string, userIDs []int) (map[int]UserInfo, error) {
 	// Разбиваем на группы по 1000 пользователей
 	batchSize := 1000
 	result := make(map[int]UserInfo)
@@ -214,7 +283,7 @@ func (c *Client) fetchUsersInfo(ctx context.Context, userIDs []int) (map[int]Use
 		}
 
 		batch := userIDs[i:end]
-		users, err := c.makeUsersRequest(ctx, batch)
+		users, err := c.makeUsersRequest(ctx, group, batch)
 		if err != nil {
 			return nil, err
 		}
@@ -227,7 +296,7 @@ func (c *Client) fetchUsersInfo(ctx context.Context, userIDs []int) (map[int]Use
 	return result, nil
 }
 
-func (c *Client) makeUsersRequest(ctx context.Context, userIDs []int) (map[int]UserInfo, error) {
+func (c *Client) makeUsersRequest(ctx context.Context, group string, userIDs []int) (map[int]UserInfo, error) {
 	if len(userIDs) == 0 {
 		return nil, nil
 	}
@@ -243,7 +312,7 @@ func (c *Client) makeUsersRequest(ctx context.Context, userIDs []int) (map[int]U
 	params.Set("user_ids", idsStr)
 	params.Set("fields", "first_name,last_name")
 
-	response, err := c.callMethod(ctx, "users.get", params)
+	response, err := c.callMethod(ctx, group, "users.get", params)
 	if err != nil {
 		return nil, err
 	}
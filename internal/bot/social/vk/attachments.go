@@ -0,0 +1,116 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package vk
+
+import (
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+	"fmt"
+	"strings"
+)
+
+// Вложение комментария в ответе wall.getComments
+type VKAttachment struct {
+	Type  string `json:"type"`
+	Photo *struct {
+		Sizes []VKImage `json:"sizes"`
+	} `json:"photo,omitempty"`
+	Sticker *struct {
+		Images []VKImage `json:"images"`
+	} `json:"sticker,omitempty"`
+	Doc *struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"doc,omitempty"`
+	Link *struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"link,omitempty"`
+	Video *struct {
+		ID      int    `json:"id"`
+		OwnerID int    `json:"owner_id"`
+		Title   string `json:"title"`
+	} `json:"video,omitempty"`
+	Audio *struct {
+		Artist string `json:"artist"`
+		Title  string `json:"title"`
+	} `json:"audio,omitempty"`
+}
+
+// Размер фото или стикера
+type VKImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Ссылка на изображение наибольшего размера
+func largestImage(images []VKImage) string {
+	var best VKImage
+	for _, image := range images {
+		if best.URL == "" || image.Width*image.Height > best.Width*best.Height {
+			best = image
+		}
+	}
+
+	return best.URL
+}
+
+// Переводит вложения VK в вложения комментария. Неизвестные типы пропускаются
+func parseAttachments(attachments []VKAttachment) []db.Attachment {
+	var result []db.Attachment
+	for _, attachment := range attachments {
+		switch {
+		case attachment.Photo != nil:
+			result = append(result, db.Attachment{
+				Type: db.ATTACHMENT_PHOTO,
+				URL:  largestImage(attachment.Photo.Sizes),
+			})
+		case attachment.Sticker != nil:
+			result = append(result, db.Attachment{
+				Type: db.ATTACHMENT_STICKER,
+				URL:  largestImage(attachment.Sticker.Images),
+			})
+		case attachment.Doc != nil:
+			result = append(result, db.Attachment{
+				Type:  db.ATTACHMENT_DOC,
+				URL:   attachment.Doc.URL,
+				Title: attachment.Doc.Title,
+			})
+		case attachment.Link != nil:
+			result = append(result, db.Attachment{
+				Type:  db.ATTACHMENT_LINK,
+				URL:   attachment.Link.URL,
+				Title: attachment.Link.Title,
+			})
+		case attachment.Video != nil:
+			result = append(result, db.Attachment{
+				Type:  db.ATTACHMENT_VIDEO,
+				URL:   fmt.Sprintf("https://vk.ru/video%d_%d", attachment.Video.OwnerID, attachment.Video.ID),
+				Title: attachment.Video.Title,
+			})
+		case attachment.Audio != nil:
+			result = append(result, db.Attachment{
+				Type:  db.ATTACHMENT_AUDIO,
+				Title: strings.TrimSpace(attachment.Audio.Artist + " - " + attachment.Audio.Title),
+			})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,92 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package vk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Вызывает метод токеном сообщества, а если его нет - токеном пользователя
+// из пула (он должен быть администратором группы)
+func (c *Client) communityCall(ctx context.Context, groupID string, method string, params url.Values) (json.RawMessage, error) {
+	if token := c.communityTokens[groupID]; token != "" {
+		return c.doCall(ctx, token, method, params)
+	}
+	return c.callMethod(ctx, groupID, method, params)
+}
+
+// Публикует ответ на комментарий от имени сообщества. Используется токен
+// сообщества, а если его нет - токен пользователя-администратора группы.
+// Возвращает ID нового комментария
+func (c *Client) CreateComment(ctx context.Context, groupID, postID, replyToCommentID, text string) (string, error) {
+	params := url.Values{}
+	params.Set("owner_id", "-"+groupID)
+	params.Set("post_id", postID)
+	params.Set("from_group", groupID)
+	params.Set("message", text)
+	if replyToCommentID != "" {
+		params.Set("reply_to_comment", replyToCommentID)
+	}
+
+	response, err := c.communityCall(ctx, groupID, "wall.createComment", params)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		CommentID int `json:"comment_id"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return strconv.Itoa(result.CommentID), nil
+}
+
+// Удаляет комментарий со стены сообщества
+func (c *Client) DeleteComment(ctx context.Context, groupID, postID, commentID string) error {
+	params := url.Values{}
+	params.Set("owner_id", "-"+groupID)
+	params.Set("comment_id", commentID)
+
+	_, err := c.communityCall(ctx, groupID, "wall.deleteComment", params)
+	return err
+}
+
+// Добавляет пользователя в черный список сообщества бессрочно. Метод
+// доступен только с токеном пользователя-администратора
+func (c *Client) BanAuthor(ctx context.Context, groupID, authorID string) error {
+	if strings.HasPrefix(authorID, "-") {
+		return fmt.Errorf("автор - сообщество, его нельзя заблокировать")
+	}
+
+	params := url.Values{}
+	params.Set("group_id", groupID)
+	params.Set("owner_id", authorID)
+	params.Set("comment", "Спам")
+	params.Set("comment_visible", "0")
+
+	_, err := c.callMethod(ctx, groupID, "groups.ban", params)
+	return err
+}
@@ -19,15 +19,17 @@
 package vk
 
 import (
+	"Unbewohnte/SNGCNOTIFIERbot/internal/bot/social"
 	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
 )
 
-func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int64) ([]db.Comment, error) {
+func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int64, postsCount int) ([]db.Comment, error) {
 	// Нормализуем ID группы
 	normalizedID, isNumeric := c.normalizeGroupIdentifier(groupID)
 	if normalizedID == "" {
@@ -44,7 +46,7 @@ func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int6
 	}
 
 	// Получаем посты
-	posts, err := c.getWallPosts(ctx, normalizedID)
+	posts, err := c.getWallPosts(ctx, normalizedID, postsCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get posts: %w", err)
 	}
@@ -54,9 +56,20 @@ func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int6
 	var comments []db.Comment
 
 	// Получаем комментарии для каждого поста
-	for _, post := range posts {
-		postComments, err := c.getNewPostComments(ctx, normalizedID, post.ID, lastCheck)
+	for i, post := range posts {
+		if i > 0 {
+			if err := social.Pace(ctx, social.PostRequestInterval); err != nil {
+				return nil, err
+			}
+		}
+
+		postComments, err := c.getNewPostComments(ctx, normalizedID, post, lastCheck)
 		if err != nil {
+			// Без токенов не проверить и остальные посты: проверка группы
+			// неудачна, чтобы время последней проверки не сдвинулось
+			if ctx.Err() != nil || errors.Is(err, social.ErrRateLimited) {
+				return nil, fmt.Errorf("failed to get comments: %w", err)
+			}
 			continue // Пропускаем посты с ошибками
 		}
 		comments = append(comments, postComments...)
@@ -65,34 +78,47 @@ func (c *Client) GetComments(ctx context.Context, groupID string, lastCheck int6
 	return comments, nil
 }
 
-func (c *Client) getWallPosts(ctx context.Context, groupIdentifier string) ([]WallPost, error) {
+// Максимальное количество постов в одном запросе wall.get
+const wallPageSize = 100
+
+func (c *Client) getWallPosts(ctx context.Context, groupIdentifier string, count int) ([]WallPost, error) {
 	normalized, isNumeric := c.normalizeGroupIdentifier(groupIdentifier)
 	if normalized == "" {
 		return nil, fmt.Errorf("invalid group identifier")
 	}
 
-	params := url.Values{}
-	if isNumeric {
-		params.Set("owner_id", "-"+normalized) // Для числовых ID
-	} else {
-		params.Set("domain", normalized) // Для коротких имен
-	}
-	params.Set("count", "50")     // Получаем N последних постов
-	params.Set("filter", "owner") // Только посты владельца группы
+	var posts []WallPost
+	for offset := 0; offset < count; offset += wallPageSize {
+		params := url.Values{}
+		if isNumeric {
+			params.Set("owner_id", "-"+normalized) // Для числовых ID
+		} else {
+			params.Set("domain", normalized) // Для коротких имен
+		}
+		params.Set("count", strconv.Itoa(min(wallPageSize, count-offset))) // Получаем N последних постов
+		params.Set("offset", strconv.Itoa(offset))
+		params.Set("filter", "owner") // Только посты владельца группы
 
-	response, err := c.callMethod(ctx, "wall.get", params)
-	if err != nil {
-		return nil, err
-	}
+		response, err := c.callMethod(ctx, normalized, "wall.get", params)
+		if err != nil {
+			return nil, err
+		}
 
-	var result struct {
-		Items []WallPost `json:"items"`
-	}
-	if err := json.Unmarshal(response, &result); err != nil {
-		return nil, err
+		var result struct {
+			Count int        `json:"count"`
+			Items []WallPost `json:"items"`
+		}
+		if err := json.Unmarshal(response, &result); err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, result.Items...)
+		if len(result.Items) == 0 || offset+len(result.Items) >= result.Count {
+			break
+		}
 	}
 
-	return result.Items, nil
+	return posts, nil
 }
 
 type WallPost struct {
@@ -107,7 +133,9 @@ type WallPost struct {
 	} `json:"reposts"`
 }
 
-func (c *Client) getNewPostComments(ctx context.Context, groupID string, postID int, lastCheck int64) ([]db.Comment, error) {
+func (c *Client) getNewPostComments(ctx context.Context, groupID string, post WallPost, lastCheck int64) ([]db.Comment, error) {
+	postID := post.ID
+
 	params := url.Values{}
 	params.Set("owner_id", "-"+groupID)
 	params.Set("post_id", strconv.Itoa(postID))
@@ -115,7 +143,7 @@ func (c *Client) getNewPostComments(ctx context.Context, groupID string, postID
 	params.Set("count", "100") // Максимальное количество комментариев
 	params.Set("sort", "desc") // Сначала новые
 
-	response, err := c.callMethod(ctx, "wall.getComments", params)
+	response, err := c.callMethod(ctx, groupID, "wall.getComments", params)
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +166,7 @@ func (c *Client) getNewPostComments(ctx context.Context, groupID string, postID
 	}
 
 	// Получаем информацию о пользователях
-	usersInfo, err := c.getUsersInfo(ctx, userIDs)
+	usersInfo, err := c.getUsersInfo(ctx, groupID, userIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users info: %w", err)
 	}
@@ -146,6 +174,12 @@ func (c *Client) getNewPostComments(ctx context.Context, groupID string, postID
 	var comments []db.Comment
 	postURL := fmt.Sprintf("https://vk.ru/wall-%s_%d", groupID, postID)
 
+	// Тексты комментариев для подстановки родительского комментария в ответах
+	texts := make(map[int]string, len(result.Items))
+	for _, comment := range result.Items {
+		texts[comment.ID] = comment.Text
+	}
+
 	for _, comment := range result.Items {
 		if comment.Date <= lastCheck {
 			continue
@@ -160,11 +194,19 @@ func (c *Client) getNewPostComments(ctx context.Context, groupID string, postID
 		}
 
 		comments = append(comments, db.Comment{
-			ID:        fmt.Sprintf("vk-%d", comment.ID),
-			Author:    authorName,
-			Text:      comment.Text,
-			Timestamp: comment.Date,
-			PostURL:   postURL,
+			// ID комментариев уникальны только в пределах стены
+			ID:          fmt.Sprintf("vk-%s_%d", groupID, comment.ID),
+			CommentID:   strconv.Itoa(comment.ID),
+			Author:      authorName,
+			AuthorID:    strconv.Itoa(comment.FromID),
+			PostID:      strconv.Itoa(postID),
+			Text:        comment.Text,
+			Timestamp:   comment.Date,
+			PostURL:     postURL,
+			ParentText:  texts[comment.ReplyToComment],
+			Attachments: parseAttachments(comment.Attachments),
+			PostText:    post.Text,
+			PostDate:    post.Date,
 		})
 	}
 
@@ -178,7 +220,10 @@ type VKComment struct {
 	Date    int64  `json:"date"`
 	PostID  int    `json:"post_id"`
 	OwnerID int    `json:"owner_id"`
-	Likes   struct {
+	// ID комментария, на который это ответ (0 - не ответ)
+	ReplyToComment int            `json:"reply_to_comment"`
+	Attachments    []VKAttachment `json:"attachments"`
+	Likes          struct {
 		Count int `json:"count"`
 	} `json:"likes"`
 }
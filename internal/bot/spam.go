@@ -0,0 +1,419 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+var spamRuleTypes = map[string]string{
+	SPAM_RULE_SUBSTRING:  "подстрока",
+	SPAM_RULE_WORD:       "слово",
+	SPAM_RULE_REGEX:      "регулярное выражение",
+	SPAM_RULE_NORMALIZED: "нормализованный текст",
+}
+
+var spamActions = map[string]string{
+	SPAM_ACTION_DROP:       "отбросить",
+	SPAM_ACTION_QUARANTINE: "в карантин",
+	SPAM_ACTION_TAG:        "пометить",
+}
+
+// Чем больше, тем строже действие. При совпадении нескольких правил выполняется самое строгое
+var spamActionSeverity = map[string]int{
+	SPAM_ACTION_TAG:        1,
+	SPAM_ACTION_QUARANTINE: 2,
+	SPAM_ACTION_DROP:       3,
+}
+
+// Похожие латинские буквы и цифры, которыми заменяют кириллицу, чтобы обойти фильтр
+var homoglyphs = map[rune]rune{
+	'a': 'а', 'b': 'в', 'c': 'с', 'e': 'е', 'h': 'н', 'k': 'к', 'm': 'м',
+	'o': 'о', 'p': 'р', 't': 'т', 'u': 'и', 'x': 'х', 'y': 'у',
+	'0': 'о', '3': 'з', '4': 'ч', '6': 'б', '@': 'а', 'ё': 'е',
+}
+
+// Приводит текст к виду, в котором не работают уловки против фильтра:
+// латиница и цифры, похожие на кириллицу, заменяются ею, пробелы, знаки
+// и невидимые символы удаляются, повторы букв схлопываются.
+// "П и ш u в Л.С" и "пиишии в лс" дают "пишивлс"
+func normalizeSpamText(text string) string {
+	var out strings.Builder
+	var last rune
+	for _, r := range strings.ToLower(text) {
+		if folded, ok := homoglyphs[r]; ok {
+			r = folded
+		}
+		if !unicode.IsLetter(r) || r == last {
+			continue
+		}
+
+		out.WriteRune(r)
+		last = r
+	}
+
+	return out.String()
+}
+
+// Скомпилированные выражения правил по шаблону
+var spamRegexps sync.Map
+
+func spamRuleRegexp(rule SpamRule) (*regexp.Regexp, error) {
+	var source string
+	switch rule.Type {
+	case SPAM_RULE_REGEX:
+		source = "(?i)" + rule.Pattern
+	case SPAM_RULE_WORD:
+		// Фраза целиком, не внутри других слов
+		source = `(?i)(?:^|[^\p{L}\p{N}_])` + regexp.QuoteMeta(rule.Pattern) + `(?:$|[^\p{L}\p{N}_])`
+	default:
+		return nil, fmt.Errorf("правило типа %s не использует выражений", rule.Type)
+	}
+
+	if cached, ok := spamRegexps.Load(source); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	spamRegexps.Store(source, re)
+
+	return re, nil
+}
+
+func spamRuleMatches(rule SpamRule, text string) bool {
+	switch rule.Type {
+	case SPAM_RULE_SUBSTRING:
+		return strings.Contains(strings.ToLower(text), strings.ToLower(rule.Pattern))
+	case SPAM_RULE_NORMALIZED:
+		pattern := normalizeSpamText(rule.Pattern)
+		return pattern != "" && strings.Contains(normalizeSpamText(text), pattern)
+	case SPAM_RULE_WORD, SPAM_RULE_REGEX:
+		re, err := spamRuleRegexp(rule)
+		return err == nil && re.MatchString(text)
+	}
+
+	return false
+}
+
+// Относится ли правило к группе
+func spamRuleApplies(rule SpamRule, group db.MonitoredGroup) bool {
+	return rule.Scope == "" || rule.Scope == group.Network || rule.Scope == group.Network+":"+group.GroupID
+}
+
+func spamScopeName(scope string) string {
+	if scope == "" {
+		return "все группы"
+	}
+	return scope
+}
+
+// Краткое описание правила для оповещений и журнала
+func describeSpamRule(rule SpamRule) string {
+	if rule.Type == SPAM_RULE_BAYES {
+		return fmt.Sprintf("%s (%s)", BAYES_RULE_PREFIX, rule.Pattern)
+	}
+	if rule.Type == SPAM_RULE_CONTACT {
+		return rule.Pattern
+	}
+	if rule.Type == SPAM_RULE_AUTHOR {
+		return fmt.Sprintf("автор в черном списке (%s)", rule.Pattern)
+	}
+	if rule.ID == 0 {
+		return fmt.Sprintf("ключевое слово «%s»", rule.Pattern)
+	}
+	return fmt.Sprintf("правило #%d (%s «%s»)", rule.ID, spamRuleTypes[rule.Type], rule.Pattern)
+}
+
+// Действие для ключевых слов. В конфигурациях, созданных до появления
+// карантина, keywords_action нет - такие комментарии, как и раньше, отбрасываются
+func (bot *Bot) keywordsAction() string {
+	if _, ok := spamActions[bot.conf.Spam.KeywordsAction]; ok {
+		return bot.conf.Spam.KeywordsAction
+	}
+	return SPAM_ACTION_DROP
+}
+
+// Правила, действующие для группы. Ключевые слова Spam.Keywords - это
+// правила-подстроки для всех групп с действием Spam.KeywordsAction,
+// если они не учитываются классификатором (withKeywords = false)
+func (bot *Bot) spamRulesFor(group *db.MonitoredGroup, withKeywords bool) []SpamRule {
+	action := bot.keywordsAction()
+
+	rules := make([]SpamRule, 0, len(bot.conf.Spam.Keywords)+len(bot.conf.Spam.Rules))
+	for _, keyword := range bot.conf.Spam.Keywords {
+		if !withKeywords {
+			break
+		}
+		rules = append(rules, SpamRule{
+			Type:    SPAM_RULE_SUBSTRING,
+			Pattern: keyword,
+			Action:  action,
+		})
+	}
+
+	for _, rule := range bot.conf.Spam.Rules {
+		if group == nil || spamRuleApplies(rule, *group) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// Признан ли текст модератором не спамом
+func (bot *Bot) isSpamException(text string) bool {
+	normalized := normalizeSpamText(text)
+	return normalized != "" && slices.Contains(bot.conf.Spam.Exceptions, normalized)
+}
+
+// Проверяет комментарий группы по спискам авторов, спам-правилам и
+// классификатору. Возвращает самое строгое из сработавших правил или nil.
+// Пока классификатор не обучен, ключевые слова работают как правила,
+// а после - как часть его оценки
+func (bot *Bot) checkSpam(group db.MonitoredGroup, comment db.Comment) *SpamRule {
+	// Списки авторов действуют даже при выключенном фильтре
+	switch bot.authorList(group.Network, comment) {
+	case db.AUTHOR_TRUSTED:
+		return nil
+	case db.AUTHOR_BLOCKED:
+		return bot.blockedAuthorRule(comment)
+	}
+
+	text := comment.Text
+	if !bot.conf.Spam.FilterSpam || bot.isSpamException(text) {
+		return nil
+	}
+
+	bayes := bot.bayesActive()
+
+	var matched *SpamRule
+	if bayes {
+		matched = bot.bayesRule(text)
+	}
+
+	rules := bot.spamRulesFor(&group, !bayes)
+	for _, rule := range append(rules, bot.contactRules(group.Network, comment, true)...) {
+		if rule.Type != SPAM_RULE_CONTACT && !spamRuleMatches(rule, text) {
+			continue
+		}
+		if matched == nil || spamActionSeverity[rule.Action] > spamActionSeverity[matched.Action] {
+			matched = &rule
+		}
+	}
+
+	return matched
+}
+
+// Разбирает "<тип> <действие> <область> <шаблон>"
+func parseSpamRule(text string) (SpamRule, error) {
+	args, pattern := cutFields(text, 3)
+	if len(args) < 3 || pattern == "" {
+		return SpamRule{}, fmt.Errorf("укажите тип, действие, область и шаблон")
+	}
+
+	rule := SpamRule{
+		Type:    strings.ToLower(args[0]),
+		Action:  strings.ToLower(args[1]),
+		Scope:   strings.ToLower(args[2]),
+		Pattern: pattern,
+	}
+
+	if _, ok := spamRuleTypes[rule.Type]; !ok {
+		return rule, fmt.Errorf("неизвестный тип %s", rule.Type)
+	}
+	if _, ok := spamActions[rule.Action]; !ok {
+		return rule, fmt.Errorf("неизвестное действие %s", rule.Action)
+	}
+
+	if rule.Scope == "all" {
+		rule.Scope = ""
+	}
+	network, _, _ := strings.Cut(rule.Scope, ":")
+	if rule.Scope != "" && network != "vk" && network != "ok" && network != "tg" {
+		return rule, fmt.Errorf("неизвестная область %s", rule.Scope)
+	}
+
+	switch rule.Type {
+	case SPAM_RULE_REGEX, SPAM_RULE_WORD:
+		if _, err := spamRuleRegexp(rule); err != nil {
+			return rule, fmt.Errorf("некорректное выражение: %w", err)
+		}
+	case SPAM_RULE_NORMALIZED:
+		if normalizeSpamText(rule.Pattern) == "" {
+			return rule, fmt.Errorf("после нормализации от шаблона ничего не осталось")
+		}
+	}
+
+	return rule, nil
+}
+
+const spamRuleUsage = "Используйте:\n" +
+	"`/spamrule add <тип> <действие> <область> <шаблон>` - добавить правило\n" +
+	"`/spamrule rm <id>` - удалить правило\n" +
+	"`/spamrule list` - список правил\n" +
+	"`/spamrule test <текст>` - проверить текст\n\n" +
+	"Типы: `substring`, `word`, `regex`, `normalized`\n" +
+	"Действия: `drop` - отбросить, `quarantine` - в карантин (`/setquarantine`), `tag` - оповестить с пометкой\n" +
+	"Область: `all`, соцсеть (`vk`) или группа (`vk:123`)"
+
+func (bot *Bot) SpamRuleCommand(message *telego.Message) {
+	args, rest := cutFields(message.Text, 2)
+	if len(args) < 2 {
+		bot.answerBack(message, spamRuleUsage, true)
+		return
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "add":
+		rule, err := parseSpamRule(rest)
+		if err != nil {
+			bot.sendError(message, escapeMarkdown(err.Error())+"\n\n"+spamRuleUsage)
+			return
+		}
+
+		for _, existing := range bot.conf.Spam.Rules {
+			rule.ID = max(rule.ID, existing.ID)
+		}
+		rule.ID++
+
+		bot.conf.Spam.Rules = append(bot.conf.Spam.Rules, rule)
+		if err := bot.conf.Update(); err != nil {
+			bot.sendError(message, "Ошибка сохранения правила: "+err.Error())
+			return
+		}
+		bot.sendSuccess(message, fmt.Sprintf("Добавлено %s: %s, %s",
+			escapeMarkdown(describeSpamRule(rule)), spamActions[rule.Action], spamScopeName(rule.Scope)))
+
+	case "rm":
+		id, err := strconv.Atoi(rest)
+		if err != nil {
+			bot.sendError(message, "Укажите номер правила: `/spamrule rm 3`")
+			return
+		}
+
+		for i, rule := range bot.conf.Spam.Rules {
+			if rule.ID != id {
+				continue
+			}
+
+			bot.conf.Spam.Rules = append(bot.conf.Spam.Rules[:i], bot.conf.Spam.Rules[i+1:]...)
+			if err := bot.conf.Update(); err != nil {
+				bot.sendError(message, "Ошибка сохранения правил: "+err.Error())
+				return
+			}
+			bot.sendSuccess(message, "Удалено "+escapeMarkdown(describeSpamRule(rule)))
+			return
+		}
+		bot.sendError(message, fmt.Sprintf("Правило #%d не найдено", id))
+
+	case "list":
+		bot.ListSpamRules(message)
+
+	case "test":
+		if rest == "" {
+			bot.sendError(message, "Укажите текст: `/spamrule test пиши в лс`")
+			return
+		}
+		bot.TestSpamRules(message, rest)
+
+	default:
+		bot.answerBack(message, spamRuleUsage, true)
+	}
+}
+
+func (bot *Bot) ListSpamRules(message *telego.Message) {
+	if len(bot.conf.Spam.Rules) == 0 {
+		bot.answerBack(message, "Спам-правил нет. Ключевые слова (`/listspamkeywords`) проверяются во всех группах", true)
+		return
+	}
+
+	rules := append([]SpamRule(nil), bot.conf.Spam.Rules...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	response := "*Спам-правила*:\n\n"
+	for _, rule := range rules {
+		response += fmt.Sprintf("#%d %s `%s` → %s, %s\n",
+			rule.ID, spamRuleTypes[rule.Type], strings.ReplaceAll(rule.Pattern, "`", "'"),
+			spamActions[rule.Action], spamScopeName(rule.Scope))
+	}
+	response += fmt.Sprintf("\nКлючевых слов (`/listspamkeywords`): %d", len(bot.conf.Spam.Keywords))
+
+	bot.answerBack(message, response, true)
+}
+
+// Показывает, какие правила сработали бы на текст, без учета областей
+func (bot *Bot) TestSpamRules(message *telego.Message, text string) {
+	response := fmt.Sprintf("Нормализованный текст: `%s`\n\n", normalizeSpamText(text))
+
+	matches := 0
+	bayes := bot.bayesActive()
+	if bayes {
+		if score, err := bot.combinedSpamScore(text); err == nil {
+			response += fmt.Sprintf("Оценка классификатора: %.0f%% (порог %.0f%%)\n\n", score*100, bot.bayesThreshold()*100)
+		}
+		if rule := bot.bayesRule(text); rule != nil {
+			matches++
+			response += fmt.Sprintf("• %s → %s\n", escapeMarkdown(describeSpamRule(*rule)), spamActions[rule.Action])
+		}
+	}
+
+	for _, rule := range bot.spamRulesFor(nil, !bayes) {
+		if !spamRuleMatches(rule, text) {
+			continue
+		}
+		matches++
+		response += fmt.Sprintf("• %s → %s, %s\n",
+			escapeMarkdown(describeSpamRule(rule)), spamActions[rule.Action], spamScopeName(rule.Scope))
+	}
+
+	// Новизна автора проверяется только для реальных комментариев
+	for _, rule := range bot.contactRules("", db.Comment{Text: text}, false) {
+		matches++
+		response += fmt.Sprintf("• %s → %s\n", escapeMarkdown(describeSpamRule(rule)), spamActions[rule.Action])
+	}
+	if contacts := extractContacts(text); !contacts.empty() {
+		response += "\n" + escapeMarkdown(describeContacts(contacts)) + "\n"
+	}
+
+	if matches == 0 {
+		response += "Ни одно правило не сработало"
+	}
+	if bot.isSpamException(text) {
+		response += "\n\nТекст признан не спамом, правила к нему не применяются"
+	}
+	if !bot.conf.Spam.FilterSpam {
+		response += "\n\n⚠️ Фильтрация спама выключена (`/togglefilterspam`)"
+	}
+
+	bot.answerBack(message, response, true)
+}
@@ -0,0 +1,269 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+)
+
+// Поля, доступные в шаблонах оповещений. Все значения уже экранированы
+// для Markdown, кроме PostURL и Watch: Watch - готовая разметка со
+// ссылками-упоминаниями tg://user
+type NotificationData struct {
+	Group   string // Название группы
+	Network string // Соцсеть: vk, ok, tg
+	Author  string // Автор комментария
+	Text    string // Текст комментария
+	PostURL string // Ссылка на пост
+	Time    string // Время публикации: "сегодня в 15:04" или "02.01.2006 в 15:04"
+	Ago     string // Сколько прошло с публикации: "5 мин назад"
+	Status  string // Статус оповещения: сразу или с задержкой
+	Parent  string // Текст комментария, на который отвечают (пусто, если не ответ)
+	Post    string // Начало текста поста (пусто, если пост неизвестен)
+	PostAgo string // Давность поста: "3 дн назад" (пусто, если неизвестна)
+	Spam    string // Сработавшее спам-правило с действием tag (пусто, если не спам)
+	Links   string // Домены ссылок из текста через запятую (пусто, если ссылок нет)
+	Watch   string // Сработавшее правило отслеживания с упоминаниями, разметка (пусто, если нет)
+	Mood    string // Эмодзи тональности: 🤬, 😠 или 🙂 (пусто, если нейтральный)
+}
+
+// Описание полей для справки
+const notificationFieldsHelp = "`{{.Group}}` - группа, `{{.Network}}` - соцсеть, `{{.Author}}` - автор, " +
+	"`{{.Text}}` - текст, `{{.PostURL}}` - ссылка на пост, `{{.Time}}` - время, `{{.Ago}}` - давность, " +
+	"`{{.Status}}` - статус, `{{.Parent}}` - родительский комментарий, `{{.Post}}` - начало поста, " +
+	"`{{.PostAgo}}` - давность поста, `{{.Spam}}` - сработавшее спам-правило, `{{.Links}}` - домены ссылок, `{{.Watch}}` - правило отслеживания, " +
+	"`{{.Mood}}` - эмодзи тональности"
+
+const (
+	TEMPLATE_FULL         = "full"
+	TEMPLATE_MINIMALISTIC = "minimalistic"
+	TEMPLATE_SPACED       = "spaced"
+)
+
+// Встроенные шаблоны. Имена соответствуют NOTIFICATION_* в порядке объявления
+var builtinTemplates = map[string]string{
+	TEMPLATE_FULL: "💬 *Новый комментарий в \"{{.Group}}\" ({{.Network}})*:\n\n" +
+		"{{if .Watch}}🔔 *Отслеживается*: {{.Watch}}\n\n{{end}}" +
+		"{{if .Spam}}⚠️ *Похоже на спам*: {{.Spam}}\n\n{{end}}" +
+		"{{if .Post}}📰 *К посту*: «{{.Post}}»{{if .PostAgo}} ({{.PostAgo}}){{end}}\n\n{{end}}" +
+		"{{if .Parent}}↩️ *В ответ на*: {{.Parent}}\n\n{{end}}" +
+		"📝 *Текст*: {{if .Mood}}{{.Mood}} {{end}}{{.Text}}\n\n" +
+		"{{if .Links}}🌐 *Ссылки ведут на*: {{.Links}}\n\n{{end}}" +
+		"👤 *Автор*: {{.Author}}\n" +
+		"🔗 *Ссылка*: [Перейти к посту]({{.PostURL}})\n" +
+		"⏰ *Время публикации комментария*: {{.Time}}\n" +
+		"📌 *Статус оповещения*: {{.Status}}",
+
+	TEMPLATE_MINIMALISTIC: "🌐 ({{.Network}}) *{{.Group}}*\n" +
+		"{{if .Watch}}🔔 {{.Watch}}\n{{end}}" +
+		"{{if .Spam}}⚠️ {{.Spam}}\n{{end}}" +
+		"{{if .Post}}📰 «{{.Post}}»{{if .PostAgo}} ({{.PostAgo}}){{end}}\n{{end}}" +
+		"💬 {{if .Mood}}{{.Mood}} {{end}}{{.Text}}\n" +
+		"{{if .Links}}🌐 {{.Links}}\n{{end}}" +
+		"⏰ {{.Time}} | (статус: {{.Status}})\n" +
+		"👤 *{{.Author}}*\n" +
+		"🔗 [Перейти к посту]({{.PostURL}}) • {{.Ago}}",
+
+	TEMPLATE_SPACED: "*💬 НОВЫЙ КОММЕНТАРИЙ*\n" +
+		"*Группа:* _{{.Group}}_ ({{.Network}})\n" +
+		"{{divider}}\n" +
+		"{{if .Watch}}*🔔 Отслеживается:* {{.Watch}}\n{{divider}}\n{{end}}" +
+		"{{if .Spam}}*⚠️ Похоже на спам:* {{.Spam}}\n{{divider}}\n{{end}}" +
+		"{{if .Post}}*📰 К посту:*\n«{{.Post}}»{{if .PostAgo}} ({{.PostAgo}}){{end}}\n{{divider}}\n{{end}}" +
+		"{{if .Parent}}*↩️ В ответ на:*\n{{.Parent}}\n{{divider}}\n{{end}}" +
+		"*📝 Текст комментария:*{{if .Mood}} {{.Mood}}{{end}}\n{{.Text}}\n" +
+		"{{divider}}\n" +
+		"{{if .Links}}*🌐 Ссылки ведут на:* {{.Links}}\n{{divider}}\n{{end}}" +
+		"*👤 Автор:* {{.Author}}\n" +
+		"*⏰ Время:* {{.Time}}\n" +
+		"*📌 Статус:* {{.Status}}\n" +
+		"*🔗 Ссылка:* [Перейти к посту]({{.PostURL}})",
+}
+
+var builtinTemplateDescriptions = map[string]string{
+	TEMPLATE_FULL:         "Полный - подробное уведомление со всеми деталями",
+	TEMPLATE_MINIMALISTIC: "Минималистичный - компактное уведомление",
+	TEMPLATE_SPACED:       "Просторный - уведомление с визуальными разделителями",
+}
+
+var templateFuncs = template.FuncMap{
+	// Визуальный разделитель
+	"divider": func() string {
+		return strings.Repeat("•", 35)
+	},
+	// Обрезает строку до n символов
+	"truncate": func(n int, s string) string {
+		if utf8.RuneCountInString(s) <= n {
+			return s
+		}
+		return string([]rune(s)[:n]) + "…"
+	},
+}
+
+func isBuiltinTemplate(name string) bool {
+	_, ok := builtinTemplates[name]
+	return ok
+}
+
+// Имя текущего шаблона оповещений
+func (bot *Bot) activeTemplateName() string {
+	if bot.conf.NotificationTemplate != "" {
+		return bot.conf.NotificationTemplate
+	}
+
+	switch bot.conf.NotificationMessageType {
+	case NOTIFICATION_MINIMALISTIC:
+		return TEMPLATE_MINIMALISTIC
+	case NOTIFICATION_SPACED:
+		return TEMPLATE_SPACED
+	default:
+		return TEMPLATE_FULL
+	}
+}
+
+// Исходный текст шаблона по имени: встроенного или пользовательского
+func (bot *Bot) templateSource(name string) (string, bool) {
+	if source, ok := builtinTemplates[name]; ok {
+		return source, true
+	}
+
+	bot.conf.mu.RLock()
+	defer bot.conf.mu.RUnlock()
+
+	source, ok := bot.conf.NotificationTemplates[name]
+	return source, ok
+}
+
+func renderTemplate(source string, data NotificationData) (string, error) {
+	tmpl, err := template.New("notification").Funcs(templateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// Формирует данные для шаблона из комментария. Текст длиннее maxLength
+// символов обрезается (0 - не обрезать)
+func newNotificationData(group db.MonitoredGroup, comment db.Comment, maxLength int) NotificationData {
+	if maxLength > 0 && utf8.RuneCountInString(comment.Text) > maxLength {
+		comment.Text = string([]rune(comment.Text)[:maxLength]) + "\n\n⚠️ Сообщение было обрезано."
+	}
+
+	status := "Только что"
+	if comment.IsPending {
+		status = "Отправлено с задержкой: (комментарий получен в нерабочее время)"
+	}
+
+	// Форматируем время в человекочитаемый вид
+	commentTime := time.Unix(comment.Timestamp, 0)
+	var timeStr string
+	if commentTime.Day() == time.Now().Day() && commentTime.Month() == time.Now().Month() && commentTime.Year() == time.Now().Year() {
+		timeStr = commentTime.Format("сегодня в 15:04")
+	} else {
+		timeStr = commentTime.Format("02.01.2006 в 15:04")
+	}
+
+	text := escapeMarkdown(processCommentText(comment))
+	if len(comment.Attachments) > 0 {
+		text = strings.TrimSpace(text + "\n" + attachmentLines(comment))
+	}
+
+	parent := comment.ParentText
+	if len([]rune(parent)) > 200 {
+		parent = string([]rune(parent)[:200]) + "…"
+	}
+
+	post := postExcerpt(comment.PostText)
+	var postAgo string
+	if comment.PostDate != 0 {
+		postAgo = formatTimeAgo(comment.PostDate)
+		if post == "" {
+			post = "((пост без текста))"
+		}
+	}
+
+	return NotificationData{
+		Group:   escapeMarkdown(group.GroupName),
+		Network: group.Network,
+		Author:  escapeMarkdown(comment.Author),
+		Text:    text,
+		PostURL: comment.PostURL,
+		Time:    timeStr,
+		Ago:     formatTimeAgo(comment.Timestamp),
+		Status:  status,
+		Parent:  escapeMarkdown(parent),
+		Post:    escapeMarkdown(post),
+		Spam:    escapeMarkdown(comment.SpamRule),
+		PostAgo: postAgo,
+		Watch:   comment.WatchRule,
+		Mood:    moodEmoji[commentMood(comment)],
+		Links:   escapeMarkdown(strings.Join(linkDomains(extractContacts(comment.Text).Links), ", ")),
+	}
+}
+
+// Пример комментария для предпросмотра и проверки шаблонов. Содержит
+// символы разметки, чтобы выявить неэкранированные поля
+func sampleNotificationData() NotificationData {
+	group := db.MonitoredGroup{
+		Network:   "vk",
+		GroupName: "Пример_группы *official*",
+	}
+	comment := db.Comment{
+		Author:     "Иван [Иванов]",
+		Text:       "Когда будет доставка? Заказ_123 *срочно* `важно` Трек на https://track_shop.example.ru/order",
+		Timestamp:  time.Now().Add(-5 * time.Minute).Unix(),
+		PostURL:    "https://vk.ru/wall-1_1",
+		ParentText: "Доставка возобновится в понедельник",
+		PostText:   "Открываем_предзаказ на *новую* коллекцию! Доставка по всей стране",
+		PostDate:   time.Now().Add(-3 * 24 * time.Hour).Unix(),
+		Sentiment:  -2,
+	}
+
+	return newNotificationData(group, comment, 0)
+}
+
+// Проверяет шаблон: разбор, выполнение на примере и корректность Markdown результата
+func validateTemplate(source string) (string, error) {
+	rendered, err := renderTemplate(source, sampleNotificationData())
+	if err != nil {
+		return "", fmt.Errorf("ошибка шаблона: %w", err)
+	}
+
+	if strings.TrimSpace(rendered) == "" {
+		return "", fmt.Errorf("шаблон дает пустое сообщение")
+	}
+
+	if err := validateMarkdown(rendered); err != nil {
+		return "", fmt.Errorf("некорректная разметка: %w", err)
+	}
+
+	return rendered, nil
+}
@@ -0,0 +1,91 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"log"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Сколько помнить первое оповещение по посту
+const POST_THREAD_TTL = 7 * 24 * time.Hour
+
+// Ключ поста комментария в пределах группы. Ссылка не годится: у
+// комментариев Телеграма она ведет на сам комментарий. У комментариев,
+// сохраненных до появления post_id, остается только ссылка
+func postKey(comment db.Comment) string {
+	if comment.PostID != "" {
+		return comment.PostID
+	}
+	return comment.PostURL
+}
+
+// Ветка оповещений о посте в чате. nil, если веток нет или они выключены
+func (bot *Bot) postThread(group db.MonitoredGroup, comment db.Comment, target notificationTarget) *db.PostThread {
+	if !bot.conf.ThreadByPost || postKey(comment) == "" {
+		return nil
+	}
+
+	thread, err := bot.db.GetPostThread(group.ID, postKey(comment), target.ChatID, int64(target.ThreadID))
+	if err != nil {
+		log.Printf("Ошибка получения ветки поста %s: %s", postKey(comment), err)
+		return nil
+	}
+
+	if thread == nil || time.Since(time.Unix(thread.CreatedAt, 0)) > POST_THREAD_TTL {
+		return nil
+	}
+
+	return thread
+}
+
+// Запоминает оповещение как начало ветки поста
+func (bot *Bot) startPostThread(group db.MonitoredGroup, comment db.Comment, target notificationTarget, msg *telego.Message) {
+	if !bot.conf.ThreadByPost || postKey(comment) == "" || msg == nil {
+		return
+	}
+
+	err := bot.db.SavePostThread(&db.PostThread{
+		GroupID:   group.ID,
+		PostKey:   postKey(comment),
+		ChatID:    target.ChatID,
+		ThreadID:  int64(target.ThreadID),
+		MessageID: msg.MessageID,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения ветки поста %s: %s", postKey(comment), err)
+	}
+}
+
+func (bot *Bot) ToggleThreadByPost(message *telego.Message) {
+	if bot.conf.ThreadByPost {
+		bot.conf.ThreadByPost = false
+		bot.answerBack(message, "Оповещения о комментариях к одному посту больше не объединяются в ветки.", true)
+	} else {
+		bot.conf.ThreadByPost = true
+		bot.answerBack(message, "Оповещения о комментариях к одному посту будут приходить ответами на первое оповещение.", true)
+	}
+
+	bot.conf.Update()
+}
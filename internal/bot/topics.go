@@ -0,0 +1,226 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Иконки соцсетей в названиях топиков
+var networkIcons = map[string]string{
+	"vk": "🔵",
+	"ok": "🟠",
+	"tg": "✈️",
+}
+
+// Максимальная длина названия топика в Telegram
+const TOPIC_NAME_LIMIT = 128
+
+// Сколько не пытаться создавать топики в чате после ошибки создания
+const TOPIC_RETRY_INTERVAL = 10 * time.Minute
+
+func topicName(group db.MonitoredGroup) string {
+	name := group.GroupName
+	if icon, ok := networkIcons[group.Network]; ok {
+		name = icon + " " + name
+	}
+
+	runes := []rune(name)
+	if len(runes) > TOPIC_NAME_LIMIT {
+		name = string(runes[:TOPIC_NAME_LIMIT-1]) + "…"
+	}
+
+	return name
+}
+
+// Создан ли у группы топик в текущем мониторинговом чате
+func (bot *Bot) hasGroupTopic(group db.MonitoredGroup) bool {
+	return bot.conf.Telegram.AutoTopics &&
+		group.TopicThreadID != 0 &&
+		group.TopicChatID == bot.conf.Telegram.MonitoringChannelID
+}
+
+// Создает топик группы в мониторинговом чате, если включены авто-топики,
+// у группы нет своего маршрута, а топик еще не создан. group обновляется
+func (bot *Bot) ensureGroupTopic(ctx context.Context, group *db.MonitoredGroup) error {
+	if !bot.conf.Telegram.AutoTopics || bot.hasRoute(*group) || bot.hasGroupTopic(*group) {
+		return nil
+	}
+
+	bot.topicsMu.Lock()
+	defer bot.topicsMu.Unlock()
+
+	// Топик мог быть создан параллельно, пока ждали блокировку
+	current, err := bot.db.GetGroupByInternalID(fmt.Sprintf("%d", group.ID))
+	if err != nil {
+		return err
+	}
+	if current != nil && bot.hasGroupTopic(*current) {
+		group.TopicChatID = current.TopicChatID
+		group.TopicThreadID = current.TopicThreadID
+		return nil
+	}
+
+	// Чат не форум или у бота нет прав: не повторяем запрос к API
+	// для каждого оповещения, пока не пройдет TOPIC_RETRY_INTERVAL
+	chatID := bot.conf.Telegram.MonitoringChannelID
+	if failedAt, ok := bot.topicFailures[chatID]; ok && time.Since(failedAt) < TOPIC_RETRY_INTERVAL {
+		return fmt.Errorf("создание топиков приостановлено до %s после ошибки", failedAt.Add(TOPIC_RETRY_INTERVAL).Format("15:04"))
+	}
+
+	topic, err := bot.api.CreateForumTopic(ctx, &telego.CreateForumTopicParams{
+		ChatID: telego.ChatID{ID: chatID},
+		Name:   topicName(*group),
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			if bot.topicFailures == nil {
+				bot.topicFailures = make(map[int64]time.Time)
+			}
+			bot.topicFailures[chatID] = time.Now()
+			log.Printf("Не удалось создать топик в чате %d: %s. Следующая попытка не раньше чем через %s", chatID, err, TOPIC_RETRY_INTERVAL)
+		}
+		return fmt.Errorf("не удалось создать топик: %w", err)
+	}
+	delete(bot.topicFailures, chatID)
+
+	if err := bot.db.SetGroupTopic(group.ID, chatID, int64(topic.MessageThreadID)); err != nil {
+		return err
+	}
+
+	group.TopicChatID = chatID
+	group.TopicThreadID = int64(topic.MessageThreadID)
+
+	log.Printf("Создан топик \"%s\" (%d) для группы %s", topic.Name, topic.MessageThreadID, group.GroupName)
+	return nil
+}
+
+// Сообщил ли Telegram, что топика больше нет (его удалили в чате)
+func isThreadNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "message thread not found")
+}
+
+// Забывает топик группы, если отправка в него не удалась из-за того,
+// что топик удален. Следующий ensureGroupTopic создаст новый. Возвращает
+// true, если топик забыт и отправку стоит повторить
+func (bot *Bot) forgetDeletedTopic(group *db.MonitoredGroup, target notificationTarget, err error) bool {
+	if !isThreadNotFound(err) || !bot.hasGroupTopic(*group) ||
+		target.ChatID != group.TopicChatID || int64(target.ThreadID) != group.TopicThreadID {
+		return false
+	}
+
+	bot.topicsMu.Lock()
+	defer bot.topicsMu.Unlock()
+
+	// Топик мог быть уже пересоздан параллельно: стираем только удаленный
+	current, dbErr := bot.db.GetGroupByInternalID(fmt.Sprintf("%d", group.ID))
+	if dbErr != nil {
+		log.Printf("Ошибка получения группы %s: %s", group.GroupName, dbErr)
+		return false
+	}
+	if current != nil && current.TopicChatID == group.TopicChatID && current.TopicThreadID == group.TopicThreadID {
+		if dbErr := bot.db.SetGroupTopic(group.ID, 0, 0); dbErr != nil {
+			log.Printf("Ошибка сброса топика группы %s: %s", group.GroupName, dbErr)
+			return false
+		}
+		log.Printf("Топик %d группы %s удален в чате, будет создан заново", group.TopicThreadID, group.GroupName)
+	}
+
+	group.TopicChatID = 0
+	group.TopicThreadID = 0
+	return true
+}
+
+// Переименовывает топик группы вслед за группой
+func (bot *Bot) renameGroupTopic(group db.MonitoredGroup) error {
+	if group.TopicThreadID == 0 {
+		return nil
+	}
+
+	return bot.api.EditForumTopic(bot.ctx, &telego.EditForumTopicParams{
+		ChatID:          telego.ChatID{ID: group.TopicChatID},
+		MessageThreadID: int(group.TopicThreadID),
+		Name:            topicName(group),
+	})
+}
+
+// Закрывает топик удаленной группы. История оповещений остается в чате
+func (bot *Bot) closeGroupTopic(group db.MonitoredGroup) error {
+	if group.TopicThreadID == 0 {
+		return nil
+	}
+
+	return bot.api.CloseForumTopic(bot.ctx, &telego.CloseForumTopicParams{
+		ChatID:          telego.ChatID{ID: group.TopicChatID},
+		MessageThreadID: int(group.TopicThreadID),
+	})
+}
+
+func (bot *Bot) ToggleAutoTopics(message *telego.Message) {
+	if bot.conf.Telegram.AutoTopics {
+		bot.conf.Telegram.AutoTopics = false
+		bot.answerBack(message, "Топики для групп больше не используются, оповещения идут в общий раздел.", true)
+	} else {
+		bot.conf.Telegram.AutoTopics = true
+		bot.answerBack(message, "Для каждой группы будет создан свой топик в мониторинговом чате. Чат должен быть форумом, а у бота - право управлять топиками.", true)
+	}
+
+	bot.conf.Update()
+}
+
+func (bot *Bot) RenameGroup(message *telego.Message) {
+	parts := strings.Fields(message.Text)
+	if len(parts) < 4 {
+		bot.sendError(message, "Неверный формат. Используйте: /renamegroup <сеть> <ID группы> <новое название>")
+		return
+	}
+
+	network := strings.ToLower(parts[1])
+	groupID := parts[2]
+	name := strings.Join(parts[3:], " ")
+
+	group, err := bot.db.GetGroupByNetworkAndID(network, groupID)
+	if err != nil || group == nil {
+		bot.sendError(message,
+			fmt.Sprintf("Группа с ID %s не найдена в %s", groupID, network))
+		return
+	}
+
+	if err := bot.db.RenameGroup(group.ID, name); err != nil {
+		bot.sendError(message, "Ошибка переименования группы: "+err.Error())
+		return
+	}
+	group.GroupName = name
+
+	if err := bot.renameGroupTopic(*group); err != nil {
+		log.Printf("Ошибка переименования топика группы %s: %s", group.GroupName, err)
+		bot.sendSuccess(message, "Группа переименована, но топик переименовать не удалось: "+err.Error())
+		return
+	}
+
+	bot.sendSuccess(message, "Группа переименована в "+escapeMarkdown(name))
+}
@@ -0,0 +1,396 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"Unbewohnte/SNGCNOTIFIERbot/internal/db"
+
+	"github.com/mymmrac/telego"
+)
+
+// Подписи приоритетов правил отслеживания
+var watchPriorities = map[string]string{
+	WATCH_NORMAL:   "обычный",
+	WATCH_HIGH:     "высокий",
+	WATCH_CRITICAL: "критичный",
+}
+
+var watchPriorityLevel = map[string]int{
+	WATCH_NORMAL:   1,
+	WATCH_HIGH:     2,
+	WATCH_CRITICAL: 3,
+}
+
+// Разделитель частей шаблона, которые должны встретиться все: "бренд + конкурент"
+const WATCH_PATTERN_SEPARATOR = " + "
+
+var mentionRegexp = regexp.MustCompile(`^@[A-Za-z][A-Za-z0-9_]{3,31}$`)
+
+// Упоминание - @username или числовой ID пользователя: ID подставляется
+// в ссылку tg://user, и любой другой текст сломал бы ее разметку
+func isValidMention(mention string) bool {
+	if strings.HasPrefix(mention, "@") {
+		return mentionRegexp.MatchString(mention)
+	}
+	id, err := strconv.ParseInt(mention, 10, 64)
+	return err == nil && id > 0 && strconv.FormatInt(id, 10) == mention
+}
+
+func watchRuleMatches(rule WatchRule, text string) bool {
+	parts := []string{rule.Pattern}
+	if rule.Type != SPAM_RULE_REGEX {
+		parts = strings.Split(rule.Pattern, WATCH_PATTERN_SEPARATOR)
+	}
+
+	for _, part := range parts {
+		if !spamRuleMatches(SpamRule{Type: rule.Type, Pattern: strings.TrimSpace(part)}, text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Правило отслеживания с наивысшим приоритетом, сработавшее на комментарий, или nil
+func (bot *Bot) checkWatch(group db.MonitoredGroup, comment db.Comment) *WatchRule {
+	var matched *WatchRule
+	for _, rule := range bot.conf.Watch.Rules {
+		if !spamRuleApplies(SpamRule{Scope: rule.Scope}, group) || !watchRuleMatches(rule, comment.Text) {
+			continue
+		}
+		if matched == nil || watchPriorityLevel[rule.Priority] > watchPriorityLevel[matched.Priority] {
+			matched = &rule
+		}
+	}
+
+	return matched
+}
+
+// Срочный комментарий: оповещение о нем не откладывается расписанием и дайджестом
+func (bot *Bot) isUrgentComment(group db.MonitoredGroup, comment db.Comment) bool {
+	rule := bot.checkWatch(group, comment)
+	return rule != nil && watchPriorityLevel[rule.Priority] >= watchPriorityLevel[WATCH_HIGH]
+}
+
+// Делит комментарии на срочные и остальные
+func (bot *Bot) splitUrgentComments(group db.MonitoredGroup, comments []db.Comment) (urgent, rest []db.Comment) {
+	for _, comment := range comments {
+		if bot.isUrgentComment(group, comment) {
+			urgent = append(urgent, comment)
+		} else {
+			rest = append(rest, comment)
+		}
+	}
+	return urgent, rest
+}
+
+// Упоминания в разметке: @username как есть, ID - ссылкой на пользователя
+func formatMentions(mentions []string) string {
+	var out []string
+	for _, mention := range mentions {
+		// Упоминания из конфига, исправленного вручную, не проверялись командой
+		if strings.HasPrefix(mention, "@") || !isValidMention(mention) {
+			out = append(out, escapeMarkdown(mention))
+		} else {
+			out = append(out, fmt.Sprintf("[дежурный %s](tg://user?id=%s)", mention, mention))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Описание правила для оповещения, в разметке, с упоминаниями
+func describeWatchRule(rule WatchRule) string {
+	description := fmt.Sprintf("«%s» (%s)", escapeMarkdown(rule.Pattern), watchPriorities[rule.Priority])
+	if len(rule.Mentions) > 0 {
+		description += " " + formatMentions(rule.Mentions)
+	}
+	return description
+}
+
+// Отправляет отдельное оповещение о критичном комментарии и закрепляет его
+// до обработки комментария (см. unpinWatchAlert). В чате группы оповещение
+// отправляется ответом на обычное оповещение
+func (bot *Bot) sendWatchAlert(ctx context.Context, group db.MonitoredGroup, comment db.Comment, key int64, notification *telego.Message) {
+	params := &telego.SendMessageParams{
+		ChatID:          notification.Chat.ChatID(),
+		MessageThreadID: notification.MessageThreadID,
+		ReplyParameters: &telego.ReplyParameters{
+			MessageID:                notification.MessageID,
+			AllowSendingWithoutReply: true,
+		},
+	}
+	if bot.conf.Watch.AlertChatID != 0 {
+		params.ChatID = telego.ChatID{ID: bot.conf.Watch.AlertChatID}
+		params.MessageThreadID = int(bot.conf.Watch.AlertThreadID)
+		params.ReplyParameters = nil
+	}
+
+	text := fmt.Sprintf("🚨 *Критичный комментарий* в %s *%s*\n🔔 %s\n\n👤 *%s*: %s",
+		networkIcons[group.Network], escapeMarkdown(group.GroupName), comment.WatchRule,
+		escapeMarkdown(comment.Author), bot.digestExcerpt(comment))
+	if strings.HasPrefix(comment.PostURL, "http") {
+		text += fmt.Sprintf("\n\n[Перейти к посту](%s)", comment.PostURL)
+	}
+	text += "\n\n📌 Закреплено, пока комментарий не обработан кнопкой под оповещением"
+
+	alert, err := bot.sendMarkup(ctx, params, text)
+	if err != nil {
+		log.Printf("Ошибка отправки критичного оповещения о комментарии %s: %s", comment.ID, err)
+		return
+	}
+
+	err = bot.api.PinChatMessage(ctx, &telego.PinChatMessageParams{
+		ChatID:    alert.Chat.ChatID(),
+		MessageID: alert.MessageID,
+	})
+	if err != nil {
+		log.Printf("Не удалось закрепить критичное оповещение (боту нужны права закрепления): %s", err)
+		return
+	}
+
+	if err := bot.db.SetCommentAlert(key, alert.Chat.ID, alert.MessageID); err != nil {
+		log.Printf("Ошибка сохранения критичного оповещения о комментарии %s: %s", comment.ID, err)
+	}
+}
+
+// Открепляет критичное оповещение о комментарии, если оно есть
+func (bot *Bot) unpinWatchAlert(key int64) {
+	chatID, messageID, err := bot.db.GetCommentAlert(key)
+	if err != nil || chatID == 0 {
+		return
+	}
+
+	err = bot.api.UnpinChatMessage(bot.ctx, &telego.UnpinChatMessageParams{
+		ChatID:    telego.ChatID{ID: chatID},
+		MessageID: messageID,
+	})
+	if err != nil {
+		log.Printf("Ошибка открепления критичного оповещения: %s", err)
+	}
+
+	if err := bot.db.SetCommentAlert(key, 0, 0); err != nil {
+		log.Printf("Ошибка сброса критичного оповещения: %s", err)
+	}
+}
+
+// Разбирает "<тип> <приоритет> <область> <шаблон>"
+func parseWatchRule(text string) (WatchRule, error) {
+	args, pattern := cutFields(text, 3)
+	if len(args) < 3 || pattern == "" {
+		return WatchRule{}, fmt.Errorf("укажите тип, приоритет, область и шаблон")
+	}
+
+	// Тип, область и проверка шаблона - как у спам-правил
+	spamRule, err := parseSpamRule(fmt.Sprintf("%s %s %s %s", args[0], SPAM_ACTION_TAG, args[2], pattern))
+	if err != nil {
+		return WatchRule{}, err
+	}
+
+	rule := WatchRule{
+		Type:     spamRule.Type,
+		Pattern:  spamRule.Pattern,
+		Scope:    spamRule.Scope,
+		Priority: strings.ToLower(args[1]),
+	}
+	if _, ok := watchPriorities[rule.Priority]; !ok {
+		return rule, fmt.Errorf("неизвестный приоритет %s", rule.Priority)
+	}
+
+	return rule, nil
+}
+
+const watchUsage = "Используйте:\n" +
+	"`/watch add <тип> <приоритет> <область> <шаблон>` - добавить правило\n" +
+	"`/watch rm <id>` - удалить правило\n" +
+	"`/watch mention <id> [@username или ID ...]` - кого упоминать (без аргументов - никого)\n" +
+	"`/watch alerts <ID чата> [ID топика]` или `/watch alerts off` - чат для критичных оповещений\n" +
+	"`/watch list` - список правил\n\n" +
+	"Типы: `substring`, `word`, `regex`, `normalized`. Части шаблона через ` + ` должны встретиться все\n" +
+	"Приоритеты: `normal` - пометка в оповещении, `high` - и в нерабочее время, `critical` - и отдельное закрепленное оповещение\n" +
+	"Область: `all`, соцсеть (`vk`) или группа (`vk:123`)"
+
+func (bot *Bot) WatchCommand(message *telego.Message) {
+	args, rest := cutFields(message.Text, 2)
+	if len(args) < 2 {
+		bot.answerBack(message, watchUsage, true)
+		return
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "add":
+		rule, err := parseWatchRule(rest)
+		if err != nil {
+			bot.sendError(message, escapeMarkdown(err.Error())+"\n\n"+watchUsage)
+			return
+		}
+
+		for _, existing := range bot.conf.Watch.Rules {
+			rule.ID = max(rule.ID, existing.ID)
+		}
+		rule.ID++
+
+		bot.conf.Watch.Rules = append(bot.conf.Watch.Rules, rule)
+		if err := bot.conf.Update(); err != nil {
+			bot.sendError(message, "Ошибка сохранения правила: "+err.Error())
+			return
+		}
+		bot.sendSuccess(message, fmt.Sprintf("Добавлено правило #%d %s, %s. Упоминания: `/watch mention %d @username`",
+			rule.ID, describeWatchRule(rule), spamScopeName(rule.Scope), rule.ID))
+
+	case "rm":
+		id, err := strconv.Atoi(rest)
+		if err != nil {
+			bot.sendError(message, "Укажите номер правила: `/watch rm 3`")
+			return
+		}
+
+		for i, rule := range bot.conf.Watch.Rules {
+			if rule.ID != id {
+				continue
+			}
+
+			bot.conf.Watch.Rules = append(bot.conf.Watch.Rules[:i], bot.conf.Watch.Rules[i+1:]...)
+			if err := bot.conf.Update(); err != nil {
+				bot.sendError(message, "Ошибка сохранения правил: "+err.Error())
+				return
+			}
+			bot.sendSuccess(message, fmt.Sprintf("Удалено правило #%d %s", rule.ID, describeWatchRule(rule)))
+			return
+		}
+		bot.sendError(message, fmt.Sprintf("Правило #%d не найдено", id))
+
+	case "mention":
+		bot.setWatchMentions(message, rest)
+
+	case "alerts":
+		bot.setWatchAlertChat(message, rest)
+
+	case "list":
+		bot.ListWatchRules(message)
+
+	default:
+		bot.answerBack(message, watchUsage, true)
+	}
+}
+
+func (bot *Bot) setWatchMentions(message *telego.Message, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		bot.sendError(message, "Укажите номер правила: `/watch mention 3 @duty_manager`")
+		return
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		bot.sendError(message, "Укажите номер правила: `/watch mention 3 @duty_manager`")
+		return
+	}
+
+	mentions := fields[1:]
+	for _, mention := range mentions {
+		if !isValidMention(mention) {
+			bot.sendError(message, "Некорректное упоминание "+escapeMarkdown(mention)+": укажите @username или числовой ID пользователя")
+			return
+		}
+	}
+
+	for i := range bot.conf.Watch.Rules {
+		rule := &bot.conf.Watch.Rules[i]
+		if rule.ID != id {
+			continue
+		}
+
+		rule.Mentions = mentions
+		if err := bot.conf.Update(); err != nil {
+			bot.sendError(message, "Ошибка сохранения правил: "+err.Error())
+			return
+		}
+		if len(mentions) == 0 {
+			bot.sendSuccess(message, fmt.Sprintf("Правило #%d больше никого не упоминает", id))
+		} else {
+			bot.sendSuccess(message, fmt.Sprintf("Правило #%d упоминает: %s", id, formatMentions(mentions)))
+		}
+		return
+	}
+	bot.sendError(message, fmt.Sprintf("Правило #%d не найдено", id))
+}
+
+func (bot *Bot) setWatchAlertChat(message *telego.Message, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		bot.sendError(message, "Используйте: `/watch alerts <ID чата> [ID топика]` или `/watch alerts off`")
+		return
+	}
+
+	if strings.ToLower(fields[0]) == "off" {
+		bot.conf.Watch.AlertChatID = 0
+		bot.conf.Watch.AlertThreadID = 0
+		bot.conf.Update()
+		bot.sendSuccess(message, "Критичные оповещения отправляются в чат группы ответом на оповещение")
+		return
+	}
+
+	route, err := parseRoute(fields)
+	if err != nil {
+		bot.sendError(message, escapeMarkdown(err.Error()))
+		return
+	}
+	if err := bot.testRoute(route, "критичные комментарии"); err != nil {
+		bot.sendError(message, "Не удалось отправить сообщение в этот чат: "+escapeMarkdown(err.Error()))
+		return
+	}
+
+	bot.conf.Watch.AlertChatID = route.ChatID
+	bot.conf.Watch.AlertThreadID = route.ThreadID
+	bot.conf.Update()
+	bot.sendSuccess(message, "Критичные оповещения будут отправляться и закрепляться в этом чате")
+}
+
+func (bot *Bot) ListWatchRules(message *telego.Message) {
+	if len(bot.conf.Watch.Rules) == 0 {
+		bot.answerBack(message, "Правил отслеживания нет. Добавьте: `/watch add word critical all суд`", true)
+		return
+	}
+
+	rules := append([]WatchRule(nil), bot.conf.Watch.Rules...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	response := "*Правила отслеживания*:\n\n"
+	for _, rule := range rules {
+		response += fmt.Sprintf("#%d %s `%s` → %s, %s",
+			rule.ID, spamRuleTypes[rule.Type], strings.ReplaceAll(rule.Pattern, "`", "'"),
+			watchPriorities[rule.Priority], spamScopeName(rule.Scope))
+		if len(rule.Mentions) > 0 {
+			response += ", " + escapeMarkdown(strings.Join(rule.Mentions, " "))
+		}
+		response += "\n"
+	}
+
+	if bot.conf.Watch.AlertChatID != 0 {
+		response += fmt.Sprintf("\nКритичные оповещения: чат `%d` (топик `%d`)", bot.conf.Watch.AlertChatID, bot.conf.Watch.AlertThreadID)
+	}
+
+	bot.answerBack(message, response, true)
+}
@@ -0,0 +1,71 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+// Запись журнала действий модераторов
+type AuditEntry struct {
+	ID          int64  `db:"id"`
+	CreatedAt   int64  `db:"created_at"` // Unix timestamp
+	Moderator   string `db:"moderator"`
+	ModeratorID int64  `db:"moderator_id"` // ID пользователя Telegram
+	Action      string `db:"action"`
+	Network     string `db:"network"`
+	GroupID     string `db:"group_id"`   // ID группы в соцсети
+	CommentID   string `db:"comment_id"` // ID комментария в БД
+	Details     string `db:"details"`
+}
+
+func (db *DB) AddAuditEntry(entry *AuditEntry) error {
+	_, err := db.Exec(`
+		INSERT INTO audit_log
+		(created_at, moderator, moderator_id, action, network, group_id, comment_id, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.CreatedAt, entry.Moderator, entry.ModeratorID, entry.Action,
+		entry.Network, entry.GroupID, entry.CommentID, entry.Details,
+	)
+	return err
+}
+
+// Возвращает последние limit записей, начиная с новых
+func (db *DB) GetAuditLog(limit int) ([]AuditEntry, error) {
+	rows, err := db.Query(`
+		SELECT id, created_at, moderator, moderator_id, action, network, group_id, comment_id, details
+		FROM audit_log
+		ORDER BY id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(
+			&entry.ID, &entry.CreatedAt, &entry.Moderator, &entry.ModeratorID, &entry.Action,
+			&entry.Network, &entry.GroupID, &entry.CommentID, &entry.Details,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
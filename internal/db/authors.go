@@ -0,0 +1,180 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import "database/sql"
+
+// Автор, оповещения о комментариях которого не отправляются
+type MutedAuthor struct {
+	Network  string `db:"network"`
+	AuthorID string `db:"author_id"`
+	Author   string `db:"author"`
+	MutedBy  string `db:"muted_by"`
+	MutedAt  int64  `db:"muted_at"` // Unix timestamp
+}
+
+func (db *DB) MuteAuthor(author *MutedAuthor) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO muted_authors
+		(network, author_id, author, muted_by, muted_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		author.Network, author.AuthorID, author.Author, author.MutedBy, author.MutedAt,
+	)
+	return err
+}
+
+// Снимает заглушение. Возвращает false, если автор не был заглушен
+func (db *DB) UnmuteAuthor(network, authorID string) (bool, error) {
+	result, err := db.Exec(`
+		DELETE FROM muted_authors
+		WHERE network = ? AND author_id = ?`,
+		network, authorID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (db *DB) IsAuthorMuted(network, authorID string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM muted_authors
+		WHERE network = ? AND author_id = ?`,
+		network, authorID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+func (db *DB) GetMutedAuthors() ([]MutedAuthor, error) {
+	rows, err := db.Query(`
+		SELECT network, author_id, author, muted_by, muted_at
+		FROM muted_authors
+		ORDER BY muted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []MutedAuthor
+	for rows.Next() {
+		var author MutedAuthor
+		err := rows.Scan(&author.Network, &author.AuthorID, &author.Author, &author.MutedBy, &author.MutedAt)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+
+	return authors, nil
+}
+
+const (
+	AUTHOR_TRUSTED = "trusted" // Комментарии не проверяются спам-фильтром
+	AUTHOR_BLOCKED = "blocked" // Комментарии всегда считаются спамом
+)
+
+// Автор в списке доверенных или заблокированных. Автор может быть только в одном списке
+type ListedAuthor struct {
+	Network  string `db:"network"`
+	AuthorID string `db:"author_id"`
+	Author   string `db:"author"`
+	List     string `db:"list"` // AUTHOR_TRUSTED или AUTHOR_BLOCKED
+	AddedBy  string `db:"added_by"`
+	AddedAt  int64  `db:"added_at"` // Unix timestamp
+}
+
+// Добавляет автора в список, убирая его из другого
+func (db *DB) SetAuthorList(author *ListedAuthor) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO author_lists
+		(network, author_id, author, list, added_by, added_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		author.Network, author.AuthorID, author.Author, author.List, author.AddedBy, author.AddedAt,
+	)
+	return err
+}
+
+// Убирает автора из списка list. Возвращает false, если автора в нем не было
+func (db *DB) RemoveAuthorFromList(network, authorID, list string) (bool, error) {
+	result, err := db.Exec(`
+		DELETE FROM author_lists
+		WHERE network = ? AND author_id = ? AND list = ?`,
+		network, authorID, list,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Возвращает список, в котором состоит автор, или пустую строку
+func (db *DB) GetAuthorList(network, authorID string) (string, error) {
+	var list string
+	err := db.QueryRow(`
+		SELECT list FROM author_lists
+		WHERE network = ? AND author_id = ?`,
+		network, authorID,
+	).Scan(&list)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return list, err
+}
+
+func (db *DB) GetListedAuthors() ([]ListedAuthor, error) {
+	rows, err := db.Query(`
+		SELECT network, author_id, author, list, added_by, added_at
+		FROM author_lists
+		ORDER BY list, added_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []ListedAuthor
+	for rows.Next() {
+		var a ListedAuthor
+		err := rows.Scan(&a.Network, &a.AuthorID, &a.Author, &a.List, &a.AddedBy, &a.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+
+	return authors, rows.Err()
+}
+
+// Считает сохраненные комментарии автора в соцсети, кроме комментария exceptID.
+// authorKey - ID автора, а если его нет - имя
+func (db *DB) CountAuthorComments(network, authorKey, exceptID string) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM comments
+		WHERE network = ?
+		AND (CASE WHEN author_id != '' THEN author_id ELSE author END) = ?
+		AND id != ?`,
+		network, authorKey, exceptID,
+	).Scan(&count)
+	return count, err
+}
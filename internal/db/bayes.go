@@ -0,0 +1,180 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Сколько комментариев со словом встретилось в спаме и не в спаме
+type BayesCounts struct {
+	Spam int
+	Ham  int
+}
+
+// Обучает классификатор на комментарии: tokens - уникальные слова его текста.
+// Если комментарий уже учтен в другом классе, он переносится, а не учитывается дважды
+func (db *DB) TrainBayes(commentID string, tokens []string, spam bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasSpam bool
+	err = tx.QueryRow(`SELECT is_spam FROM bayes_documents WHERE comment_id = ?`, commentID).Scan(&wasSpam)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case wasSpam == spam:
+		return nil
+	default:
+		// Снимаем прежнее обучение
+		for _, token := range tokens {
+			_, err := tx.Exec(`
+				UPDATE bayes_tokens
+				SET spam = MAX(spam - ?, 0), ham = MAX(ham - ?, 0)
+				WHERE token = ?`,
+				boolToInt(wasSpam), boolToInt(!wasSpam), token,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, token := range tokens {
+		_, err := tx.Exec(`
+			INSERT INTO bayes_tokens (token, spam, ham) VALUES (?, ?, ?)
+			ON CONFLICT(token) DO UPDATE SET
+				spam = spam + excluded.spam,
+				ham = ham + excluded.ham`,
+			token, boolToInt(spam), boolToInt(!spam),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO bayes_documents (comment_id, is_spam) VALUES (?, ?)`, commentID, spam)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Возвращает счетчики известных классификатору слов из tokens
+func (db *DB) GetBayesCounts(tokens []string) (map[string]BayesCounts, error) {
+	counts := make(map[string]BayesCounts, len(tokens))
+	if len(tokens) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(tokens))
+	for i, token := range tokens {
+		args[i] = token
+	}
+
+	rows, err := db.Query(`
+		SELECT token, spam, ham FROM bayes_tokens
+		WHERE token IN (?`+strings.Repeat(", ?", len(tokens)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		var c BayesCounts
+		if err := rows.Scan(&token, &c.Spam, &c.Ham); err != nil {
+			return nil, err
+		}
+		counts[token] = c
+	}
+
+	return counts, rows.Err()
+}
+
+// Возвращает количество обучающих комментариев-спама, не спама и известных слов
+func (db *DB) GetBayesTotals() (spamDocs, hamDocs, tokens int, err error) {
+	err = db.QueryRow(`
+		SELECT
+			COALESCE(SUM(is_spam), 0),
+			COALESCE(SUM(NOT is_spam), 0),
+			(SELECT COUNT(*) FROM bayes_tokens)
+		FROM bayes_documents`,
+	).Scan(&spamDocs, &hamDocs, &tokens)
+	return
+}
+
+// Решение модератора о том, спам ли комментарий
+type SpamFeedback struct {
+	CommentID string `db:"comment_id"`
+	SpamRule  string `db:"spam_rule"` // Что сработало на комментарий (пусто - ничего)
+	IsSpam    bool   `db:"is_spam"`
+	CreatedAt int64  `db:"created_at"` // Unix timestamp
+}
+
+// Запоминает решение модератора, заменяя прежнее решение о том же комментарии
+func (db *DB) AddSpamFeedback(feedback *SpamFeedback) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO spam_feedback
+		(comment_id, spam_rule, is_spam, created_at)
+		VALUES (?, ?, ?, ?)`,
+		feedback.CommentID, feedback.SpamRule, feedback.IsSpam, feedback.CreatedAt,
+	)
+	return err
+}
+
+func (db *DB) GetSpamFeedback() ([]SpamFeedback, error) {
+	rows, err := db.Query(`
+		SELECT comment_id, spam_rule, is_spam, created_at
+		FROM spam_feedback`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feedback []SpamFeedback
+	for rows.Next() {
+		var f SpamFeedback
+		if err := rows.Scan(&f.CommentID, &f.SpamRule, &f.IsSpam, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, f)
+	}
+
+	return feedback, rows.Err()
+}
+
+// Возвращает сохраненные комментарии для обучения классификатора.
+// Комментарии, ждущие дайджеста, модераторы еще не видели - они пропускаются
+func (db *DB) GetAllComments() ([]Comment, error) {
+	return db.queryComments(`SELECT ` + commentColumns + ` FROM comments WHERE in_digest = FALSE`)
+}
@@ -0,0 +1,299 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// Колонки comments в порядке, ожидаемом scanComment
+const commentColumns = `id, group_id, network, comment_id, author, text, timestamp, post_url,
+	is_pending, received_at, parent_text, author_id, post_id,
+	status, handled_by, handled_at, attachments, spam_rule, watch_rule,
+	sentiment, toxicity`
+
+func scanComment(row rowScanner) (*Comment, error) {
+	var c Comment
+	var attachments string
+	err := row.Scan(
+		&c.ID, &c.GroupID, &c.Network, &c.CommentID,
+		&c.Author, &c.Text, &c.Timestamp, &c.PostURL,
+		&c.IsPending, &c.ReceivedAt, &c.ParentText, &c.AuthorID, &c.PostID,
+		&c.Status, &c.HandledBy, &c.HandledAt, &attachments, &c.SpamRule, &c.WatchRule,
+		&c.Sentiment, &c.Toxicity,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if attachments != "" {
+		if err := json.Unmarshal([]byte(attachments), &c.Attachments); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+func (db *DB) queryComments(query string, args ...any) ([]Comment, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, *comment)
+	}
+
+	return comments, nil
+}
+
+// Сохраняет комментарий. Повторное сохранение обновляет данные комментария,
+// но не его состояние (status, handled_by, handled_at) и ключ (rowid)
+func (db *DB) saveComment(group *MonitoredGroup, comment *Comment, receivedAt int64, pending, inDigest bool) (int64, error) {
+	var attachments []byte
+	if len(comment.Attachments) > 0 {
+		var err error
+		attachments, err = json.Marshal(comment.Attachments)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var key int64
+	err := db.QueryRow(`
+		INSERT INTO comments
+		(id, group_id, network, comment_id, author, text, timestamp, post_url,
+		is_pending, received_at, parent_text, author_id, post_id, in_digest, attachments, spam_rule, watch_rule,
+		sentiment, toxicity)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			group_id = excluded.group_id,
+			network = excluded.network,
+			comment_id = excluded.comment_id,
+			author = excluded.author,
+			text = excluded.text,
+			timestamp = excluded.timestamp,
+			post_url = excluded.post_url,
+			is_pending = excluded.is_pending,
+			received_at = excluded.received_at,
+			parent_text = excluded.parent_text,
+			author_id = excluded.author_id,
+			post_id = excluded.post_id,
+			in_digest = excluded.in_digest,
+			attachments = excluded.attachments,
+			spam_rule = excluded.spam_rule,
+			watch_rule = excluded.watch_rule,
+			sentiment = excluded.sentiment,
+			toxicity = excluded.toxicity
+		RETURNING rowid`,
+		comment.ID,
+		group.ID,
+		group.Network,
+		comment.CommentID,
+		comment.Author,
+		comment.Text,
+		comment.Timestamp,
+		comment.PostURL,
+		pending,
+		receivedAt,
+		comment.ParentText,
+		comment.AuthorID,
+		comment.PostID,
+		inDigest,
+		string(attachments),
+		comment.SpamRule,
+		comment.WatchRule,
+		comment.Sentiment,
+		comment.Toxicity,
+	).Scan(&key)
+
+	return key, err
+}
+
+// Сохраняет комментарий группы как ожидающий отправки
+func (db *DB) SavePendingComment(group *MonitoredGroup, comment *Comment, receivedAt int64) error {
+	_, err := db.saveComment(group, comment, receivedAt, true, false)
+	return err
+}
+
+// Сохраняет уже отправленный комментарий, чтобы позже показать его полностью.
+// Возвращает короткий ключ записи (rowid) для кнопок
+func (db *DB) SaveSentComment(group *MonitoredGroup, comment *Comment, receivedAt int64) (int64, error) {
+	return db.saveComment(group, comment, receivedAt, false, false)
+}
+
+// Возвращает комментарий по ключу из SaveSentComment. Если не найден, возвращает nil
+func (db *DB) GetCommentByKey(key int64) (*Comment, error) {
+	comments, err := db.queryComments(`
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE rowid = ?`,
+		key,
+	)
+	if err != nil || len(comments) == 0 {
+		return nil, err
+	}
+
+	return &comments[0], nil
+}
+
+// Добавляет комментарий в буфер дайджеста
+func (db *DB) SaveDigestComment(group *MonitoredGroup, comment *Comment, receivedAt int64) error {
+	_, err := db.saveComment(group, comment, receivedAt, false, true)
+	return err
+}
+
+// Возвращает комментарии из буфера дайджеста, полученные до until,
+// упорядоченные по группе, посту и времени
+func (db *DB) GetDigestComments(until int64) ([]Comment, error) {
+	return db.queryComments(`
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE in_digest = TRUE
+		AND received_at < ?
+		ORDER BY group_id, CASE WHEN post_id != '' THEN post_id ELSE post_url END, timestamp`,
+		until,
+	)
+}
+
+// Убирает из буфера дайджеста комментарии группы, полученные до until
+func (db *DB) ClearDigest(groupID int64, until int64) error {
+	_, err := db.Exec(`
+		UPDATE comments SET in_digest = FALSE
+		WHERE in_digest = TRUE AND group_id = ? AND received_at < ?`, groupID, until)
+	return err
+}
+
+// Запоминает действие модератора над комментарием
+func (db *DB) SetCommentStatus(key int64, status, handledBy string, handledAt int64) error {
+	_, err := db.Exec(`
+		UPDATE comments
+		SET status = ?, handled_by = ?, handled_at = ?
+		WHERE rowid = ?`,
+		status, handledBy, handledAt, key,
+	)
+	return err
+}
+
+// Возвращает ключи последних limit комментариев с состоянием status, сначала новые
+func (db *DB) GetCommentKeysByStatus(status string, limit int) ([]int64, error) {
+	rows, err := db.Query(`
+		SELECT rowid FROM comments
+		WHERE status = ?
+		ORDER BY handled_at DESC
+		LIMIT ?`,
+		status, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []int64
+	for rows.Next() {
+		var key int64
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Запоминает оповещение о комментарии, чтобы узнавать комментарий по ответу на оповещение
+func (db *DB) SetCommentNotification(key int64, chatID int64, messageID int) error {
+	_, err := db.Exec(`
+		UPDATE comments
+		SET notification_chat_id = ?, notification_message_id = ?
+		WHERE rowid = ?`,
+		chatID, messageID, key,
+	)
+	return err
+}
+
+// Запоминает закрепленное критичное оповещение о комментарии (0 - нет такого)
+func (db *DB) SetCommentAlert(key int64, chatID int64, messageID int) error {
+	_, err := db.Exec(`
+		UPDATE comments
+		SET alert_chat_id = ?, alert_message_id = ?
+		WHERE rowid = ?`,
+		chatID, messageID, key,
+	)
+	return err
+}
+
+// Возвращает критичное оповещение о комментарии. chatID = 0, если его нет
+func (db *DB) GetCommentAlert(key int64) (chatID int64, messageID int, err error) {
+	err = db.QueryRow(`
+		SELECT alert_chat_id, alert_message_id FROM comments
+		WHERE rowid = ?`,
+		key,
+	).Scan(&chatID, &messageID)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return chatID, messageID, err
+}
+
+// Возвращает ключ комментария по оповещению о нем. 0, если не найден
+func (db *DB) GetCommentKeyByNotification(chatID int64, messageID int) (int64, error) {
+	var key int64
+	err := db.QueryRow(`
+		SELECT rowid FROM comments
+		WHERE notification_chat_id = ? AND notification_message_id = ?`,
+		chatID, messageID,
+	).Scan(&key)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return key, err
+}
+
+// Возвращает ожидающие отправки комментарии, полученные после since
+func (db *DB) GetPendingComments(since int64) ([]Comment, error) {
+	return db.queryComments(`
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE is_pending = TRUE
+		AND received_at > ?`,
+		since,
+	)
+}
+
+func (db *DB) MarkCommentSent(id string) error {
+	_, err := db.Exec(`
+		UPDATE comments SET is_pending = FALSE
+		WHERE id = ?`, id)
+	return err
+}
+
+func (db *DB) DeleteGroupComments(groupID int64) error {
+	_, err := db.Exec(`DELETE FROM comments WHERE group_id = ?`, groupID)
+	return err
+}
@@ -0,0 +1,275 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import "database/sql"
+
+const (
+	FLOOD_TEXT   = "text"   // Один и тот же текст от разных авторов или под разными постами
+	FLOOD_AUTHOR = "author" // Слишком частые комментарии одного автора
+)
+
+// Серия флуда: комментарии, вместо отдельных оповещений о которых
+// отправляется одно общее и обновляется при новых повторах
+type FloodCluster struct {
+	ID        int64  `db:"id"`
+	GroupID   int64  `db:"group_id"`  // Ссылка на группу
+	Kind      string `db:"kind"`      // FLOOD_*
+	Signature string `db:"signature"` // Нормализованный текст или ключ автора
+	ChatID    int64  `db:"chat_id"`   // Общее оповещение (0 - не отправлено)
+	MessageID int    `db:"message_id"`
+	FirstAt   int64  `db:"first_at"` // Unix timestamp первого комментария серии
+	LastAt    int64  `db:"last_at"`  // Unix timestamp последнего комментария серии
+	Status    string `db:"status"`   // Действие модератора над всей серией
+	HandledBy string `db:"handled_by"`
+}
+
+// Сколько в серии комментариев, разных авторов и постов
+type FloodStats struct {
+	Comments int
+	Authors  int
+	Posts    int
+}
+
+// Комментарий вместе с его ключом (rowid)
+type KeyedComment struct {
+	Key int64
+	Comment
+}
+
+// Читает rowid перед колонками комментария
+type keyScanner struct {
+	row rowScanner
+	key *int64
+}
+
+func (s keyScanner) Scan(dest ...any) error {
+	return s.row.Scan(append([]any{s.key}, dest...)...)
+}
+
+// Возвращает сохраненные комментарии группы, опубликованные с since, кроме
+// комментариев закрытых модератором серий: они не начинают новую серию
+func (db *DB) GetRecentComments(groupID, since int64) ([]KeyedComment, error) {
+	rows, err := db.Query(`
+		SELECT rowid, `+commentColumns+`
+		FROM comments
+		WHERE group_id = ? AND timestamp >= ?
+		AND rowid NOT IN (
+			SELECT f.comment_key FROM flood_comments f
+			JOIN flood_clusters c ON c.id = f.cluster_id
+			WHERE c.status != ''
+		)
+		ORDER BY timestamp`,
+		groupID, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []KeyedComment
+	for rows.Next() {
+		var key int64
+		comment, err := scanComment(keyScanner{row: rows, key: &key})
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, KeyedComment{Key: key, Comment: *comment})
+	}
+
+	return comments, rows.Err()
+}
+
+const floodClusterColumns = `id, group_id, kind, signature, chat_id, message_id,
+	first_at, last_at, status, handled_by`
+
+func scanFloodCluster(row rowScanner) (*FloodCluster, error) {
+	var c FloodCluster
+	err := row.Scan(
+		&c.ID, &c.GroupID, &c.Kind, &c.Signature, &c.ChatID, &c.MessageID,
+		&c.FirstAt, &c.LastAt, &c.Status, &c.HandledBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Создает серию и возвращает ее ID
+func (db *DB) CreateFloodCluster(cluster *FloodCluster) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO flood_clusters (group_id, kind, signature, first_at, last_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		cluster.GroupID, cluster.Kind, cluster.Signature, cluster.FirstAt, cluster.LastAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	cluster.ID, err = result.LastInsertId()
+	return cluster.ID, err
+}
+
+// Возвращает открытые серии группы вида kind, пополнявшиеся с since, сначала
+// новые. Серии, закрытые модератором, не пополняются: повторы после закрытия
+// оповещают заново
+func (db *DB) GetFloodClusters(groupID int64, kind string, since int64) ([]FloodCluster, error) {
+	rows, err := db.Query(`
+		SELECT `+floodClusterColumns+`
+		FROM flood_clusters
+		WHERE group_id = ? AND kind = ? AND last_at >= ? AND status = ''
+		ORDER BY last_at DESC`,
+		groupID, kind, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clusters []FloodCluster
+	for rows.Next() {
+		cluster, err := scanFloodCluster(rows)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, *cluster)
+	}
+
+	return clusters, rows.Err()
+}
+
+// Возвращает серию по ID. Если не найдена, возвращает nil
+func (db *DB) GetFloodCluster(id int64) (*FloodCluster, error) {
+	cluster, err := scanFloodCluster(db.QueryRow(`
+		SELECT `+floodClusterColumns+`
+		FROM flood_clusters
+		WHERE id = ?`,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return cluster, err
+}
+
+// Добавляет комментарий с ключом key (см. SaveSentComment) в серию
+func (db *DB) AddFloodComment(clusterID, key, at int64) error {
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO flood_comments (cluster_id, comment_key)
+		VALUES (?, ?)`,
+		clusterID, key,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE flood_clusters
+		SET first_at = MIN(first_at, ?), last_at = MAX(last_at, ?)
+		WHERE id = ?`,
+		at, at, clusterID,
+	)
+	return err
+}
+
+// Запоминает общее оповещение о серии
+func (db *DB) SetFloodNotification(clusterID, chatID int64, messageID int) error {
+	_, err := db.Exec(`
+		UPDATE flood_clusters
+		SET chat_id = ?, message_id = ?
+		WHERE id = ?`,
+		chatID, messageID, clusterID,
+	)
+	return err
+}
+
+// Запоминает действие модератора над серией
+func (db *DB) SetFloodClusterStatus(clusterID int64, status, handledBy string) error {
+	_, err := db.Exec(`
+		UPDATE flood_clusters
+		SET status = ?, handled_by = ?
+		WHERE id = ?`,
+		status, handledBy, clusterID,
+	)
+	return err
+}
+
+func (db *DB) GetFloodStats(clusterID int64) (FloodStats, error) {
+	var stats FloodStats
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(DISTINCT CASE WHEN c.author_id != '' THEN c.author_id ELSE c.author END),
+			COUNT(DISTINCT CASE WHEN c.post_id != '' THEN c.post_id ELSE c.post_url END)
+		FROM flood_comments f
+		JOIN comments c ON c.rowid = f.comment_key
+		WHERE f.cluster_id = ?`,
+		clusterID,
+	).Scan(&stats.Comments, &stats.Authors, &stats.Posts)
+	return stats, err
+}
+
+// Возвращает комментарии серии в порядке публикации
+func (db *DB) GetFloodComments(clusterID int64) ([]Comment, error) {
+	return db.queryComments(`
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE rowid IN (SELECT comment_key FROM flood_comments WHERE cluster_id = ?)
+		ORDER BY timestamp`,
+		clusterID,
+	)
+}
+
+// Возвращает ключи комментариев серии
+func (db *DB) GetFloodCommentKeys(clusterID int64) ([]int64, error) {
+	rows, err := db.Query(`
+		SELECT comment_key FROM flood_comments
+		WHERE cluster_id = ?`,
+		clusterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []int64
+	for rows.Next() {
+		var key int64
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Удаляет серии, не пополнявшиеся с before
+func (db *DB) DeleteFloodClustersBefore(before int64) error {
+	_, err := db.Exec(`
+		DELETE FROM flood_comments
+		WHERE cluster_id IN (SELECT id FROM flood_clusters WHERE last_at < ?)`,
+		before,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`DELETE FROM flood_clusters WHERE last_at < ?`, before)
+	return err
+}
@@ -23,6 +23,83 @@ import (
 	"time"
 )
 
+// Колонки monitored_groups в порядке, ожидаемом scanGroup
+const groupColumns = `id, created_at, network, group_id, group_name, last_check, extra_data,
+	paused, consecutive_failures, last_error, last_success, paused_until,
+	route_chat_id, route_thread_id, tag, topic_chat_id, topic_thread_id, digest`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGroup(row rowScanner) (*MonitoredGroup, error) {
+	var group MonitoredGroup
+	var createdAt string
+
+	err := row.Scan(
+		&group.ID,
+		&createdAt,
+		&group.Network,
+		&group.GroupID,
+		&group.GroupName,
+		&group.LastCheck,
+		&group.ExtraData,
+		&group.Paused,
+		&group.ConsecutiveFailures,
+		&group.LastError,
+		&group.LastSuccess,
+		&group.PausedUntil,
+		&group.RouteChatID,
+		&group.RouteThreadID,
+		&group.Tag,
+		&group.TopicChatID,
+		&group.TopicThreadID,
+		&group.Digest,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	group.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func (db *DB) queryGroups(query string, args ...any) ([]MonitoredGroup, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []MonitoredGroup
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, *group)
+	}
+
+	return groups, nil
+}
+
+func (db *DB) queryGroup(query string, args ...any) (*MonitoredGroup, error) {
+	group, err := scanGroup(db.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return group, nil
+}
+
 func (db *DB) AddGroup(group *MonitoredGroup) (int64, error) {
 	result, err := db.Exec(`
 		INSERT INTO monitored_groups (network, group_id, group_name, last_check)
@@ -44,40 +121,10 @@ func (db *DB) RemoveGroup(network, groupID string) error {
 }
 
 func (db *DB) GetGroups() ([]MonitoredGroup, error) {
-	rows, err := db.Query(`
-		SELECT id, created_at, network, group_id, group_name, last_check
+	return db.queryGroups(`
+		SELECT ` + groupColumns + `
 		FROM monitored_groups
 	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var groups []MonitoredGroup
-	for rows.Next() {
-		var group MonitoredGroup
-		var createdAt string
-		err := rows.Scan(
-			&group.ID,
-			&createdAt,
-			&group.Network,
-			&group.GroupID,
-			&group.GroupName,
-			&group.LastCheck,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		group.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
-		if err != nil {
-			return nil, err
-		}
-
-		groups = append(groups, group)
-	}
-
-	return groups, nil
 }
 
 func (db *DB) UpdateLastCheck(groupID int64, timestamp int64) error {
@@ -90,114 +137,160 @@ func (db *DB) UpdateLastCheck(groupID int64, timestamp int64) error {
 }
 
 func (db *DB) GetGroupsByNetwork(network string) ([]MonitoredGroup, error) {
-	rows, err := db.Query(`
-		SELECT id, created_at, network, group_id, group_name, last_check
+	return db.queryGroups(`
+		SELECT `+groupColumns+`
 		FROM monitored_groups
 		WHERE network = ?
 	`, network)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var groups []MonitoredGroup
-	for rows.Next() {
-		var group MonitoredGroup
-		var createdAt string
-		err := rows.Scan(
-			&group.ID,
-			&createdAt,
-			&group.Network,
-			&group.GroupID,
-			&group.GroupName,
-			&group.LastCheck,
-		)
-		if err != nil {
-			return nil, err
-		}
+}
 
-		group.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
-		if err != nil {
-			return nil, err
-		}
+func (db *DB) GetGroupByNetworkAndID(network, groupID string) (*MonitoredGroup, error) {
+	return db.queryGroup(`
+        SELECT `+groupColumns+`
+        FROM monitored_groups
+        WHERE network = ? AND group_id = ?
+    `, network, groupID)
+}
 
-		groups = append(groups, group)
-	}
+func (db *DB) GetGroupByInternalID(id string) (*MonitoredGroup, error) {
+	return db.queryGroup(`
+        SELECT `+groupColumns+`
+        FROM monitored_groups
+        WHERE id = ?
+    `, id)
+}
 
-	return groups, nil
+func (db *DB) UpdateLastNotified(groupID int64, timestamp int64) error {
+	_, err := db.Exec(`
+        UPDATE monitored_groups
+        SET last_notified = ?
+        WHERE id = ?
+    `, timestamp, groupID)
+	return err
 }
 
-func (db *DB) GetGroupByNetworkAndID(network, groupID string) (*MonitoredGroup, error) {
-	var group MonitoredGroup
-	var createdAt string
+// Направляет оповещения группы в чат и топик. chatID 0 - по умолчанию
+func (db *DB) SetGroupRoute(groupID int64, chatID int64, threadID int64) error {
+	_, err := db.Exec(`
+		UPDATE monitored_groups
+		SET route_chat_id = ?, route_thread_id = ?
+		WHERE id = ?
+	`, chatID, threadID, groupID)
+	return err
+}
 
-	err := db.QueryRow(`
-        SELECT id, created_at, network, group_id, group_name, last_check, extra_data
-        FROM monitored_groups
-        WHERE network = ? AND group_id = ?
-    `, network, groupID).Scan(
-		&group.ID,
-		&createdAt,
-		&group.Network,
-		&group.GroupID,
-		&group.GroupName,
-		&group.LastCheck,
-		&group.ExtraData,
-	)
+// Запоминает топик, созданный для группы в чате chatID
+func (db *DB) SetGroupTopic(groupID int64, chatID int64, threadID int64) error {
+	_, err := db.Exec(`
+		UPDATE monitored_groups
+		SET topic_chat_id = ?, topic_thread_id = ?
+		WHERE id = ?
+	`, chatID, threadID, groupID)
+	return err
+}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
-	}
+// Режим дайджеста группы: "" - как в общих настройках, "on" или "off"
+func (db *DB) SetGroupDigest(groupID int64, mode string) error {
+	_, err := db.Exec(`UPDATE monitored_groups SET digest = ? WHERE id = ?`, mode, groupID)
+	return err
+}
 
-	group.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
-	if err != nil {
-		return nil, err
-	}
+func (db *DB) RenameGroup(groupID int64, name string) error {
+	_, err := db.Exec(`UPDATE monitored_groups SET group_name = ? WHERE id = ?`, name, groupID)
+	return err
+}
 
-	return &group, nil
+// Устанавливает метку группы. Пустая строка убирает метку
+func (db *DB) SetGroupTag(groupID int64, tag string) error {
+	_, err := db.Exec(`UPDATE monitored_groups SET tag = ? WHERE id = ?`, tag, groupID)
+	return err
 }
 
-func (db *DB) GetGroupByInternalID(id string) (*MonitoredGroup, error) {
-	var group MonitoredGroup
-	var createdAt string
+// Отмечает успешную проверку группы и сбрасывает счетчик ошибок
+func (db *DB) RecordGroupSuccess(groupID int64, timestamp int64) error {
+	_, err := db.Exec(`
+		UPDATE monitored_groups
+		SET consecutive_failures = 0, last_error = '', last_success = ?
+		WHERE id = ?
+	`, timestamp, groupID)
+	return err
+}
 
+// Отмечает неудачную проверку группы. Возвращает новое число ошибок подряд
+func (db *DB) RecordGroupFailure(groupID int64, errText string) (int, error) {
+	var failures int
 	err := db.QueryRow(`
-        SELECT id, created_at, network, group_id, group_name, last_check, extra_data
-        FROM monitored_groups
-        WHERE id = ?
-    `, id).Scan(
-		&group.ID,
-		&createdAt,
-		&group.Network,
-		&group.GroupID,
-		&group.GroupName,
-		&group.LastCheck,
-		&group.ExtraData,
-	)
+		UPDATE monitored_groups
+		SET consecutive_failures = consecutive_failures + 1, last_error = ?
+		WHERE id = ?
+		RETURNING consecutive_failures
+	`, errText, groupID).Scan(&failures)
+	return failures, err
+}
 
+// Приостанавливает мониторинг группы до until (0 - бессрочно)
+func (db *DB) PauseGroup(groupID int64, until int64) error {
+	_, err := db.Exec(`
+		UPDATE monitored_groups
+		SET paused = TRUE, paused_until = ?
+		WHERE id = ?
+	`, until, groupID)
+	return err
+}
+
+// Возобновляет мониторинг группы и сбрасывает счетчик ошибок,
+// не трогая время последнего успеха
+func (db *DB) ResumeGroup(groupID int64) error {
+	_, err := db.Exec(`
+		UPDATE monitored_groups
+		SET paused = FALSE, paused_until = 0, consecutive_failures = 0
+		WHERE id = ?
+	`, groupID)
+	return err
+}
+
+// Переносит время последней проверки всех не приостановленных отдельно
+// групп соцсети на timestamp. Возвращает количество затронутых групп
+func (db *DB) UpdateNetworkLastCheck(network string, timestamp int64) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE monitored_groups
+		SET last_check = ?
+		WHERE network = ? AND paused = FALSE
+	`, timestamp, network)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+		return 0, err
 	}
 
-	group.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	return result.RowsAffected()
+}
+
+// Возобновляет группы, срок приостановки которых истек к timestamp.
+// Возвращает возобновленные группы
+func (db *DB) ResumeExpiredPauses(timestamp int64) ([]MonitoredGroup, error) {
+	groups, err := db.queryGroups(`
+		SELECT `+groupColumns+`
+		FROM monitored_groups
+		WHERE paused = TRUE AND paused_until != 0 AND paused_until <= ?
+	`, timestamp)
 	if err != nil {
 		return nil, err
 	}
 
-	return &group, nil
+	for _, group := range groups {
+		if err := db.ResumeGroup(group.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
 }
 
-func (db *DB) UpdateLastNotified(groupID int64, timestamp int64) error {
-	_, err := db.Exec(`
-        UPDATE monitored_groups
-        SET last_notified = ?
-        WHERE id = ?
-    `, timestamp, groupID)
-	return err
+// Возвращает группы, последняя проверка которых завершилась ошибкой, или приостановленные
+func (db *DB) GetUnhealthyGroups() ([]MonitoredGroup, error) {
+	return db.queryGroups(`
+		SELECT ` + groupColumns + `
+		FROM monitored_groups
+		WHERE consecutive_failures > 0 OR paused = TRUE
+		ORDER BY consecutive_failures DESC
+	`)
 }
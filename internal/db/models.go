@@ -29,6 +29,22 @@ type MonitoredGroup struct {
 	GroupName string    `db:"group_name"` // Название группы
 	LastCheck int64     `db:"last_check"` // Время последней проверки (unix timestamp)
 	ExtraData string    `db:"extra_data"`
+
+	// Состояние группы
+	Paused              bool   `db:"paused"`               // Мониторинг приостановлен
+	PausedUntil         int64  `db:"paused_until"`         // До какого времени приостановлен (0 - бессрочно)
+	ConsecutiveFailures int    `db:"consecutive_failures"` // Неудачных проверок подряд
+	LastError           string `db:"last_error"`           // Текст последней ошибки проверки
+	LastSuccess         int64  `db:"last_success"`         // Время последней успешной проверки (unix timestamp)
+
+	// Маршрутизация оповещений
+	RouteChatID   int64  `db:"route_chat_id"`   // Чат для оповещений группы (0 - по метке или общий)
+	RouteThreadID int64  `db:"route_thread_id"` // Топик в этом чате
+	Tag           string `db:"tag"`             // Метка группы, например регион
+	TopicChatID   int64  `db:"topic_chat_id"`   // Чат, в котором создан топик группы
+	TopicThreadID int64  `db:"topic_thread_id"` // Автоматически созданный топик группы
+
+	Digest string `db:"digest"` // Дайджест: "" - как в общих настройках, "on", "off"
 }
 
 // Модель комментария
@@ -43,4 +59,46 @@ type Comment struct {
 	PostURL    string `db:"post_url"`
 	IsPending  bool   `db:"is_pending"`
 	ReceivedAt int64  `db:"received_at"` // Unix timestamp
+	ParentText string `db:"parent_text"` // Текст комментария, на который отвечают (если есть)
+	AuthorID   string `db:"author_id"`   // ID автора в соцсети
+	PostID     string `db:"post_id"`     // ID поста в соцсети
+
+	// Вложения комментария. Хранятся в колонке attachments в виде JSON
+	Attachments []Attachment `db:"attachments"`
+
+	// Сработавшее спам-правило (пусто, если не спам)
+	SpamRule string `db:"spam_rule"`
+	// Сработавшее правило отслеживания с упоминаниями (пусто, если нет)
+	WatchRule string `db:"watch_rule"`
+
+	// Оценка по словарю тональности: < 0 - негатив, > 0 - позитив
+	Sentiment float64 `db:"sentiment"`
+	// Сколько в тексте оскорблений и мата
+	Toxicity int `db:"toxicity"`
+
+	// Пост, к которому оставлен комментарий. Хранится в таблице posts
+	PostText string `db:"-"` // Текст поста
+	PostDate int64  `db:"-"` // Unix timestamp публикации поста
+
+	// Действие модератора
+	Status    string `db:"status"`     // "" - не обработан, иначе последнее действие
+	HandledBy string `db:"handled_by"` // Кто выполнил действие
+	HandledAt int64  `db:"handled_at"` // Когда (unix timestamp)
+}
+
+const (
+	ATTACHMENT_PHOTO    = "photo"
+	ATTACHMENT_STICKER  = "sticker"
+	ATTACHMENT_DOC      = "doc"
+	ATTACHMENT_LINK     = "link"
+	ATTACHMENT_VIDEO    = "video"
+	ATTACHMENT_AUDIO    = "audio"
+	ATTACHMENT_TELEGRAM = "tg" // Медиа сообщения Telegram: копируется из исходного чата
+)
+
+// Вложение комментария
+type Attachment struct {
+	Type  string `json:"type"`            // ATTACHMENT_*
+	URL   string `json:"url,omitempty"`   // Ссылка на файл (для фото - наибольший размер) или страницу
+	Title string `json:"title,omitempty"` // Название документа, ссылки, видео
 }
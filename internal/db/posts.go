@@ -0,0 +1,70 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import "database/sql"
+
+// Пост группы, к которому приходят комментарии. Кэшируется, чтобы показывать
+// пост в оповещениях о комментариях, не запрашивая его заново
+type Post struct {
+	GroupID   int64  `db:"group_id"` // Ссылка на группу
+	PostID    string `db:"post_id"`  // ID поста в соцсети
+	Text      string `db:"text"`
+	Date      int64  `db:"date"`       // Unix timestamp публикации
+	UpdatedAt int64  `db:"updated_at"` // Когда пост последний раз встречался
+}
+
+// Сохраняет пост, обновляя текст уже известного
+func (db *DB) SavePost(post *Post) error {
+	_, err := db.Exec(`
+		INSERT INTO posts (group_id, post_id, text, date, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(group_id, post_id) DO UPDATE SET
+			text = excluded.text,
+			date = excluded.date,
+			updated_at = excluded.updated_at`,
+		post.GroupID, post.PostID, post.Text, post.Date, post.UpdatedAt,
+	)
+	return err
+}
+
+// Возвращает пост группы. Если не найден, возвращает nil
+func (db *DB) GetPost(groupID int64, postID string) (*Post, error) {
+	var post Post
+	err := db.QueryRow(`
+		SELECT group_id, post_id, text, date, updated_at
+		FROM posts
+		WHERE group_id = ? AND post_id = ?`,
+		groupID, postID,
+	).Scan(&post.GroupID, &post.PostID, &post.Text, &post.Date, &post.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+// Удаляет посты, не встречавшиеся с before
+func (db *DB) DeletePostsBefore(before int64) error {
+	_, err := db.Exec(`DELETE FROM posts WHERE updated_at < ?`, before)
+	return err
+}
@@ -20,6 +20,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "modernc.org/sqlite"
 )
@@ -67,10 +68,265 @@ func NewDB(path string) (*DB, error) {
     
     CREATE INDEX IF NOT EXISTS idx_comments_group ON comments(group_id);
     CREATE INDEX IF NOT EXISTS idx_comments_pending ON comments(is_pending);
+
+    CREATE TABLE IF NOT EXISTS post_threads (
+        group_id INTEGER NOT NULL,
+        post_key TEXT NOT NULL,
+        chat_id INTEGER NOT NULL,
+        thread_id INTEGER NOT NULL,
+        message_id INTEGER NOT NULL,
+        created_at INTEGER NOT NULL,
+        PRIMARY KEY(group_id, post_key, chat_id, thread_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        created_at INTEGER NOT NULL,
+        moderator TEXT NOT NULL,
+        moderator_id INTEGER NOT NULL,
+        action TEXT NOT NULL,
+        network TEXT DEFAULT '',
+        group_id TEXT DEFAULT '',
+        comment_id TEXT DEFAULT '',
+        details TEXT DEFAULT ''
+    );
+
+    CREATE TABLE IF NOT EXISTS muted_authors (
+        network TEXT NOT NULL,
+        author_id TEXT NOT NULL,
+        author TEXT NOT NULL,
+        muted_by TEXT NOT NULL,
+        muted_at INTEGER NOT NULL,
+        PRIMARY KEY(network, author_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS posts (
+        group_id INTEGER NOT NULL,
+        post_id TEXT NOT NULL,
+        text TEXT NOT NULL,
+        date INTEGER NOT NULL,
+        updated_at INTEGER NOT NULL,
+        PRIMARY KEY(group_id, post_id),
+        FOREIGN KEY(group_id) REFERENCES monitored_groups(id) ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS author_lists (
+        network TEXT NOT NULL,
+        author_id TEXT NOT NULL,
+        author TEXT NOT NULL,
+        list TEXT NOT NULL,
+        added_by TEXT NOT NULL,
+        added_at INTEGER NOT NULL,
+        PRIMARY KEY(network, author_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS flood_clusters (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        group_id INTEGER NOT NULL,
+        kind TEXT NOT NULL,
+        signature TEXT NOT NULL,
+        chat_id INTEGER DEFAULT 0,
+        message_id INTEGER DEFAULT 0,
+        first_at INTEGER NOT NULL,
+        last_at INTEGER NOT NULL,
+        status TEXT DEFAULT '',
+        handled_by TEXT DEFAULT '',
+        FOREIGN KEY(group_id) REFERENCES monitored_groups(id) ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS flood_comments (
+        cluster_id INTEGER NOT NULL,
+        comment_key INTEGER NOT NULL,
+        PRIMARY KEY(cluster_id, comment_key),
+        FOREIGN KEY(cluster_id) REFERENCES flood_clusters(id) ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS bayes_tokens (
+        token TEXT PRIMARY KEY,
+        spam INTEGER DEFAULT 0,
+        ham INTEGER DEFAULT 0
+    );
+
+    CREATE TABLE IF NOT EXISTS bayes_documents (
+        comment_id TEXT PRIMARY KEY,
+        is_spam BOOLEAN NOT NULL
+    );
+
+    CREATE TABLE IF NOT EXISTS spam_feedback (
+        comment_id TEXT PRIMARY KEY,
+        spam_rule TEXT DEFAULT '',
+        is_spam BOOLEAN NOT NULL,
+        created_at INTEGER NOT NULL
+    );
 `)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	dbase := &DB{db}
+	if err := dbase.migrate(); err != nil {
+		return nil, err
+	}
+
+	return dbase, nil
+}
+
+// Колонка, добавленная после первоначальной схемы
+type columnMigration struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+// Новые колонки добавляются в конец списка. Существующие базы получают их
+// через ALTER TABLE при запуске
+var columnMigrations = []columnMigration{
+	{"monitored_groups", "paused", "BOOLEAN DEFAULT FALSE"},
+	{"monitored_groups", "consecutive_failures", "INTEGER DEFAULT 0"},
+	{"monitored_groups", "last_error", "TEXT DEFAULT ''"},
+	{"monitored_groups", "last_success", "INTEGER DEFAULT 0"},
+	{"monitored_groups", "paused_until", "INTEGER DEFAULT 0"},
+	{"comments", "parent_text", "TEXT DEFAULT ''"},
+	{"monitored_groups", "route_chat_id", "INTEGER DEFAULT 0"},
+	{"monitored_groups", "route_thread_id", "INTEGER DEFAULT 0"},
+	{"monitored_groups", "tag", "TEXT DEFAULT ''"},
+	{"monitored_groups", "topic_chat_id", "INTEGER DEFAULT 0"},
+	{"monitored_groups", "topic_thread_id", "INTEGER DEFAULT 0"},
+	{"monitored_groups", "digest", "TEXT DEFAULT ''"},
+	{"comments", "in_digest", "BOOLEAN DEFAULT FALSE"},
+	{"comments", "author_id", "TEXT DEFAULT ''"},
+	{"comments", "post_id", "TEXT DEFAULT ''"},
+	{"comments", "status", "TEXT DEFAULT ''"},
+	{"comments", "handled_by", "TEXT DEFAULT ''"},
+	{"comments", "handled_at", "INTEGER DEFAULT 0"},
+	{"comments", "notification_chat_id", "INTEGER DEFAULT 0"},
+	{"comments", "notification_message_id", "INTEGER DEFAULT 0"},
+	{"comments", "attachments", "TEXT DEFAULT ''"},
+	{"comments", "spam_rule", "TEXT DEFAULT ''"},
+	{"comments", "watch_rule", "TEXT DEFAULT ''"},
+	{"comments", "alert_chat_id", "INTEGER DEFAULT 0"},
+	{"comments", "alert_message_id", "INTEGER DEFAULT 0"},
+	{"comments", "sentiment", "REAL DEFAULT 0"},
+	{"comments", "toxicity", "INTEGER DEFAULT 0"},
+}
+
+func (db *DB) hasColumn(table, column string) (bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func (db *DB) migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := db.hasColumn(m.Table, m.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition))
+		if err != nil {
+			return fmt.Errorf("миграция %s.%s: %w", m.Table, m.Column, err)
+		}
+	}
+
+	if err := db.migratePostThreads(); err != nil {
+		return fmt.Errorf("миграция веток постов: %w", err)
+	}
+
+	if err := db.migrateVKCommentIDs(); err != nil {
+		return fmt.Errorf("миграция ID комментариев ВК: %w", err)
+	}
+
+	// Раньше в handled_by задержанных комментариев записывалось сработавшее
+	// правило, хотя оно и так хранится в spam_rule
+	_, err := db.Exec(`
+		UPDATE comments SET handled_by = ''
+		WHERE status = 'quarantined' AND handled_by = spam_rule`)
+	if err != nil {
+		return fmt.Errorf("миграция карантина: %w", err)
+	}
+
+	return nil
+}
+
+// Раньше ветки постов определялись ссылкой на пост, но у комментариев
+// Телеграма ссылка своя у каждого комментария. Ветки живут неделю,
+// поэтому старая таблица просто пересоздается с новым ключом
+func (db *DB) migratePostThreads() error {
+	exists, err := db.hasColumn("post_threads", "post_key")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(`
+		DROP TABLE post_threads;
+		CREATE TABLE post_threads (
+			group_id INTEGER NOT NULL,
+			post_key TEXT NOT NULL,
+			chat_id INTEGER NOT NULL,
+			thread_id INTEGER NOT NULL,
+			message_id INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY(group_id, post_key, chat_id, thread_id)
+		);`)
+	return err
+}
+
+// Раньше ID комментария ВК был "vk-<ID комментария>", но ID комментариев
+// уникальны только в пределах стены, и комментарии разных групп затирали
+// друг друга. Теперь ID содержит группу: "vk-<ID группы>_<ID комментария>".
+// Сохраненные комментарии переименовываются, а с ними ссылки на них в
+// классификаторе, отзывах о спам-фильтре и журнале. Записи классификатора
+// и отзывов о комментариях, которых уже нет в базе, остаются со старым ID:
+// группу по ним не восстановить, и новые ID с ними не совпадут
+func (db *DB) migrateVKCommentIDs() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const newID = `
+		SELECT 'vk-' || g.group_id || '_' || c.comment_id
+		FROM comments c JOIN monitored_groups g ON g.id = c.group_id
+		WHERE c.id = %[1]s.comment_id`
+	const oldID = `comment_id LIKE 'vk-%%' AND instr(comment_id, '_') = 0`
+
+	for _, table := range []string{"bayes_documents", "spam_feedback", "audit_log"} {
+		_, err := tx.Exec(fmt.Sprintf(`
+			UPDATE %[1]s SET comment_id = (`+newID+`)
+			WHERE `+oldID+`
+			AND EXISTS (SELECT 1 FROM comments c WHERE c.id = %[1]s.comment_id)`, table))
+		if err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE comments SET id = 'vk-' || (
+			SELECT g.group_id FROM monitored_groups g WHERE g.id = comments.group_id
+		) || '_' || comment_id
+		WHERE network = 'vk' AND id LIKE 'vk-%' AND instr(id, '_') = 0`)
+	if err != nil {
+		return fmt.Errorf("comments: %w", err)
+	}
+
+	return tx.Commit()
 }
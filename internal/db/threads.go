@@ -0,0 +1,72 @@
+/*
+   SNGCNOTIFIERbot - Social Network's Group Comments notifier bot
+   Copyright (C) 2025  Unbewohnte (Kasyanov Nikolay Alexeevich)
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import "database/sql"
+
+// Первое оповещение о комментарии к посту в чате. Последующие оповещения
+// о том же посте отправляются ответом на него
+type PostThread struct {
+	GroupID   int64  `db:"group_id"` // Группа в БД
+	PostKey   string `db:"post_key"` // ID поста (ссылка на пост для старых комментариев)
+	ChatID    int64  `db:"chat_id"`
+	ThreadID  int64  `db:"thread_id"`
+	MessageID int    `db:"message_id"`
+	CreatedAt int64  `db:"created_at"` // Unix timestamp
+}
+
+// Возвращает ветку поста в чате и топике. Если не найдена, возвращает nil
+func (db *DB) GetPostThread(groupID int64, postKey string, chatID int64, threadID int64) (*PostThread, error) {
+	var thread PostThread
+	err := db.QueryRow(`
+		SELECT group_id, post_key, chat_id, thread_id, message_id, created_at
+		FROM post_threads
+		WHERE group_id = ? AND post_key = ? AND chat_id = ? AND thread_id = ?`,
+		groupID, postKey, chatID, threadID,
+	).Scan(
+		&thread.GroupID, &thread.PostKey, &thread.ChatID, &thread.ThreadID,
+		&thread.MessageID, &thread.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &thread, nil
+}
+
+// Запоминает первое оповещение по посту, заменяя прежнюю ветку
+func (db *DB) SavePostThread(thread *PostThread) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO post_threads
+		(group_id, post_key, chat_id, thread_id, message_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		thread.GroupID, thread.PostKey, thread.ChatID, thread.ThreadID,
+		thread.MessageID, thread.CreatedAt,
+	)
+	return err
+}
+
+// Удаляет ветки, начатые раньше before
+func (db *DB) DeletePostThreadsBefore(before int64) error {
+	_, err := db.Exec(`DELETE FROM post_threads WHERE created_at < ?`, before)
+	return err
+}